@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+const (
+	AssignTake     = "take"
+	AssignReassign = "reassign"
+	AssignUnassign = "unassign"
+)
+
+// TicketAssignment — запись истории смены ответственного.
+// AgentID равен нулю, если назначение было снято.
+type TicketAssignment struct {
+	ID            int64  `json:"id"`
+	TicketID      int64  `json:"ticket_id"`
+	AgentID       int64  `json:"agent_id"`
+	AgentName     string `json:"agent_name"`
+	ChangedByID   int64  `json:"changed_by_id"`
+	ChangedByName string `json:"changed_by_name"`
+	Action        string `json:"action"`
+	Date          string `json:"date"`
+}
+
+func displayName(u *telebot.User) string {
+	if u.Username != "" {
+		return "@" + u.Username
+	}
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
+
+func getAssignActionText(lang, action string) string {
+	switch action {
+	case AssignTake, AssignReassign, AssignUnassign:
+		return tr(lang, "assign_action_"+action)
+	default:
+		return action
+	}
+}
+
+// assignTicket назначает ответственного (agent == nil снимает назначение),
+// записывает историю, обновляет карточку и уведомляет пользователя.
+func (s *Service) assignTicket(ticket *Ticket, agent, changedBy *telebot.User, fallbackCard *telebot.Message) (*Ticket, error) {
+	prevStatus := ticket.Status
+	a := TicketAssignment{
+		TicketID:      ticket.ID,
+		ChangedByID:   changedBy.ID,
+		ChangedByName: displayName(changedBy),
+		Date:          time.Now().Format(DateTimeLayout),
+	}
+
+	status := "in_progress"
+	switch {
+	case agent == nil:
+		a.Action = AssignUnassign
+		// Закрытое обращение остаётся закрытым: переоткрывает только reopenTicket
+		status = "open"
+		if ticket.Status == "closed" {
+			status = "closed"
+		}
+	case ticket.AssigneeID == 0 || ticket.AssigneeID == agent.ID:
+		a.Action = AssignTake
+	default:
+		a.Action = AssignReassign
+	}
+	if agent != nil {
+		a.AgentID = agent.ID
+		a.AgentName = displayName(agent)
+	}
+
+	// Назначение и смена статуса сохраняются вместе: иначе при сбое
+	// второй записи у обращения остался бы ответственный без статуса
+	var change *StatusChange
+	if ticket.Status != status {
+		c := newStatusChange(ticket, status, changedBy, true)
+		change = &c
+	}
+	if err := s.store.AssignTicket(a, change); err != nil {
+		return nil, err
+	}
+	if change != nil {
+		applyStatusChange(ticket, *change)
+	}
+
+	updated, err := s.store.GetTicket(ticket.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.refreshTicketViews(updated, prevStatus, fallbackCard)
+
+	var userText string
+	switch a.Action {
+	case AssignTake:
+		userText = tr(s.languageOf(ticket.UserID), "user_assigned_take", ticket.ID, a.AgentName)
+	case AssignReassign:
+		userText = tr(s.languageOf(ticket.UserID), "user_assigned_change", ticket.ID, a.AgentName)
+	}
+	if userText != "" {
+		s.notifyUser(ticket, userText)
+	}
+
+	return updated, nil
+}
+
+func (s *Service) handleTakeButton(c telebot.Context, ticketID int64) error {
+	ticket, err := s.store.GetTicket(ticketID)
+	if err != nil {
+		log.Printf("Ошибка получения тикета: %v", err)
+		return s.respond(c)
+	}
+
+	if ticket.Status == "closed" {
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(s.supportLanguage(), "ticket_is_closed")})
+	}
+	if ticket.AssigneeID == c.Sender().ID && ticket.Status == "in_progress" {
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(s.supportLanguage(), "already_responsible")})
+	}
+
+	if _, err := s.assignTicket(ticket, c.Sender(), c.Sender(), c.Message()); err != nil {
+		log.Printf("Ошибка назначения ответственного: %v", err)
+		return s.respond(c)
+	}
+
+	return s.respond(c, &telebot.CallbackResponse{Text: tr(s.supportLanguage(), "taken_cb")})
+}
+
+func (s *Service) handleUnassignButton(c telebot.Context, ticketID int64) error {
+	ticket, err := s.store.GetTicket(ticketID)
+	if err != nil {
+		log.Printf("Ошибка получения тикета: %v", err)
+		return s.respond(c)
+	}
+
+	if ticket.Status == "closed" {
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(s.supportLanguage(), "ticket_is_closed")})
+	}
+	if ticket.AssigneeID == 0 {
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(s.supportLanguage(), "no_assignee")})
+	}
+
+	if _, err := s.assignTicket(ticket, nil, c.Sender(), c.Message()); err != nil {
+		log.Printf("Ошибка снятия назначения: %v", err)
+		return s.respond(c)
+	}
+
+	return s.respond(c, &telebot.CallbackResponse{Text: tr(s.supportLanguage(), "unassigned_cb")})
+}
+
+// topicTicket возвращает обращение, в теме которого отправлена команда.
+// Вне группы поддержки команда игнорируется, как и другие команды агентов;
+// в группе вне темы обращения агенту уходит подсказка.
+func (s *Service) topicTicket(c telebot.Context) (*Ticket, error) {
+	if c.Chat().ID != s.cfg.SupportGroupID {
+		return nil, nil
+	}
+	if c.Message().ThreadID == 0 {
+		return nil, s.reply(c, tr(s.supportLanguage(), "topic_only"))
+	}
+
+	ticket, err := s.store.GetTicketByThreadID(c.Message().ThreadID)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Ошибка поиска тикета: %v", err)
+		}
+		return nil, s.reply(c, tr(s.supportLanguage(), "topic_ticket_absent"))
+	}
+	return ticket, nil
+}
+
+// handleAssignCommand назначает ответственным автора сообщения, на которое
+// отвечает команда, или отправителя команды, если ответа нет.
+func (s *Service) handleAssignCommand(c telebot.Context) error {
+	ticket, err := s.topicTicket(c)
+	if ticket == nil {
+		return err
+	}
+
+	lang := s.supportLanguage()
+	if ticket.Status == "closed" {
+		return s.reply(c, tr(lang, "ticket_is_closed"))
+	}
+
+	agent := c.Sender()
+	// В темах форума каждое сообщение формально отвечает на сообщение
+	// о создании темы, поэтому сервисные ответы не учитываются
+	if reply := c.Message().ReplyTo; reply != nil && reply.Sender != nil && !reply.IsService() {
+		agent = reply.Sender
+	}
+
+	if agent.IsBot {
+		return s.reply(c, tr(lang, "cannot_assign_bot"))
+	}
+	if ticket.AssigneeID == agent.ID && ticket.Status == "in_progress" {
+		return s.reply(c, tr(lang, "already_assigned", displayName(agent), ticket.ID))
+	}
+
+	if _, err := s.assignTicket(ticket, agent, c.Sender(), nil); err != nil {
+		log.Printf("Ошибка назначения ответственного: %v", err)
+		return s.reply(c, tr(lang, "error_assign"))
+	}
+
+	return s.reply(c, tr(lang, "assigned", ticket.ID, displayName(agent)))
+}
+
+func (s *Service) handleUnassignCommand(c telebot.Context) error {
+	ticket, err := s.topicTicket(c)
+	if ticket == nil {
+		return err
+	}
+
+	lang := s.supportLanguage()
+	if ticket.Status == "closed" {
+		return s.reply(c, tr(lang, "ticket_is_closed"))
+	}
+	if ticket.AssigneeID == 0 {
+		return s.reply(c, tr(lang, "no_assignee"))
+	}
+
+	if _, err := s.assignTicket(ticket, nil, c.Sender(), nil); err != nil {
+		log.Printf("Ошибка снятия назначения: %v", err)
+		return s.reply(c, tr(lang, "error_unassign"))
+	}
+
+	return s.reply(c, tr(lang, "unassigned", ticket.ID))
+}
+
+func (s *Service) handleAssignmentsCommand(c telebot.Context) error {
+	ticket, err := s.topicTicket(c)
+	if ticket == nil {
+		return err
+	}
+
+	lang := s.supportLanguage()
+	assignments, err := s.store.GetTicketAssignments(ticket.ID)
+	if err != nil {
+		log.Printf("Ошибка получения истории назначений: %v", err)
+		return s.reply(c, tr(lang, "error_assignments"))
+	}
+
+	if len(assignments) == 0 {
+		return s.reply(c, tr(lang, "no_assignments", ticket.ID))
+	}
+
+	var msg strings.Builder
+	msg.WriteString(tr(lang, "assignments_header", ticket.ID))
+	for _, a := range assignments {
+		line := tr(lang, "assignments_line", a.Date, getAssignActionText(lang, a.Action))
+		if a.AgentID != 0 {
+			line += ": " + a.AgentName
+		}
+		if a.ChangedByID != a.AgentID {
+			line += tr(lang, "assignments_changed_by", a.ChangedByName)
+		}
+		msg.WriteString(line + "\n")
+	}
+
+	return s.reply(c, msg.String())
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Автозакрытие обращений, по которым пользователь перестал отвечать.
+// Отсчёт идёт от последнего ответа поддержки: если после него пользователь
+// молчит WarnAfter, ему уходит напоминание с кнопкой «Вопрос актуален»,
+// а если и после напоминания за CloseAfter нет реакции, обращение закрывается.
+// Сообщение пользователя сбрасывает напоминание, кнопка откладывает
+// автозакрытие до следующего ответа поддержки, а новый ответ поддержки
+// начинает отсчёт заново.
+
+func (s *Service) startAutoCloseScheduler(policy AutoCloseConfig) {
+	s.startPeriodic(policy.Interval.Duration, func(now time.Time) {
+		s.applyAutoClose(policy, now)
+	})
+}
+
+func (s *Service) applyAutoClose(policy AutoCloseConfig, now time.Time) {
+	warnBefore := now.Add(-policy.WarnAfter.Duration).Format(DateTimeLayout)
+	stale, err := s.store.ListStaleTickets(warnBefore, policy.BatchSize)
+	if err != nil {
+		log.Printf("Ошибка выборки неактивных обращений: %v", err)
+	}
+	for i := range stale {
+		s.warnStaleTicket(&stale[i], policy, now)
+	}
+
+	closeBefore := now.Add(-policy.CloseAfter.Duration).Format(DateTimeLayout)
+	warned, err := s.store.ListWarnedTickets(closeBefore, policy.BatchSize)
+	if err != nil {
+		log.Printf("Ошибка выборки обращений для автозакрытия: %v", err)
+	}
+	for i := range warned {
+		s.autoCloseTicket(&warned[i])
+	}
+}
+
+func (s *Service) warnStaleTicket(t *Ticket, policy AutoCloseConfig, now time.Time) {
+	// Время запоминается до отправки, чтобы следующий проход не напомнил
+	// повторно, пока сообщение ждёт в очереди
+	if err := s.store.SetTicketStaleWarning(t.ID, now.Format(DateTimeLayout)); err != nil {
+		log.Printf("Ошибка сохранения напоминания по обращению #%d: %v", t.ID, err)
+		return
+	}
+
+	lang := s.languageOf(t.UserID)
+	markup := &telebot.ReplyMarkup{}
+	markup.Inline(markup.Row(markup.Data(tr(lang, "btn_keep_open"), fmt.Sprintf("keep_open_%d", t.ID))))
+
+	_, deferred, err := s.enqueue(OutboxMessage{
+		TicketID:    t.ID,
+		ChatID:      t.UserID,
+		Text:        tr(lang, "stale_warning", t.ID, humanDuration(lang, policy.CloseAfter.Duration)),
+		ReplyMarkup: outboxMarkup(markup),
+	})
+	if err != nil && !deferred {
+		// Пользователь не получил вопроса, поэтому обращение не закрывается
+		// до следующего ответа поддержки
+		log.Printf("Ошибка отправки напоминания по обращению #%d: %v", t.ID, err)
+		if err := s.store.KeepTicketOpen(t.ID, now.Format(DateTimeLayout)); err != nil {
+			log.Printf("Ошибка сброса напоминания по обращению #%d: %v", t.ID, err)
+		}
+		return
+	}
+
+	s.notifyTopic(t, tr(s.supportLanguage(), "stale_warning_topic", humanDuration(s.supportLanguage(), policy.CloseAfter.Duration)))
+}
+
+func (s *Service) autoCloseTicket(t *Ticket) {
+	prevStatus := t.Status
+	if err := s.changeTicketStatus(t, "closed", s.me, true); err != nil {
+		log.Printf("Ошибка автозакрытия обращения #%d: %v", t.ID, err)
+		return
+	}
+	log.Printf("Обращение #%d закрыто автоматически", t.ID)
+
+	s.refreshTicketViews(t, prevStatus, nil)
+	s.notifyTopic(t, tr(s.supportLanguage(), "auto_closed_topic", t.ID))
+
+	lang := s.languageOf(t.UserID)
+	s.notifyUser(t, tr(lang, "auto_closed", t.ID, tr(lang, "btn_my_tickets")))
+}
+
+// resetStaleWarning снимает напоминание после активности пользователя
+// или нового ответа поддержки.
+func (s *Service) resetStaleWarning(t *Ticket) {
+	if t.StaleWarnedAt == "" {
+		return
+	}
+	if err := s.store.SetTicketStaleWarning(t.ID, ""); err != nil {
+		log.Printf("Ошибка сброса напоминания по обращению #%d: %v", t.ID, err)
+		return
+	}
+	t.StaleWarnedAt = ""
+}
+
+func (s *Service) handleKeepOpenButton(c telebot.Context, ticketID int64) error {
+	lang := s.userLanguage(c.Sender())
+	ticket, err := s.store.GetTicket(ticketID)
+	if err != nil {
+		log.Printf("Ошибка получения тикета: %v", err)
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "error_data")})
+	}
+
+	if ticket.UserID != c.Sender().ID {
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "not_your_ticket")})
+	}
+	if ticket.Status == "closed" {
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "keep_open_closed", tr(lang, "btn_my_tickets")), ShowAlert: true})
+	}
+
+	if err := s.store.KeepTicketOpen(ticket.ID, time.Now().Format(DateTimeLayout)); err != nil {
+		log.Printf("Ошибка сброса напоминания по обращению #%d: %v", ticket.ID, err)
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "error_data")})
+	}
+
+	if _, err := s.bot.Edit(c.Message(), tr(lang, "keep_open_done", ticket.ID), &telebot.SendOptions{}); err != nil {
+		log.Printf("Ошибка обновления напоминания: %v", err)
+	}
+	if ticket.StaleWarnedAt != "" {
+		s.notifyTopic(ticket, tr(s.supportLanguage(), "keep_open_topic"))
+	}
+	return s.respond(c)
+}
+
+// humanDuration выводит интервал в самых крупных целых единицах: дни, часы или минуты.
+func humanDuration(lang string, d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		return tr(lang, "duration_days", int(d/(24*time.Hour)))
+	case d >= time.Hour && d%time.Hour == 0:
+		return tr(lang, "duration_hours", int(d/time.Hour))
+	default:
+		return tr(lang, "duration_minutes", int(d/time.Minute))
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// backdateCustomerMessages сдвигает сообщения пользователя в прошлое,
+// чтобы последним в обращении остался ответ поддержки.
+func (e *handlerEnv) backdateCustomerMessages(t *testing.T, ticketID int64) {
+	t.Helper()
+	_, err := e.store.(*SQLStore).db.Exec(
+		`UPDATE ticket_messages SET date = $1 WHERE ticket_id = $2 AND NOT is_support`,
+		"2026-01-01 10:00:00", ticketID,
+	)
+	if err != nil {
+		t.Fatalf("сдвиг сообщений пользователя: %v", err)
+	}
+}
+
+func TestAutoClose(t *testing.T) {
+	policy := defaultConfig().AutoClose
+	warned := time.Now().Add(policy.WarnAfter.Duration + time.Minute)
+
+	tests := []struct {
+		name      string
+		keepOpen  bool
+		blocked   bool
+		wantClose bool
+	}{
+		{"без ответа пользователя закрывается", false, false, true},
+		{"кнопка оставляет открытым", true, false, false},
+		{"недоставленное напоминание не закрывает", false, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newHandlerEnv(t)
+			ticket, _ := e.createTicket(t)
+			e.backdateCustomerMessages(t, ticket.ID)
+			e.topicMessage(t, ticket.ThreadID, "Проверьте, пожалуйста, ещё раз")
+			e.bot.Reset()
+			if tt.blocked {
+				e.bot.Errors["Send"] = telebot.ErrBlockedByUser
+			}
+
+			e.svc.applyAutoClose(policy, warned)
+			warning := e.expectSent(t, e.user.ID, tr("ru", "stale_warning", ticket.ID, humanDuration("ru", policy.CloseAfter.Duration)))
+			if warning.SendOptions().ReplyMarkup == nil {
+				t.Fatalf("у напоминания нет кнопки")
+			}
+
+			if tt.keepOpen {
+				e.press(t, e.user, warning.Message, "keep_open_"+strconv.FormatInt(ticket.ID, 10))
+				e.expectSent(t, testGroupID, tr(e.svc.supportLanguage(), "keep_open_topic"))
+			}
+
+			e.bot.Reset()
+			e.svc.applyAutoClose(policy, warned.Add(time.Minute))
+			e.svc.applyAutoClose(policy, warned.Add(policy.CloseAfter.Duration+time.Minute))
+
+			for _, c := range e.sent(e.user.ID) {
+				if c.SendOptions().ReplyMarkup != nil && c.Text() == warning.Text() {
+					t.Fatalf("напоминание отправлено повторно")
+				}
+			}
+			if closed := e.ticket(t, ticket.ID).Status == "closed"; closed != tt.wantClose {
+				t.Fatalf("обращение закрыто: %v, ожидалось %v", closed, tt.wantClose)
+			}
+		})
+	}
+}
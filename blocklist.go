@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Блокировка пользователей агентами: /block [ID] [срок] [причина] и
+// /unblock [ID]. В теме обращения ID можно не указывать — блокируется
+// автор обращения. Сообщения заблокированного пользователя не пересылаются,
+// команды, кнопки меню и кнопки под сообщениями бота не работают,
+// а о блокировке ему напоминается не чаще раза в час.
+
+// UserBlock — блокировка пользователя. Пустой ExpiresAt означает бессрочную.
+type UserBlock struct {
+	UserID        int64  `json:"user_id"`
+	Reason        string `json:"reason,omitempty"`
+	BlockedByID   int64  `json:"blocked_by_id"`
+	BlockedByName string `json:"blocked_by_name"`
+	BlockedAt     string `json:"blocked_at"`
+	ExpiresAt     string `json:"expires_at,omitempty"`
+}
+
+func (b *UserBlock) active(now time.Time) bool {
+	return b.ExpiresAt == "" || b.ExpiresAt > now.Format(DateTimeLayout)
+}
+
+// activeUserBlock возвращает действующую блокировку пользователя или nil.
+func (s *Service) activeUserBlock(userID int64) *UserBlock {
+	b, err := s.store.GetUserBlock(userID)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Ошибка проверки блокировки пользователя %d: %v", userID, err)
+		}
+		return nil
+	}
+	if !b.active(time.Now()) {
+		return nil
+	}
+	return b
+}
+
+// rejectBlockedUser не даёт заблокированному пользователю писать
+// в поддержку и пользоваться командами и меню. Возвращает true, если
+// сообщение обрабатывать не нужно.
+func (s *Service) rejectBlockedUser(c telebot.Context) (bool, error) {
+	b := s.activeUserBlock(c.Sender().ID)
+	if b == nil {
+		return false, nil
+	}
+	if ok, _ := s.blockedNotices.allow(c.Sender().ID, time.Now()); !ok {
+		return true, nil
+	}
+
+	lang := s.userLanguage(c.Sender())
+	return true, s.send(c, blockNotice(lang, tr(lang, "blocked_user"), b))
+}
+
+// rejectBlockedCallback не даёт заблокированному пользователю нажимать
+// кнопки бота вне группы поддержки. Возвращает true, если нажатие
+// обрабатывать не нужно.
+func (s *Service) rejectBlockedCallback(c telebot.Context) (bool, error) {
+	if s.isSupportGroupCallback(c) || s.activeUserBlock(c.Sender().ID) == nil {
+		return false, nil
+	}
+	lang := s.userLanguage(c.Sender())
+	return true, s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "blocked_user"), ShowAlert: true})
+}
+
+// blockNotice дополняет header сроком и причиной блокировки.
+func blockNotice(lang, header string, b *UserBlock) string {
+	text := header + tr(lang, "blocked_forever")
+	if b.ExpiresAt != "" {
+		text = header + tr(lang, "blocked_until", b.ExpiresAt)
+	}
+	if b.Reason != "" {
+		text += tr(lang, "blocked_reason", b.Reason)
+	}
+	return text
+}
+
+// parseBlockDuration понимает интервалы Go ("30m", "12h") и дни ("7d").
+func parseBlockDuration(s string) (time.Duration, bool) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, false
+		}
+		return time.Duration(n) * 24 * time.Hour, true
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// blockTarget определяет пользователя команды: ID из первого аргумента
+// или автор обращения, если команда отправлена в его теме.
+func (s *Service) blockTarget(c telebot.Context, args []string) (int64, []string) {
+	if len(args) > 0 {
+		if id, err := strconv.ParseInt(args[0], 10, 64); err == nil {
+			return id, args[1:]
+		}
+	}
+	if c.Message().ThreadID == 0 {
+		return 0, args
+	}
+	ticket, err := s.store.GetTicketByThreadID(c.Message().ThreadID)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Ошибка поиска тикета: %v", err)
+		}
+		return 0, args
+	}
+	return ticket.UserID, args
+}
+
+func (s *Service) handleBlockCommand(c telebot.Context) error {
+	if c.Chat().ID != s.cfg.SupportGroupID {
+		return nil
+	}
+
+	lang := s.supportLanguage()
+	userID, args := s.blockTarget(c, strings.Fields(c.Message().Payload))
+	if userID == 0 {
+		return s.reply(c, tr(lang, "block_usage"))
+	}
+	if userID == s.me.ID || userID == c.Sender().ID {
+		return s.reply(c, tr(lang, "block_self"))
+	}
+
+	now := time.Now()
+	b := UserBlock{
+		UserID:        userID,
+		BlockedByID:   c.Sender().ID,
+		BlockedByName: displayName(c.Sender()),
+		BlockedAt:     now.Format(DateTimeLayout),
+	}
+	if len(args) > 0 {
+		if d, ok := parseBlockDuration(args[0]); ok {
+			b.ExpiresAt = now.Add(d).Format(DateTimeLayout)
+			args = args[1:]
+		}
+	}
+	b.Reason = strings.Join(args, " ")
+
+	if err := s.store.BlockUser(b); err != nil {
+		log.Printf("Ошибка блокировки пользователя %d: %v", userID, err)
+		return s.reply(c, tr(lang, "error_block"))
+	}
+	log.Printf("Пользователь %d заблокирован агентом %d до %q", userID, c.Sender().ID, b.ExpiresAt)
+
+	return s.reply(c, blockNotice(lang, tr(lang, "blocked", userID), &b))
+}
+
+func (s *Service) handleUnblockCommand(c telebot.Context) error {
+	if c.Chat().ID != s.cfg.SupportGroupID {
+		return nil
+	}
+
+	lang := s.supportLanguage()
+	userID, _ := s.blockTarget(c, strings.Fields(c.Message().Payload))
+	if userID == 0 {
+		return s.reply(c, tr(lang, "unblock_usage"))
+	}
+
+	if err := s.store.UnblockUser(userID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return s.reply(c, tr(lang, "not_blocked", userID))
+		}
+		log.Printf("Ошибка разблокировки пользователя %d: %v", userID, err)
+		return s.reply(c, tr(lang, "error_block"))
+	}
+	log.Printf("Пользователь %d разблокирован агентом %d", userID, c.Sender().ID)
+
+	s.messageLimiter.reset(userID)
+	s.ticketLimiter.reset(userID)
+	s.blockedNotices.reset(userID)
+	return s.reply(c, tr(lang, "unblocked", userID))
+}
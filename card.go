@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Карточка обращения — первое сообщение в теме с кнопками управления.
+// Текст и кнопки всегда строятся из состояния тикета в БД, поэтому
+// карточку можно обновить из любого обработчика, а не только из колбэка.
+
+func (s *Service) ticketCardText(t *Ticket) string {
+	from := "@" + t.UserName
+	if t.UserFullName != "" {
+		from = fmt.Sprintf("%s (@%s)", t.UserFullName, t.UserName)
+	}
+
+	lang := s.supportLanguage()
+	var b strings.Builder
+	b.WriteString(tr(lang, "card_text",
+		t.ID,
+		from,
+		t.UserID,
+		s.firstTicketMessage(t),
+		t.CreatedAt,
+		getStatusText(lang, t.Status),
+	))
+
+	b.WriteString(tr(lang, "card_priority", strings.TrimSpace(priorityMark(t.Priority)+" "+getPriorityText(lang, t.Priority))))
+	if t.AssigneeID != 0 {
+		b.WriteString(tr(lang, "card_assignee", t.AssigneeName))
+	}
+	return b.String()
+}
+
+// firstTicketMessage возвращает первое сообщение пользователя по обращению.
+// tickets.message хранит последнее сообщение, поэтому оно используется
+// только если история недоступна (ещё не сохранена или архивирована).
+func (s *Service) firstTicketMessage(t *Ticket) string {
+	history, err := s.store.GetTicketHistory(t.ID)
+	if err != nil {
+		log.Printf("Ошибка получения истории: %v", err)
+		return t.Message
+	}
+	for _, m := range history {
+		if m.IsSupport {
+			continue
+		}
+		if m.MediaType != "" {
+			return strings.TrimSpace(fmt.Sprintf("[%s] %s", getMediaText(s.supportLanguage(), m.MediaType), m.Text))
+		}
+		return m.Text
+	}
+	return t.Message
+}
+
+// ticketCardMarkup возвращает кнопки карточки; закрытое обращение можно только переоткрыть.
+func (s *Service) ticketCardMarkup(t *Ticket) *telebot.ReplyMarkup {
+	markup := &telebot.ReplyMarkup{}
+	switch t.Status {
+	case "open":
+		markup.Inline(
+			markup.Row(s.takeButton(markup, t.ID), s.closeButton(markup, t.ID)),
+			s.priorityButtons(markup, t),
+		)
+	case "closed":
+		markup.Inline(markup.Row(s.reopenButton(markup, t.ID)))
+	case "in_progress":
+		markup.Inline(
+			markup.Row(
+				markup.Data(tr(s.supportLanguage(), "btn_take"), fmt.Sprintf("take_btn_%d", t.ID)),
+				markup.Data(tr(s.supportLanguage(), "btn_unassign"), fmt.Sprintf("unassign_btn_%d", t.ID)),
+			),
+			markup.Row(s.closeButton(markup, t.ID)),
+			s.priorityButtons(markup, t),
+		)
+	default:
+		return nil
+	}
+	return markup
+}
+
+// updateTicketCard перерисовывает карточку обращения. Для тикетов, созданных
+// до сохранения card_message_id, используется fallback — сообщение из колбэка.
+func (s *Service) updateTicketCard(t *Ticket, fallback *telebot.Message) {
+	var card telebot.Editable
+	switch {
+	case t.CardMessageID != 0:
+		card = telebot.StoredMessage{
+			MessageID: strconv.Itoa(t.CardMessageID),
+			ChatID:    s.cfg.SupportGroupID,
+		}
+	case fallback != nil:
+		card = fallback
+	default:
+		return
+	}
+
+	// Без reply_markup Telegram убирает кнопки из сообщения
+	opts := &telebot.SendOptions{}
+	if markup := s.ticketCardMarkup(t); markup != nil {
+		opts.ReplyMarkup = markup
+	}
+
+	_, err := s.bot.Edit(card, s.ticketCardText(t), opts)
+	if err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		log.Printf("Ошибка обновления карточки #%d: %v", t.ID, err)
+	}
+}
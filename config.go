@@ -0,0 +1,547 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultConfigPath = "config.json"
+
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
+
+type Config struct {
+	BotToken string `json:"bot_token"`
+	// Адрес Bot API; пусто — api.telegram.org. Нужен для локального
+	// сервера Bot API и проверок на поддельном сервере
+	APIURL           string   `json:"api_url"`
+	SupportGroupID   int64    `json:"support_group_id"`
+	SupportGroupLink string   `json:"support_group_link"`
+	DBDriver         string   `json:"db_driver"`
+	DBPath           string   `json:"db_path"`
+	DBDSN            string   `json:"db_dsn"`
+	Mode             string   `json:"mode"`
+	PollTimeout      Duration `json:"poll_timeout"`
+	// Сколько ждать завершения начатой работы при остановке
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+	// Иконки тем по статусу обращения: custom_emoji_id из getForumTopicIconStickers
+	TopicIcons map[string]string `json:"topic_icons"`
+	// Язык пользователей, чей язык в Telegram не поддерживается
+	DefaultLanguage string `json:"default_language"`
+	// Язык сообщений в группе поддержки
+	SupportLanguage string `json:"support_language"`
+
+	Webhook   WebhookConfig   `json:"webhook"`
+	Retention RetentionConfig `json:"retention"`
+	AutoClose AutoCloseConfig `json:"auto_close"`
+	RateLimit RateLimitConfig `json:"rate_limit"`
+	Outbox    OutboxConfig    `json:"outbox"`
+	// TopicRepair — восстановление тем обращений, см. repair.go
+	TopicRepair TopicRepairConfig `json:"topic_repair"`
+}
+
+// WebhookConfig описывает приём обновлений через HTTP.
+// TLSCert/TLSKey включают TLS на самом сервере; UploadCert отправляет
+// сертификат в Telegram при регистрации (нужно для самоподписанного).
+type WebhookConfig struct {
+	Listen             string `json:"listen"`
+	Path               string `json:"path"`
+	PublicURL          string `json:"public_url"`
+	SecretToken        string `json:"secret_token"`
+	TLSCert            string `json:"tls_cert"`
+	TLSKey             string `json:"tls_key"`
+	UploadCert         bool   `json:"upload_cert"`
+	MaxConnections     int    `json:"max_connections"`
+	DropPendingUpdates bool   `json:"drop_pending_updates"`
+}
+
+// RetentionConfig задаёт политику хранения: открытые обращения не трогаются,
+// закрытые старше ArchiveAfterDays выгружаются в архив и удаляются из БД.
+type RetentionConfig struct {
+	Enabled          bool     `json:"enabled"`
+	ArchiveAfterDays int      `json:"archive_after_days"`
+	ArchiveDir       string   `json:"archive_dir"`
+	Interval         Duration `json:"interval"`
+	BatchSize        int      `json:"batch_size"`
+}
+
+// AutoCloseConfig задаёт автозакрытие обращений: если пользователь не ответил
+// поддержке за WarnAfter, ему отправляется напоминание, а если и после него
+// за CloseAfter нет реакции, обращение закрывается.
+type AutoCloseConfig struct {
+	Enabled    bool     `json:"enabled"`
+	WarnAfter  Duration `json:"warn_after"`
+	CloseAfter Duration `json:"close_after"`
+	Interval   Duration `json:"interval"`
+	BatchSize  int      `json:"batch_size"`
+}
+
+// OutboxConfig задаёт повторную доставку сообщений, которые не удалось
+// отправить сразу: пауза между попытками растёт вдвое от MinBackoff
+// до MaxBackoff, после MaxAttempts попыток сообщение считается недоставленным.
+type OutboxConfig struct {
+	MaxAttempts int      `json:"max_attempts"`
+	MinBackoff  Duration `json:"min_backoff"`
+	MaxBackoff  Duration `json:"max_backoff"`
+	Interval    Duration `json:"interval"`
+	BatchSize   int      `json:"batch_size"`
+}
+
+// TopicRepairConfig задаёт фоновую проверку обращений, оставшихся без темы
+// в группе поддержки: раз в Interval для BatchSize таких обращений темы
+// создаются заново.
+type TopicRepairConfig struct {
+	Enabled   bool     `json:"enabled"`
+	Interval  Duration `json:"interval"`
+	BatchSize int      `json:"batch_size"`
+}
+
+// RateLimitConfig ограничивает, сколько сообщений и новых обращений
+// пользователь может отправить за скользящее окно. Нулевой лимит
+// отключает соответствующее ограничение.
+type RateLimitConfig struct {
+	Enabled        bool     `json:"enabled"`
+	Messages       int      `json:"messages"`
+	MessagesWindow Duration `json:"messages_window"`
+	Tickets        int      `json:"tickets"`
+	TicketsWindow  Duration `json:"tickets_window"`
+}
+
+// Duration позволяет задавать интервалы в конфиге строкой вида "10s".
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("ожидается строка вида \"10s\": %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// ConfigError содержит все найденные ошибки конфигурации,
+// чтобы их можно было исправить за один раз.
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "некорректная конфигурация:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+func (e *ConfigError) add(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+var (
+	botTokenPattern    = regexp.MustCompile(`^\d+:[A-Za-z0-9_-]{30,}$`)
+	secretTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+)
+
+func defaultConfig() Config {
+	return Config{
+		DBDriver:        DriverSQLite,
+		DBPath:          "support.db",
+		Mode:            ModePolling,
+		PollTimeout:     Duration{10 * time.Second},
+		ShutdownTimeout: Duration{30 * time.Second},
+		DefaultLanguage: fallbackLanguage,
+		SupportLanguage: fallbackLanguage,
+		Webhook: WebhookConfig{
+			Listen: ":8443",
+			Path:   "/telegram/webhook",
+		},
+		// Архивация удаляет переписку из БД, поэтому включается только явно
+		Retention: RetentionConfig{
+			ArchiveAfterDays: 90,
+			ArchiveDir:       "archive",
+			Interval:         Duration{24 * time.Hour},
+			BatchSize:        100,
+		},
+		AutoClose: AutoCloseConfig{
+			WarnAfter:  Duration{72 * time.Hour},
+			CloseAfter: Duration{24 * time.Hour},
+			Interval:   Duration{10 * time.Minute},
+			BatchSize:  100,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:        true,
+			Messages:       20,
+			MessagesWindow: Duration{time.Minute},
+			Tickets:        3,
+			TicketsWindow:  Duration{time.Hour},
+		},
+		Outbox: OutboxConfig{
+			MaxAttempts: 10,
+			MinBackoff:  Duration{5 * time.Second},
+			MaxBackoff:  Duration{10 * time.Minute},
+			Interval:    Duration{5 * time.Second},
+			BatchSize:   50,
+		},
+		TopicRepair: TopicRepairConfig{
+			Enabled:   true,
+			Interval:  Duration{10 * time.Minute},
+			BatchSize: 20,
+		},
+	}
+}
+
+// loadConfig читает настройки из файла (если он есть), применяет
+// переопределения из переменных окружения и проверяет результат.
+// Явно указанный, но отсутствующий файл считается ошибкой.
+func loadConfig(path string, explicit bool) (*Config, error) {
+	cfg := defaultConfig()
+	cfgErr := &ConfigError{}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfg); err != nil {
+			cfgErr.add("файл %s: %v", path, err)
+		}
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+	default:
+		cfgErr.add("файл %s: %v", path, err)
+	}
+
+	applyEnvOverrides(&cfg, cfgErr)
+	cfg.validate(cfgErr)
+
+	if len(cfgErr.Problems) > 0 {
+		return nil, cfgErr
+	}
+	return &cfg, nil
+}
+
+// envOverride связывает переменную окружения с полем конфигурации:
+// parse разбирает значение и записывает его в поле.
+type envOverride struct {
+	name  string
+	parse func(v string) error
+}
+
+func envString(p *string) func(string) error {
+	return func(v string) error {
+		*p = v
+		return nil
+	}
+}
+
+func envInt(p *int) func(string) error {
+	return func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%q не является числом", v)
+		}
+		*p = n
+		return nil
+	}
+}
+
+func envInt64(p *int64) func(string) error {
+	return func(v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q не является числом", v)
+		}
+		*p = n
+		return nil
+	}
+}
+
+func envBool(p *bool) func(string) error {
+	return func(v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("%q не является true/false", v)
+		}
+		*p = b
+		return nil
+	}
+}
+
+func envDuration(p *Duration) func(string) error {
+	return func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%q не является интервалом (пример: 10s, 5m, 24h)", v)
+		}
+		*p = Duration{d}
+		return nil
+	}
+}
+
+func applyEnvOverrides(cfg *Config, cfgErr *ConfigError) {
+	overrides := []envOverride{
+		{"TELEGRAM_BOT_TOKEN", envString(&cfg.BotToken)},
+		{"TELEGRAM_API_URL", envString(&cfg.APIURL)},
+		{"SUPPORT_GROUP_ID", envInt64(&cfg.SupportGroupID)},
+		{"SUPPORT_GROUP_LINK", envString(&cfg.SupportGroupLink)},
+		{"SUPPORT_DB_DRIVER", envString(&cfg.DBDriver)},
+		{"SUPPORT_DB_PATH", envString(&cfg.DBPath)},
+		{"SUPPORT_DB_DSN", envString(&cfg.DBDSN)},
+		{"POLL_TIMEOUT", envDuration(&cfg.PollTimeout)},
+		{"SHUTDOWN_TIMEOUT", envDuration(&cfg.ShutdownTimeout)},
+		{"DEFAULT_LANGUAGE", envString(&cfg.DefaultLanguage)},
+		{"SUPPORT_LANGUAGE", envString(&cfg.SupportLanguage)},
+		{"BOT_MODE", envString(&cfg.Mode)},
+
+		{"WEBHOOK_LISTEN", envString(&cfg.Webhook.Listen)},
+		{"WEBHOOK_PATH", envString(&cfg.Webhook.Path)},
+		{"WEBHOOK_PUBLIC_URL", envString(&cfg.Webhook.PublicURL)},
+		{"WEBHOOK_SECRET_TOKEN", envString(&cfg.Webhook.SecretToken)},
+		{"WEBHOOK_TLS_CERT", envString(&cfg.Webhook.TLSCert)},
+		{"WEBHOOK_TLS_KEY", envString(&cfg.Webhook.TLSKey)},
+		{"WEBHOOK_UPLOAD_CERT", envBool(&cfg.Webhook.UploadCert)},
+		{"WEBHOOK_MAX_CONNECTIONS", envInt(&cfg.Webhook.MaxConnections)},
+		{"WEBHOOK_DROP_PENDING_UPDATES", envBool(&cfg.Webhook.DropPendingUpdates)},
+
+		{"RETENTION_ENABLED", envBool(&cfg.Retention.Enabled)},
+		{"RETENTION_ARCHIVE_AFTER_DAYS", envInt(&cfg.Retention.ArchiveAfterDays)},
+		{"RETENTION_ARCHIVE_DIR", envString(&cfg.Retention.ArchiveDir)},
+		{"RETENTION_INTERVAL", envDuration(&cfg.Retention.Interval)},
+		{"RETENTION_BATCH_SIZE", envInt(&cfg.Retention.BatchSize)},
+
+		{"AUTO_CLOSE_ENABLED", envBool(&cfg.AutoClose.Enabled)},
+		{"AUTO_CLOSE_WARN_AFTER", envDuration(&cfg.AutoClose.WarnAfter)},
+		{"AUTO_CLOSE_CLOSE_AFTER", envDuration(&cfg.AutoClose.CloseAfter)},
+		{"AUTO_CLOSE_INTERVAL", envDuration(&cfg.AutoClose.Interval)},
+		{"AUTO_CLOSE_BATCH_SIZE", envInt(&cfg.AutoClose.BatchSize)},
+
+		{"RATE_LIMIT_ENABLED", envBool(&cfg.RateLimit.Enabled)},
+		{"RATE_LIMIT_MESSAGES", envInt(&cfg.RateLimit.Messages)},
+		{"RATE_LIMIT_MESSAGES_WINDOW", envDuration(&cfg.RateLimit.MessagesWindow)},
+		{"RATE_LIMIT_TICKETS", envInt(&cfg.RateLimit.Tickets)},
+		{"RATE_LIMIT_TICKETS_WINDOW", envDuration(&cfg.RateLimit.TicketsWindow)},
+
+		{"OUTBOX_MAX_ATTEMPTS", envInt(&cfg.Outbox.MaxAttempts)},
+		{"OUTBOX_MIN_BACKOFF", envDuration(&cfg.Outbox.MinBackoff)},
+		{"OUTBOX_MAX_BACKOFF", envDuration(&cfg.Outbox.MaxBackoff)},
+		{"OUTBOX_INTERVAL", envDuration(&cfg.Outbox.Interval)},
+		{"OUTBOX_BATCH_SIZE", envInt(&cfg.Outbox.BatchSize)},
+
+		{"TOPIC_REPAIR_ENABLED", envBool(&cfg.TopicRepair.Enabled)},
+		{"TOPIC_REPAIR_INTERVAL", envDuration(&cfg.TopicRepair.Interval)},
+		{"TOPIC_REPAIR_BATCH_SIZE", envInt(&cfg.TopicRepair.BatchSize)},
+	}
+
+	for _, o := range overrides {
+		v, ok := os.LookupEnv(o.name)
+		if !ok {
+			continue
+		}
+		if err := o.parse(v); err != nil {
+			cfgErr.add("%s: %v", o.name, err)
+		}
+	}
+}
+
+func (cfg *Config) validate(cfgErr *ConfigError) {
+	switch {
+	case cfg.BotToken == "":
+		cfgErr.add("bot_token: не задан (TELEGRAM_BOT_TOKEN)")
+	case !botTokenPattern.MatchString(cfg.BotToken):
+		cfgErr.add("bot_token: неверный формат, ожидается <id>:<secret>")
+	}
+
+	if cfg.APIURL != "" && !strings.HasPrefix(cfg.APIURL, "http://") && !strings.HasPrefix(cfg.APIURL, "https://") {
+		cfgErr.add("api_url: %q должен начинаться с http:// или https://", cfg.APIURL)
+	}
+
+	switch {
+	case cfg.SupportGroupID == 0:
+		cfgErr.add("support_group_id: не задан (SUPPORT_GROUP_ID)")
+	case !strings.HasPrefix(strconv.FormatInt(cfg.SupportGroupID, 10), "-100"):
+		cfgErr.add("support_group_id: %d не является ID супергруппы (должен начинаться с -100)", cfg.SupportGroupID)
+	}
+
+	switch {
+	case cfg.SupportGroupLink == "":
+		cfgErr.add("support_group_link: не задан (SUPPORT_GROUP_LINK)")
+	case !strings.HasPrefix(cfg.SupportGroupLink, "https://t.me/"):
+		cfgErr.add("support_group_link: %q должен начинаться с https://t.me/", cfg.SupportGroupLink)
+	}
+
+	switch cfg.DBDriver {
+	case DriverSQLite:
+		if cfg.DBPath == "" {
+			cfgErr.add("db_path: не задан (SUPPORT_DB_PATH)")
+		} else if dir := filepath.Dir(cfg.DBPath); dir != "." {
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				cfgErr.add("db_path: каталог %s не существует", dir)
+			}
+		}
+	case DriverPostgres:
+		if cfg.DBDSN == "" {
+			cfgErr.add("db_dsn: обязателен для драйвера postgres (SUPPORT_DB_DSN)")
+		}
+	default:
+		cfgErr.add("db_driver: неизвестный драйвер %q, допустимы %s и %s", cfg.DBDriver, DriverSQLite, DriverPostgres)
+	}
+
+	for status := range cfg.TopicIcons {
+		switch status {
+		case "open", "in_progress", "closed":
+		default:
+			cfgErr.add("topic_icons: неизвестный статус %q, допустимы open, in_progress и closed", status)
+		}
+	}
+
+	if !isSupportedLanguage(cfg.DefaultLanguage) {
+		cfgErr.add("default_language: неизвестный язык %q, допустимы %s", cfg.DefaultLanguage, strings.Join(supportedLanguages(), ", "))
+	}
+	if !isSupportedLanguage(cfg.SupportLanguage) {
+		cfgErr.add("support_language: неизвестный язык %q, допустимы %s", cfg.SupportLanguage, strings.Join(supportedLanguages(), ", "))
+	}
+
+	switch cfg.Mode {
+	case ModePolling:
+		if cfg.PollTimeout.Duration <= 0 || cfg.PollTimeout.Duration > time.Minute {
+			cfgErr.add("poll_timeout: должен быть в пределах (0, 1m], получено %s", cfg.PollTimeout)
+		}
+	case ModeWebhook:
+		cfg.Webhook.validate(cfgErr)
+	default:
+		cfgErr.add("mode: неизвестный режим %q, допустимы %s и %s", cfg.Mode, ModePolling, ModeWebhook)
+	}
+
+	// Ожидание должно пережить хотя бы один запрос getUpdates
+	if cfg.ShutdownTimeout.Duration <= cfg.PollTimeout.Duration {
+		cfgErr.add("shutdown_timeout: должен быть больше poll_timeout (%s), получено %s", cfg.PollTimeout, cfg.ShutdownTimeout)
+	}
+
+	if r := cfg.Retention; r.Enabled {
+		if r.ArchiveAfterDays <= 0 {
+			cfgErr.add("retention.archive_after_days: должен быть больше нуля, получено %d", r.ArchiveAfterDays)
+		}
+		if r.ArchiveDir == "" {
+			cfgErr.add("retention.archive_dir: не задан (RETENTION_ARCHIVE_DIR)")
+		}
+		if r.Interval.Duration < time.Minute {
+			cfgErr.add("retention.interval: должен быть не меньше 1m, получено %s", r.Interval)
+		}
+		if r.BatchSize <= 0 {
+			cfgErr.add("retention.batch_size: должен быть больше нуля, получено %d", r.BatchSize)
+		}
+	}
+
+	if a := cfg.AutoClose; a.Enabled {
+		if a.WarnAfter.Duration < time.Minute {
+			cfgErr.add("auto_close.warn_after: должен быть не меньше 1m, получено %s", a.WarnAfter)
+		}
+		if a.CloseAfter.Duration < time.Minute {
+			cfgErr.add("auto_close.close_after: должен быть не меньше 1m, получено %s", a.CloseAfter)
+		}
+		if a.Interval.Duration < time.Minute {
+			cfgErr.add("auto_close.interval: должен быть не меньше 1m, получено %s", a.Interval)
+		}
+		if a.BatchSize <= 0 {
+			cfgErr.add("auto_close.batch_size: должен быть больше нуля, получено %d", a.BatchSize)
+		}
+	}
+
+	o := cfg.Outbox
+	if o.MaxAttempts <= 0 {
+		cfgErr.add("outbox.max_attempts: должен быть больше нуля, получено %d", o.MaxAttempts)
+	}
+	if o.MinBackoff.Duration < time.Second {
+		cfgErr.add("outbox.min_backoff: должен быть не меньше 1s, получено %s", o.MinBackoff)
+	}
+	if o.MaxBackoff.Duration < o.MinBackoff.Duration {
+		cfgErr.add("outbox.max_backoff: должен быть не меньше min_backoff (%s), получено %s", o.MinBackoff, o.MaxBackoff)
+	}
+	if o.Interval.Duration < time.Second {
+		cfgErr.add("outbox.interval: должен быть не меньше 1s, получено %s", o.Interval)
+	}
+	if o.BatchSize <= 0 {
+		cfgErr.add("outbox.batch_size: должен быть больше нуля, получено %d", o.BatchSize)
+	}
+
+	if r := cfg.TopicRepair; r.Enabled {
+		if r.Interval.Duration < time.Minute {
+			cfgErr.add("topic_repair.interval: должен быть не меньше 1m, получено %s", r.Interval)
+		}
+		if r.BatchSize <= 0 {
+			cfgErr.add("topic_repair.batch_size: должен быть больше нуля, получено %d", r.BatchSize)
+		}
+	}
+
+	if r := cfg.RateLimit; r.Enabled {
+		if r.Messages < 0 {
+			cfgErr.add("rate_limit.messages: не может быть отрицательным, получено %d", r.Messages)
+		}
+		if r.Messages > 0 && r.MessagesWindow.Duration < time.Second {
+			cfgErr.add("rate_limit.messages_window: должен быть не меньше 1s, получено %s", r.MessagesWindow)
+		}
+		if r.Tickets < 0 {
+			cfgErr.add("rate_limit.tickets: не может быть отрицательным, получено %d", r.Tickets)
+		}
+		if r.Tickets > 0 && r.TicketsWindow.Duration < time.Second {
+			cfgErr.add("rate_limit.tickets_window: должен быть не меньше 1s, получено %s", r.TicketsWindow)
+		}
+	}
+}
+
+func (w *WebhookConfig) validate(cfgErr *ConfigError) {
+	if w.Listen == "" {
+		cfgErr.add("webhook.listen: не задан (WEBHOOK_LISTEN)")
+	}
+	if !strings.HasPrefix(w.Path, "/") {
+		cfgErr.add("webhook.path: %q должен начинаться с /", w.Path)
+	}
+	if w.PublicURL != "" && !strings.HasPrefix(w.PublicURL, "https://") {
+		cfgErr.add("webhook.public_url: %q должен начинаться с https://", w.PublicURL)
+	}
+	if !secretTokenPattern.MatchString(w.SecretToken) {
+		cfgErr.add("webhook.secret_token: обязателен, 1-256 символов A-Z, a-z, 0-9, _ и - (WEBHOOK_SECRET_TOKEN)")
+	}
+
+	if (w.TLSCert == "") != (w.TLSKey == "") {
+		cfgErr.add("webhook.tls_cert и webhook.tls_key задаются только вместе")
+	}
+	for _, f := range []struct{ name, path string }{
+		{"tls_cert", w.TLSCert},
+		{"tls_key", w.TLSKey},
+	} {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			cfgErr.add("webhook.%s: %v", f.name, err)
+		}
+	}
+	if w.UploadCert && w.TLSCert == "" {
+		cfgErr.add("webhook.upload_cert: требует webhook.tls_cert")
+	}
+
+	if w.MaxConnections < 0 || w.MaxConnections > 100 {
+		cfgErr.add("webhook.max_connections: должен быть в пределах 0-100, получено %d", w.MaxConnections)
+	}
+}
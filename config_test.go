@@ -0,0 +1,110 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setRequiredEnv задаёт обязательные параметры, без которых конфигурация не загрузится.
+func setRequiredEnv(t *testing.T) {
+	t.Setenv("TELEGRAM_BOT_TOKEN", "123456:ABCDEFGHIJKLMNOPQRSTUVWXYZabcdef")
+	t.Setenv("SUPPORT_GROUP_ID", "-1001000000001")
+	t.Setenv("SUPPORT_GROUP_LINK", "https://t.me/support")
+	t.Setenv("SUPPORT_DB_PATH", filepath.Join(t.TempDir(), "support.db"))
+}
+
+func TestEnvOverrides(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("BOT_MODE", ModeWebhook)
+	t.Setenv("WEBHOOK_SECRET_TOKEN", "secret")
+	t.Setenv("WEBHOOK_MAX_CONNECTIONS", "40")
+	t.Setenv("WEBHOOK_DROP_PENDING_UPDATES", "true")
+	t.Setenv("RETENTION_BATCH_SIZE", "10")
+	t.Setenv("AUTO_CLOSE_BATCH_SIZE", "11")
+	t.Setenv("AUTO_CLOSE_WARN_AFTER", "48h")
+	t.Setenv("OUTBOX_BATCH_SIZE", "12")
+	t.Setenv("TOPIC_REPAIR_BATCH_SIZE", "13")
+	t.Setenv("RATE_LIMIT_ENABLED", "false")
+
+	cfg, err := loadConfig(filepath.Join(t.TempDir(), "config.json"), false)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	want := defaultConfig()
+	want.BotToken = cfg.BotToken
+	want.SupportGroupID = -1001000000001
+	want.SupportGroupLink = "https://t.me/support"
+	want.DBPath = cfg.DBPath
+	want.Mode = ModeWebhook
+	want.Webhook.SecretToken = "secret"
+	want.Webhook.MaxConnections = 40
+	want.Webhook.DropPendingUpdates = true
+	want.Retention.BatchSize = 10
+	want.AutoClose.BatchSize = 11
+	want.AutoClose.WarnAfter = Duration{48 * time.Hour}
+	want.Outbox.BatchSize = 12
+	want.TopicRepair.BatchSize = 13
+	want.RateLimit.Enabled = false
+	if !reflect.DeepEqual(*cfg, want) {
+		t.Fatalf("конфигурация\n%+v\nожидалась\n%+v", *cfg, want)
+	}
+}
+
+func TestEnvOverrideErrors(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("SUPPORT_GROUP_ID", "группа")
+	t.Setenv("POLL_TIMEOUT", "10")
+	t.Setenv("WEBHOOK_UPLOAD_CERT", "да")
+	t.Setenv("OUTBOX_BATCH_SIZE", "много")
+
+	_, err := loadConfig(filepath.Join(t.TempDir(), "config.json"), false)
+	cfgErr, ok := err.(*ConfigError)
+	if !ok {
+		t.Fatalf("ожидалась ConfigError, получено %v", err)
+	}
+	want := []string{
+		`SUPPORT_GROUP_ID: "группа" не является числом`,
+		`POLL_TIMEOUT: "10" не является интервалом (пример: 10s, 5m, 24h)`,
+		`WEBHOOK_UPLOAD_CERT: "да" не является true/false`,
+		`OUTBOX_BATCH_SIZE: "много" не является числом`,
+		"support_group_id: не задан (SUPPORT_GROUP_ID)",
+	}
+	if !reflect.DeepEqual(cfgErr.Problems, want) {
+		t.Fatalf("ошибки\n%q\nожидались\n%q", cfgErr.Problems, want)
+	}
+}
+
+func TestWebhookConfigErrorOrder(t *testing.T) {
+	dir := t.TempDir()
+	w := WebhookConfig{
+		Listen:      ":8443",
+		Path:        "/hook",
+		SecretToken: "secret",
+		TLSCert:     filepath.Join(dir, "cert.pem"),
+		TLSKey:      filepath.Join(dir, "key.pem"),
+	}
+
+	// Порядок ошибок не должен меняться от запуска к запуску
+	var first []string
+	for i := 0; i < 20; i++ {
+		cfgErr := &ConfigError{}
+		w.validate(cfgErr)
+		if len(cfgErr.Problems) != 2 {
+			t.Fatalf("ошибки %q", cfgErr.Problems)
+		}
+		if first == nil {
+			first = cfgErr.Problems
+			continue
+		}
+		if !reflect.DeepEqual(cfgErr.Problems, first) {
+			t.Fatalf("порядок ошибок изменился: %q, ранее %q", cfgErr.Problems, first)
+		}
+	}
+	if !strings.HasPrefix(first[0], "webhook.tls_cert: ") {
+		t.Fatalf("первой ожидалась ошибка tls_cert, получено %q", first[0])
+	}
+}
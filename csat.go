@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Опрос удовлетворённости (CSAT): после закрытия обращения пользователь
+// получает кнопки с оценкой от 1 до 5, после оценки может оставить
+// комментарий ответом на сообщение с опросом. Оценка и комментарий
+// публикуются в теме.
+
+const (
+	maxRating = 5
+	// Сколько ждать комментарий к оценке; более поздний ответ на опрос
+	// обрабатывается как обычное сообщение
+	ratingCommentTimeout = 30 * time.Minute
+	// Период отчёта /csat по умолчанию, в днях
+	defaultReportDays = 30
+)
+
+// TicketRating — оценка обращения пользователем. AgentID — ответственный
+// на момент оценки, ноль если обращение никто не брал.
+type TicketRating struct {
+	TicketID  int64  `json:"ticket_id"`
+	UserID    int64  `json:"user_id"`
+	Rating    int    `json:"rating"`
+	Comment   string `json:"comment,omitempty"`
+	AgentID   int64  `json:"agent_id,omitempty"`
+	AgentName string `json:"agent_name,omitempty"`
+	Date      string `json:"date"`
+}
+
+// awaitingComment — оценка, к которой ждут комментарий ответом
+// на сообщение с опросом messageID.
+type awaitingComment struct {
+	ticketID  int64
+	messageID int
+	until     time.Time
+}
+
+func ratingStars(rating int) string {
+	return strings.Repeat("★", rating) + strings.Repeat("☆", maxRating-rating)
+}
+
+func (s *Service) sendSatisfactionSurvey(t *Ticket) {
+	lang := s.languageOf(t.UserID)
+	markup := &telebot.ReplyMarkup{}
+	var buttons []telebot.Btn
+	for i := 1; i <= maxRating; i++ {
+		buttons = append(buttons, markup.Data(strconv.Itoa(i)+" ⭐", fmt.Sprintf("csat_%d|%d", t.ID, i)))
+	}
+	markup.Inline(markup.Row(buttons...))
+
+	out := OutboxMessage{TicketID: t.ID, ChatID: t.UserID, Text: tr(lang, "csat_survey", t.ID), ReplyMarkup: outboxMarkup(markup)}
+	if _, deferred, err := s.enqueue(out); err != nil && !deferred {
+		log.Printf("Ошибка отправки опроса по обращению #%d: %v", t.ID, err)
+	}
+}
+
+// parseRatingCallback разбирает данные кнопки вида csat_<id>|<оценка>.
+func parseRatingCallback(data string) (int64, int, bool) {
+	ticketID, ok := parseCallbackID(data, "csat_")
+	if !ok {
+		return 0, 0, false
+	}
+
+	i := strings.IndexByte(data, '|')
+	if i < 0 {
+		return 0, 0, false
+	}
+	rating, err := strconv.Atoi(data[i+1:])
+	if err != nil || rating < 1 || rating > maxRating {
+		return 0, 0, false
+	}
+	return ticketID, rating, true
+}
+
+func (s *Service) handleRatingButton(c telebot.Context, data string) error {
+	ticketID, rating, ok := parseRatingCallback(data)
+	if !ok {
+		return s.respond(c)
+	}
+
+	ticket, err := s.store.GetTicket(ticketID)
+	if err != nil {
+		log.Printf("Ошибка получения тикета: %v", err)
+		return s.respond(c)
+	}
+
+	lang := s.userLanguage(c.Sender())
+	if ticket.UserID != c.Sender().ID {
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "not_your_ticket")})
+	}
+	if ticket.Status != "closed" {
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "csat_reopened")})
+	}
+
+	r := TicketRating{
+		TicketID:  ticket.ID,
+		UserID:    ticket.UserID,
+		Rating:    rating,
+		AgentID:   ticket.AssigneeID,
+		AgentName: ticket.AssigneeName,
+		Date:      time.Now().Format(DateTimeLayout),
+	}
+	if err := s.store.SaveTicketRating(r); err != nil {
+		log.Printf("Ошибка сохранения оценки: %v", err)
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "error_save_rating")})
+	}
+
+	s.commentsMu.Lock()
+	s.awaitingComments[ticket.UserID] = awaitingComment{
+		ticketID:  ticket.ID,
+		messageID: c.Message().ID,
+		until:     time.Now().Add(ratingCommentTimeout),
+	}
+	s.commentsMu.Unlock()
+
+	s.notifyTopic(ticket, tr(s.supportLanguage(), "csat_topic", ticket.ID, ratingStars(rating), rating, maxRating))
+
+	markup := &telebot.ReplyMarkup{}
+	markup.Inline(markup.Row(markup.Data(tr(lang, "btn_skip"), fmt.Sprintf("csat_skip_%d", ticket.ID))))
+	_, err = s.bot.Edit(c.Message(), tr(lang, "csat_thanks", ticket.ID, ratingStars(rating)), markup)
+	if err != nil {
+		log.Printf("Ошибка обновления опроса: %v", err)
+	}
+
+	return s.respond(c)
+}
+
+func (s *Service) handleSkipCommentButton(c telebot.Context, ticketID int64) error {
+	s.commentsMu.Lock()
+	if a, ok := s.awaitingComments[c.Sender().ID]; ok && a.ticketID == ticketID {
+		delete(s.awaitingComments, c.Sender().ID)
+	}
+	s.commentsMu.Unlock()
+
+	// Без reply_markup Telegram убирает кнопки из сообщения
+	if _, err := s.bot.Edit(c.Message(), c.Message().Text, &telebot.SendOptions{}); err != nil {
+		log.Printf("Ошибка обновления опроса: %v", err)
+	}
+	return s.respond(c)
+}
+
+// handleRatingComment сохраняет ответ пользователя на опрос как комментарий
+// к оценке, если бот его ожидает. Возвращает false, если сообщение нужно
+// обработать как обычно.
+func (s *Service) handleRatingComment(c telebot.Context) (bool, error) {
+	m := c.Message()
+	text := strings.TrimSpace(m.Text)
+	if text == "" || m.ReplyTo == nil {
+		return false, nil
+	}
+
+	s.commentsMu.Lock()
+	a, ok := s.awaitingComments[c.Sender().ID]
+	ok = ok && a.messageID == m.ReplyTo.ID
+	if ok {
+		delete(s.awaitingComments, c.Sender().ID)
+	}
+	s.commentsMu.Unlock()
+
+	if !ok || time.Now().After(a.until) {
+		return false, nil
+	}
+
+	ticket, err := s.store.GetTicket(a.ticketID)
+	if err != nil {
+		log.Printf("Ошибка получения тикета: %v", err)
+		return false, nil
+	}
+	// Обращение переоткрыли — сообщение относится к переписке
+	if ticket.Status != "closed" {
+		return false, nil
+	}
+
+	if err := s.store.SetTicketRatingComment(ticket.ID, text); err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Ошибка сохранения комментария к оценке: %v", err)
+		}
+		return true, s.send(c, tr(s.userLanguage(c.Sender()), "error_save_comment"))
+	}
+
+	s.notifyTopic(ticket, tr(s.supportLanguage(), "csat_comment_topic", ticket.ID, text))
+
+	return true, s.send(c, tr(s.userLanguage(c.Sender()), "csat_comment_thx", ticket.ID))
+}
+
+// ratingSummary — агрегированные оценки за период или по агенту.
+type ratingSummary struct {
+	Name   string
+	Count  int
+	Sum    int
+	Counts [maxRating + 1]int
+}
+
+func (s *ratingSummary) add(r TicketRating) {
+	s.Count++
+	s.Sum += r.Rating
+	s.Counts[r.Rating]++
+}
+
+func (s *ratingSummary) average() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Sum) / float64(s.Count)
+}
+
+// satisfied — доля оценок 4 и 5 в процентах, стандартное определение CSAT.
+func (s *ratingSummary) satisfied() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Counts[4]+s.Counts[5]) * 100 / float64(s.Count)
+}
+
+func (s *ratingSummary) format(lang string) string {
+	return tr(lang, "csat_summary", s.average(), maxRating, s.satisfied(), s.Count)
+}
+
+// buildRatingReport строит отчёт за period дней до now со сравнением
+// с предыдущим периодом той же длины и разбивкой по ответственным.
+func (s *Service) buildRatingReport(lang string, days int, now time.Time) (string, error) {
+	to := now
+	from := now.AddDate(0, 0, -days)
+	prevFrom := from.AddDate(0, 0, -days)
+
+	ratings, err := s.store.GetTicketRatings(from.Format(DateTimeLayout), to.Format(DateTimeLayout))
+	if err != nil {
+		return "", err
+	}
+	prev, err := s.store.GetTicketRatings(prevFrom.Format(DateTimeLayout), from.Format(DateTimeLayout))
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(tr(lang, "csat_report_header", from.Format("2006-01-02"), to.Format("2006-01-02"), days))
+
+	if len(ratings) == 0 {
+		b.WriteString(tr(lang, "csat_report_empty"))
+		return b.String(), nil
+	}
+
+	var total, previous ratingSummary
+	agents := map[int64]*ratingSummary{}
+	for _, r := range ratings {
+		total.add(r)
+
+		a, ok := agents[r.AgentID]
+		if !ok {
+			a = &ratingSummary{Name: r.AgentName}
+			if r.AgentID == 0 {
+				a.Name = tr(lang, "csat_no_agent")
+			}
+			agents[r.AgentID] = a
+		}
+		a.add(r)
+	}
+	for _, r := range prev {
+		previous.add(r)
+	}
+
+	b.WriteString(tr(lang, "csat_average", total.format(lang)))
+	if previous.Count > 0 {
+		b.WriteString(tr(lang, "csat_previous", previous.format(lang)))
+	}
+
+	b.WriteString(tr(lang, "csat_distribution"))
+	for i := maxRating; i >= 1; i-- {
+		b.WriteString(fmt.Sprintf("%s — %d\n", ratingStars(i), total.Counts[i]))
+	}
+
+	byAgent := make([]*ratingSummary, 0, len(agents))
+	for _, a := range agents {
+		byAgent = append(byAgent, a)
+	}
+	sort.Slice(byAgent, func(i, j int) bool {
+		if byAgent[i].Count != byAgent[j].Count {
+			return byAgent[i].Count > byAgent[j].Count
+		}
+		return byAgent[i].Name < byAgent[j].Name
+	})
+
+	b.WriteString(tr(lang, "csat_by_agent"))
+	for i, a := range byAgent {
+		if i == maxReportLines {
+			b.WriteString(tr(lang, "and_more", len(byAgent)-maxReportLines))
+			break
+		}
+		b.WriteString(fmt.Sprintf("• %s: %s\n", a.Name, a.format(lang)))
+	}
+	return b.String(), nil
+}
+
+// handleRatingReportCommand — /csat [дней], отчёт по оценкам в группе поддержки.
+func (s *Service) handleRatingReportCommand(c telebot.Context) error {
+	if c.Chat().ID != s.cfg.SupportGroupID {
+		return nil
+	}
+
+	lang := s.supportLanguage()
+	days := defaultReportDays
+	if payload := strings.TrimSpace(c.Message().Payload); payload != "" {
+		n, err := strconv.Atoi(payload)
+		if err != nil || n <= 0 {
+			return s.reply(c, tr(lang, "csat_usage"))
+		}
+		days = n
+	}
+
+	report, err := s.buildRatingReport(lang, days, time.Now())
+	if err != nil {
+		log.Printf("Ошибка построения отчёта по оценкам: %v", err)
+		return s.reply(c, tr(lang, "error_report"))
+	}
+	return s.reply(c, report)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// userReply отправляет от пользователя ответ text на сообщение to.
+func (e *handlerEnv) userReply(t *testing.T, text string, to *telebot.Message) {
+	t.Helper()
+	lastTestMessageID++
+	m := &telebot.Message{
+		ID:      lastTestMessageID,
+		Sender:  e.user,
+		Chat:    &telebot.Chat{ID: e.user.ID, Type: telebot.ChatPrivate},
+		Text:    text,
+		ReplyTo: to,
+	}
+	if err := e.svc.handleTextMessages(NewFakeMessageContext(m)); err != nil {
+		t.Fatalf("ответ пользователя %q: %v", text, err)
+	}
+}
+
+// rating возвращает сохранённую оценку обращения.
+func (e *handlerEnv) rating(t *testing.T, ticketID int64) *TicketRating {
+	t.Helper()
+	ratings, err := e.store.GetTicketRatings("2000-01-01 00:00:00", "2100-01-01 00:00:00")
+	if err != nil {
+		t.Fatalf("GetTicketRatings: %v", err)
+	}
+	for i := range ratings {
+		if ratings[i].TicketID == ticketID {
+			return &ratings[i]
+		}
+	}
+	return nil
+}
+
+func TestSatisfactionSurvey(t *testing.T) {
+	const comment = "Быстро разобрались, спасибо"
+
+	tests := []struct {
+		name string
+		// before выполняется между оценкой и сообщением пользователя
+		before      func(t *testing.T, e *handlerEnv, ticket *Ticket, survey *telebot.Message)
+		reply       bool
+		wantComment bool
+	}{
+		{"комментарий ответом на опрос", nil, true, true},
+		{"обычное сообщение не комментарий", nil, false, false},
+		{"после пропуска не комментарий", func(t *testing.T, e *handlerEnv, ticket *Ticket, survey *telebot.Message) {
+			e.press(t, e.user, survey, "csat_skip_"+strconv.FormatInt(ticket.ID, 10))
+		}, true, false},
+		{"после окна не комментарий", func(t *testing.T, e *handlerEnv, ticket *Ticket, survey *telebot.Message) {
+			e.svc.commentsMu.Lock()
+			a := e.svc.awaitingComments[e.user.ID]
+			a.until = time.Now().Add(-time.Second)
+			e.svc.awaitingComments[e.user.ID] = a
+			e.svc.commentsMu.Unlock()
+		}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newHandlerEnv(t)
+			ticket, card := e.createTicket(t)
+			e.press(t, e.agent, card, "close_btn_"+strconv.FormatInt(ticket.ID, 10))
+			survey := e.expectSent(t, e.user.ID, tr("ru", "csat_survey", ticket.ID)).Message
+			e.bot.Reset()
+
+			e.press(t, e.user, survey, "csat_"+strconv.FormatInt(ticket.ID, 10)+"|4")
+			r := e.rating(t, ticket.ID)
+			if r == nil || r.Rating != 4 {
+				t.Fatalf("оценка не сохранена: %+v", r)
+			}
+			e.expectSent(t, testGroupID, tr(e.svc.supportLanguage(), "csat_topic", ticket.ID, ratingStars(4), 4, maxRating))
+			if n := len(e.bot.Calls("Edit")); n != 1 {
+				t.Fatalf("опрос обновлён %d раз", n)
+			}
+
+			if tt.before != nil {
+				tt.before(t, e, ticket, survey)
+			}
+			e.bot.Reset()
+			if tt.reply {
+				e.userReply(t, comment, survey)
+			} else {
+				e.userMessage(t, comment)
+			}
+
+			saved := e.rating(t, ticket.ID).Comment == comment
+			if saved != tt.wantComment {
+				t.Fatalf("комментарий сохранён: %v, ожидалось %v", saved, tt.wantComment)
+			}
+			thanked := false
+			for _, c := range e.sent(e.user.ID) {
+				thanked = thanked || c.Text() == tr("ru", "csat_comment_thx", ticket.ID)
+			}
+			if thanked != tt.wantComment {
+				t.Fatalf("подтверждение комментария: %v, ожидалось %v", thanked, tt.wantComment)
+			}
+			if tt.wantComment {
+				e.expectSent(t, testGroupID, tr(e.svc.supportLanguage(), "csat_comment_topic", ticket.ID, comment))
+			}
+		})
+	}
+}
+
+func TestParseRatingCallback(t *testing.T) {
+	tests := []struct {
+		data       string
+		wantTicket int64
+		wantRating int
+		wantOK     bool
+	}{
+		{"csat_12|5", 12, 5, true},
+		{"csat_12|1", 12, 1, true},
+		{"csat_12|0", 0, 0, false},
+		{"csat_12|6", 0, 0, false},
+		{"csat_12", 0, 0, false},
+		{"csat_x|3", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			ticketID, rating, ok := parseRatingCallback(tt.data)
+			if ticketID != tt.wantTicket || rating != tt.wantRating || ok != tt.wantOK {
+				t.Fatalf("parseRatingCallback(%q) = %d, %d, %v", tt.data, ticketID, rating, ok)
+			}
+		})
+	}
+}
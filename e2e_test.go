@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Сквозная проверка: настоящий telebot.Bot со всей обвязкой из startBot
+// (long polling, createForumTopic через Raw, проверка прав в группе)
+// работает против FakeBotAPI и проходит полный цикл обращения.
+
+const (
+	e2eGroupID = -1001234567890
+	e2eTimeout = 5 * time.Second
+)
+
+// e2eRun — состояние сценария, которое шаги передают друг другу.
+type e2eRun struct {
+	api   *FakeBotAPI
+	store Store
+	user  *telebot.User
+	agent *telebot.User
+
+	ticket *Ticket
+	card   *telebot.Message
+}
+
+type e2eStep struct {
+	name string
+	run  func(r *e2eRun) error
+}
+
+var e2eSteps = []e2eStep{
+	{"создание обращения", e2eCreateTicket},
+	{"взятие в работу", e2eTakeTicket},
+	{"ответ агента", e2eAgentReply},
+	{"сообщение пользователя", e2eUserMessage},
+	{"закрытие обращения", e2eCloseTicket},
+	{"история", e2eHistory},
+}
+
+// TestTicketLifecycleE2E поднимает FakeBotAPI и бота с временной базой
+// и выполняет шаги сценария по порядку до первой ошибки.
+func TestTicketLifecycleE2E(t *testing.T) {
+	api := NewFakeBotAPI(e2eGroupID)
+	defer api.Close()
+
+	cfg := defaultConfig()
+	cfg.APIURL = api.URL()
+	cfg.BotToken = api.Token
+	cfg.SupportGroupID = e2eGroupID
+	cfg.SupportGroupLink = "https://t.me/+support"
+	cfg.DBPath = filepath.Join(t.TempDir(), "support.db")
+	cfg.PollTimeout = Duration{time.Second}
+	cfg.Retention.Enabled = false
+	cfg.AutoClose.Enabled = false
+
+	cfgErr := &ConfigError{}
+	cfg.validate(cfgErr)
+	if len(cfgErr.Problems) > 0 {
+		t.Fatalf("конфигурация: %v", cfgErr)
+	}
+
+	store, err := openStore(&cfg)
+	if err != nil {
+		t.Fatalf("ошибка инициализации БД: %v", err)
+	}
+	defer store.Close()
+
+	bot, svc, err := startBot(&cfg, store)
+	if err != nil {
+		t.Fatalf("запуск бота: %v", err)
+	}
+	stop := make(chan struct{})
+	served := make(chan struct{})
+	go func() {
+		serve(bot, stop)
+		close(served)
+	}()
+
+	r := &e2eRun{
+		api:   api,
+		store: store,
+		user:  &telebot.User{ID: 1001, FirstName: "Иван", Username: "ivan", LanguageCode: "ru"},
+		agent: &telebot.User{ID: 2002, FirstName: "Анна", Username: "anna"},
+	}
+	for i, step := range e2eSteps {
+		if err := step.run(r); err != nil {
+			t.Fatalf("шаг %d «%s»: %v", i+1, step.name, err)
+		}
+		t.Logf("шаг %d «%s» пройден", i+1, step.name)
+	}
+
+	// Нажатие, полученное перед остановкой, должно быть обработано до конца
+	r.api.PressButton(r.agent, r.card, "\freopen_btn_"+strconv.FormatInt(r.ticket.ID, 10))
+	if err := r.api.WaitDelivered(e2eTimeout); err != nil {
+		t.Fatalf("доставка нажатия: %v", err)
+	}
+	if err := svc.shutdown(stop, served, cfg.ShutdownTimeout.Duration); err != nil {
+		t.Fatalf("остановка: %v", err)
+	}
+	ticket, err := store.GetTicket(r.ticket.ID)
+	if err != nil {
+		t.Fatalf("GetTicket: %v", err)
+	}
+	if ticket.Status != "open" {
+		t.Fatalf("остановка: обращение в статусе %q, обработчик прерван", ticket.Status)
+	}
+}
+
+func (r *e2eRun) userMessage(text string) *telebot.Message {
+	return r.api.PushMessage(&telebot.Message{
+		Sender: r.user,
+		Chat:   &telebot.Chat{ID: r.user.ID, Type: telebot.ChatPrivate, FirstName: r.user.FirstName},
+		Text:   text,
+	})
+}
+
+func (r *e2eRun) topicMessage(text string) *telebot.Message {
+	return r.api.PushMessage(&telebot.Message{
+		Sender:   r.agent,
+		Chat:     &telebot.Chat{ID: e2eGroupID, Type: telebot.ChatSuperGroup},
+		ThreadID: r.ticket.ThreadID,
+		Text:     text,
+	})
+}
+
+// expectSend ждёт сообщение от бота в чат chatID, текст которого содержит want.
+func (r *e2eRun) expectSend(chatID int64, want string) (FakeAPIRequest, error) {
+	return r.api.Expect("sendMessage", func(req FakeAPIRequest) bool {
+		return req.Params["chat_id"] == strconv.FormatInt(chatID, 10) && strings.Contains(req.Params["text"], want)
+	}, e2eTimeout)
+}
+
+// pressCardButton нажимает от имени агента кнопку карточки, данные
+// которой начинаются с prefix.
+func (r *e2eRun) pressCardButton(prefix string) error {
+	if r.card.ReplyMarkup == nil {
+		return fmt.Errorf("у карточки нет кнопок")
+	}
+	for _, row := range r.card.ReplyMarkup.InlineKeyboard {
+		for _, btn := range row {
+			if strings.HasPrefix(strings.TrimPrefix(btn.Data, "\f"), prefix) {
+				r.api.PressButton(r.agent, r.card, btn.Data)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("на карточке нет кнопки %s", prefix)
+}
+
+// refreshTicket перечитывает обращение из базы и проверяет его статус.
+func (r *e2eRun) refreshTicket(status string) error {
+	deadline := time.Now().Add(e2eTimeout)
+	for {
+		t, err := r.store.GetTicket(r.ticket.ID)
+		if err != nil {
+			return err
+		}
+		r.ticket = t
+		if t.Status == status {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("статус обращения %q, ожидался %q", t.Status, status)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func e2eCreateTicket(r *e2eRun) error {
+	r.userMessage("Не проходит оплата картой")
+
+	topic, err := r.api.Expect("createForumTopic", nil, e2eTimeout)
+	if err != nil {
+		return err
+	}
+	if topic.Params["chat_id"] != strconv.FormatInt(e2eGroupID, 10) {
+		return fmt.Errorf("тема создана в чате %s", topic.Params["chat_id"])
+	}
+
+	card, err := r.expectSend(e2eGroupID, "Не проходит оплата картой")
+	if err != nil {
+		return err
+	}
+	r.card = card.Message
+	if r.card.ThreadID == 0 {
+		return fmt.Errorf("карточка отправлена вне темы")
+	}
+
+	if _, err := r.expectSend(r.user.ID, "#"); err != nil {
+		return err
+	}
+
+	r.ticket, err = r.store.GetOpenUserTicket(r.user.ID)
+	if err != nil {
+		return fmt.Errorf("обращение не сохранено: %v", err)
+	}
+	if r.ticket.ThreadID != r.card.ThreadID {
+		return fmt.Errorf("тема обращения %d, карточка в теме %d", r.ticket.ThreadID, r.card.ThreadID)
+	}
+	return nil
+}
+
+func e2eTakeTicket(r *e2eRun) error {
+	if err := r.pressCardButton("take_btn_"); err != nil {
+		return err
+	}
+	if _, err := r.api.Expect("answerCallbackQuery", nil, e2eTimeout); err != nil {
+		return err
+	}
+	if _, err := r.expectSend(r.user.ID, "@"+r.agent.Username); err != nil {
+		return err
+	}
+	if err := r.refreshTicket("in_progress"); err != nil {
+		return err
+	}
+	if r.ticket.AssigneeID != r.agent.ID {
+		return fmt.Errorf("ответственный %d, ожидался %d", r.ticket.AssigneeID, r.agent.ID)
+	}
+	return nil
+}
+
+func e2eAgentReply(r *e2eRun) error {
+	r.topicMessage("Проверяем платёж, подождите немного")
+	_, err := r.expectSend(r.user.ID, "Проверяем платёж, подождите немного")
+	return err
+}
+
+func e2eUserMessage(r *e2eRun) error {
+	r.userMessage("Спасибо, жду")
+	req, err := r.expectSend(e2eGroupID, "Спасибо, жду")
+	if err != nil {
+		return err
+	}
+	if req.Params["message_thread_id"] != strconv.Itoa(r.ticket.ThreadID) {
+		return fmt.Errorf("сообщение отправлено в тему %s, ожидалась %d", req.Params["message_thread_id"], r.ticket.ThreadID)
+	}
+	return nil
+}
+
+func e2eCloseTicket(r *e2eRun) error {
+	if err := r.pressCardButton("close_btn_"); err != nil {
+		return err
+	}
+	if _, err := r.api.Expect("closeForumTopic", nil, e2eTimeout); err != nil {
+		return err
+	}
+	if _, err := r.expectSend(r.user.ID, fmt.Sprintf("#%d", r.ticket.ID)); err != nil {
+		return err
+	}
+	// Ответ на нажатие — последний запрос обработчика
+	if _, err := r.api.Expect("answerCallbackQuery", nil, e2eTimeout); err != nil {
+		return err
+	}
+	return r.refreshTicket("closed")
+}
+
+func e2eHistory(r *e2eRun) error {
+	messages, err := r.store.GetTicketHistory(r.ticket.ID)
+	if err != nil {
+		return err
+	}
+	want := []string{"Не проходит оплата картой", "Проверяем платёж, подождите немного", "Спасибо, жду"}
+	if len(messages) != len(want) {
+		return fmt.Errorf("в истории %d сообщений, ожидалось %d", len(messages), len(want))
+	}
+	for i, m := range messages {
+		if m.Text != want[i] {
+			return fmt.Errorf("сообщение %d в истории: %q, ожидалось %q", i+1, m.Text, want[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Правки сообщений: когда пользователь или агент редактирует отправленное
+// сообщение, бот обновляет текст в истории, запоминает прежний вариант
+// и правит копию на другой стороне. Если копию изменить нельзя (например,
+// это карточка обращения или стикер), исправленный текст отправляется
+// ответом на неё.
+
+// TicketMessageEdit — правка сообщения из истории переписки.
+type TicketMessageEdit struct {
+	ID        int64  `json:"id"`
+	MessageID int64  `json:"message_id"`
+	OldText   string `json:"old_text"`
+	NewText   string `json:"new_text"`
+	Date      string `json:"date"`
+}
+
+func (s *Service) handleEditedMessage(c telebot.Context) error {
+	m := c.Message()
+	if m.Sender == nil || m.Sender.ID == s.me.ID {
+		return nil
+	}
+
+	var isSupport bool
+	switch {
+	case c.Chat().Type == telebot.ChatPrivate:
+		if s.activeUserBlock(m.Sender.ID) != nil {
+			return nil
+		}
+	case c.Chat().ID == s.cfg.SupportGroupID && m.ThreadID != 0:
+		isSupport = true
+	default:
+		return nil
+	}
+
+	stored, err := s.store.FindTicketMessage(m.Sender.ID, m.ID, isSupport)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Ошибка поиска изменённого сообщения: %v", err)
+		}
+		return nil
+	}
+
+	text := editedText(m, stored)
+	if text == stored.Text {
+		return nil
+	}
+
+	// Ответ, исправленный на "/note …", становится заметкой: клиент
+	// сохраняет прежнюю копию, а новый текст в неё не попадает
+	if isSupport && !stored.IsInternal {
+		if note, ok := parseNote(text); ok {
+			return s.editIntoNote(c, stored.TicketID, note)
+		}
+	}
+
+	err = s.store.EditTicketMessage(TicketMessageEdit{
+		MessageID: stored.ID,
+		OldText:   stored.Text,
+		NewText:   text,
+		Date:      time.Now().Format(DateTimeLayout),
+	})
+	if err != nil {
+		log.Printf("Ошибка сохранения правки сообщения: %v", err)
+		return nil
+	}
+
+	// Заметки клиенту не пересылались, править нечего
+	if stored.IsInternal {
+		return nil
+	}
+
+	ticket, err := s.store.GetTicket(stored.TicketID)
+	if err != nil {
+		log.Printf("Ошибка получения тикета: %v", err)
+		return nil
+	}
+
+	if isSupport {
+		s.mirrorSupportEdit(ticket, m, stored.Text)
+	} else {
+		s.mirrorUserEdit(ticket, m, stored.Text)
+	}
+	return nil
+}
+
+func (s *Service) editIntoNote(c telebot.Context, ticketID int64, text string) error {
+	if text == "" {
+		return s.reply(c, tr(s.supportLanguage(), "note_usage"))
+	}
+
+	ticket, err := s.store.GetTicket(ticketID)
+	if err != nil {
+		log.Printf("Ошибка получения тикета: %v", err)
+		return nil
+	}
+	return s.saveInternalNote(c, ticket, text)
+}
+
+// editedText возвращает новый текст сообщения в том виде, в каком он
+// хранится в истории.
+func editedText(m *telebot.Message, stored *TicketMessage) string {
+	text := m.Text
+	if stored.MediaType != "" {
+		text = m.Caption
+	}
+	if stored.IsInternal {
+		if note, ok := parseNote(text); ok {
+			return note
+		}
+	}
+	return text
+}
+
+// mirroredText возвращает новый текст копии сообщения m. Если при пересылке
+// заголовок header ушёл отдельным сообщением (стикер, кружок, длинная
+// подпись или текст, см. headerSeparate и splitLongText), копия содержит
+// только само сообщение, без заголовка. oldBody — текст сообщения
+// до правки, с ним оно и пересылалось.
+func mirroredText(header string, m *telebot.Message, oldBody string) string {
+	if mediaType, _ := messageMedia(m); mediaType != "" {
+		if headerSeparate(mediaType, header+oldBody) {
+			return m.Caption
+		}
+		return header + m.Caption
+	}
+	if _, rest := splitLongText(header + oldBody); rest != "" {
+		return m.Text
+	}
+	return header + m.Text
+}
+
+func (s *Service) mirrorUserEdit(t *Ticket, m *telebot.Message, oldBody string) {
+	l, err := s.store.GetMessageLinkByUserMessage(t.ID, m.ID)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Ошибка поиска связи сообщений: %v", err)
+		}
+		return
+	}
+
+	lang := s.supportLanguage()
+	header := tr(lang, "new_message_header", t.ID, m.Sender.FirstName, m.Sender.LastName, m.Sender.Username, m.Sender.ID)
+	text := mirroredText(header, m, oldBody)
+
+	// Карточку обращения не переписываем: на ней кнопки и сводка
+	if l.TopicMessageID == t.CardMessageID || s.editMirroredMessage(s.cfg.SupportGroupID, l.TopicMessageID, m, text) != nil {
+		s.sendEditNotice(telebot.ChatID(s.cfg.SupportGroupID), t.ThreadID, l.TopicMessageID, tr(lang, "edited_by_user", messageBody(m)))
+	}
+}
+
+func (s *Service) mirrorSupportEdit(t *Ticket, m *telebot.Message, oldBody string) {
+	l, err := s.store.GetMessageLinkByTopicMessage(t.ID, m.ID)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Ошибка поиска связи сообщений: %v", err)
+		}
+		return
+	}
+
+	lang := s.languageOf(t.UserID)
+	text := mirroredText(tr(lang, "reply_header", t.ID), m, oldBody)
+
+	if s.editMirroredMessage(t.UserID, l.UserMessageID, m, text) != nil {
+		s.sendEditNotice(telebot.ChatID(t.UserID), 0, l.UserMessageID, tr(lang, "edited_by_support", messageBody(m)))
+	}
+}
+
+// messageBody — текст или подпись сообщения.
+func messageBody(m *telebot.Message) string {
+	if mediaType, _ := messageMedia(m); mediaType != "" {
+		return m.Caption
+	}
+	return m.Text
+}
+
+func (s *Service) editMirroredMessage(chatID int64, messageID int, m *telebot.Message, text string) error {
+	copied := &telebot.StoredMessage{MessageID: strconv.Itoa(messageID), ChatID: chatID}
+
+	var err error
+	if mediaType, _ := messageMedia(m); mediaType != "" {
+		_, err = s.bot.EditCaption(copied, text)
+	} else {
+		_, err = s.bot.Edit(copied, text)
+	}
+	if err != nil && !errors.Is(err, telebot.ErrSameMessageContent) && !errors.Is(err, telebot.ErrMessageNotModified) {
+		log.Printf("Ошибка изменения копии сообщения: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *Service) sendEditNotice(to telebot.Recipient, threadID, replyTo int, text string) {
+	_, err := s.bot.Send(to, text, &telebot.SendOptions{
+		ThreadID:          threadID,
+		ReplyTo:           &telebot.Message{ID: replyTo},
+		AllowWithoutReply: true,
+	})
+	if err != nil {
+		log.Printf("Ошибка отправки уведомления о правке: %v", err)
+	}
+}
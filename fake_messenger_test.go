@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// FakeMessenger — Messenger без сети для тестов обработчиков. Он
+// записывает каждый вызов, выдаёт отправленным сообщениям возрастающие ID
+// и отвечает на вызовы Raw так, как ответила бы группа-форум.
+type FakeMessenger struct {
+	mu           sync.Mutex
+	calls        []FakeCall
+	lastMessage  int
+	lastThreadID int
+
+	// Chats отвечает на ChatByID; неизвестные чаты считаются супергруппами
+	Chats map[int64]*telebot.Chat
+	// Member отвечает на ChatMemberOf; по умолчанию бот — администратор
+	// с правом управлять темами
+	Member *telebot.ChatMember
+	// RawResults подменяет ответ Raw для метода
+	RawResults map[string][]byte
+	// Errors заставляет метод (Send, Edit, Raw:createForumTopic…) вернуть ошибку
+	Errors map[string]error
+}
+
+// FakeCall — запись об одном вызове FakeMessenger.
+type FakeCall struct {
+	Method  string
+	To      string
+	What    interface{}
+	Options []interface{}
+	// Message — сообщение, которое вернул вызов, если оно было
+	Message *telebot.Message
+}
+
+// SendOptions возвращает параметры отправки вызова, собранные из опций
+// так же, как их собирает telebot.
+func (c FakeCall) SendOptions() *telebot.SendOptions {
+	return sendOptionsOf(c.Options)
+}
+
+func sendOptionsOf(opts []interface{}) *telebot.SendOptions {
+	sendOpts := &telebot.SendOptions{}
+	for _, o := range opts {
+		switch o := o.(type) {
+		case *telebot.SendOptions:
+			if o != nil {
+				copied := *o
+				sendOpts = &copied
+			}
+		case *telebot.ReplyMarkup:
+			sendOpts.ReplyMarkup = o
+		case telebot.ParseMode:
+			sendOpts.ParseMode = o
+		}
+	}
+	return sendOpts
+}
+
+// Text возвращает отправленный текст, подпись документа или текст ответа
+// на нажатие кнопки.
+func (c FakeCall) Text() string {
+	switch w := c.What.(type) {
+	case string:
+		return w
+	case *telebot.Document:
+		return w.Caption
+	case *telebot.CallbackResponse:
+		return w.Text
+	}
+	return ""
+}
+
+// NewFakeMessenger создаёт FakeMessenger с ответами по умолчанию.
+func NewFakeMessenger() *FakeMessenger {
+	return &FakeMessenger{
+		Chats:      map[int64]*telebot.Chat{},
+		RawResults: map[string][]byte{},
+		Errors:     map[string]error{},
+		Member: &telebot.ChatMember{
+			Role: telebot.Administrator,
+			Rights: telebot.Rights{
+				CanManageTopics: true,
+				CanPinMessages:  true,
+			},
+		},
+	}
+}
+
+var _ Messenger = (*FakeMessenger)(nil)
+
+// Calls возвращает копию записанных вызовов, method фильтрует их по имени.
+func (f *FakeMessenger) Calls(method string) []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var calls []FakeCall
+	for _, c := range f.calls {
+		if method == "" || c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset забывает записанные вызовы.
+func (f *FakeMessenger) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+}
+
+func (f *FakeMessenger) record(method, to string, what interface{}, opts []interface{}) (*telebot.Message, error) {
+	if err := f.Errors[method]; err != nil {
+		f.calls = append(f.calls, FakeCall{Method: method, To: to, What: what, Options: opts})
+		return nil, err
+	}
+
+	f.lastMessage++
+	chatID, _ := strconv.ParseInt(to, 10, 64)
+	m := &telebot.Message{
+		ID:       f.lastMessage,
+		Chat:     &telebot.Chat{ID: chatID},
+		Unixtime: time.Now().Unix(),
+	}
+	if text, ok := what.(string); ok {
+		m.Text = text
+	}
+	sendOpts := sendOptionsOf(opts)
+	m.ThreadID = sendOpts.ThreadID
+	m.ReplyTo = sendOpts.ReplyTo
+	m.ReplyMarkup = sendOpts.ReplyMarkup
+	f.calls = append(f.calls, FakeCall{Method: method, To: to, What: what, Options: opts, Message: m})
+	return m, nil
+}
+
+func (f *FakeMessenger) Send(to telebot.Recipient, what interface{}, opts ...interface{}) (*telebot.Message, error) {
+	if to == nil {
+		return nil, telebot.ErrBadRecipient
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.record("Send", to.Recipient(), what, opts)
+}
+
+// Reply записывается как Send в чат сообщения to с ReplyTo.
+func (f *FakeMessenger) Reply(to *telebot.Message, what interface{}, opts ...interface{}) (*telebot.Message, error) {
+	sendOpts := sendOptionsOf(opts)
+	sendOpts.ReplyTo = to
+	return f.Send(to.Chat, what, sendOpts)
+}
+
+// Respond записывает ответ на нажатие кнопки; What — *telebot.CallbackResponse.
+func (f *FakeMessenger) Respond(c *telebot.Callback, resp ...*telebot.CallbackResponse) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r := &telebot.CallbackResponse{}
+	if len(resp) > 0 && resp[0] != nil {
+		r = resp[0]
+	}
+	f.calls = append(f.calls, FakeCall{Method: "Respond", To: c.Sender.Recipient(), What: r})
+	return f.Errors["Respond"]
+}
+
+func (f *FakeMessenger) Edit(msg telebot.Editable, what interface{}, opts ...interface{}) (*telebot.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.edit("Edit", msg, what, opts)
+}
+
+func (f *FakeMessenger) EditCaption(msg telebot.Editable, caption string, opts ...interface{}) (*telebot.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.edit("EditCaption", msg, caption, opts)
+}
+
+// edit записывает правку; возвращённое сообщение сохраняет ID исходного.
+func (f *FakeMessenger) edit(method string, msg telebot.Editable, what interface{}, opts []interface{}) (*telebot.Message, error) {
+	messageID, chatID := msg.MessageSig()
+	id, _ := strconv.Atoi(messageID)
+
+	call := FakeCall{Method: method, To: strconv.FormatInt(chatID, 10), What: what, Options: opts}
+	if err := f.Errors[method]; err != nil {
+		f.calls = append(f.calls, call)
+		return nil, err
+	}
+	call.Message = &telebot.Message{ID: id, Chat: &telebot.Chat{ID: chatID}}
+	if text, ok := what.(string); ok {
+		call.Message.Text = text
+	}
+	f.calls = append(f.calls, call)
+	return call.Message, nil
+}
+
+func (f *FakeMessenger) Raw(method string, payload interface{}) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var to string
+	if params, ok := payload.(map[string]interface{}); ok {
+		if chatID, ok := params["chat_id"]; ok {
+			to = toString(chatID)
+		}
+	}
+	f.calls = append(f.calls, FakeCall{Method: "Raw:" + method, To: to, What: payload})
+
+	if err := f.Errors["Raw:"+method]; err != nil {
+		return nil, err
+	}
+	if resp, ok := f.RawResults[method]; ok {
+		return resp, nil
+	}
+
+	var result interface{} = true
+	switch method {
+	case "createForumTopic":
+		f.lastThreadID++
+		result = map[string]interface{}{"message_thread_id": f.lastThreadID}
+	case "getChat":
+		result = map[string]interface{}{"is_forum": true}
+	}
+	return json.Marshal(map[string]interface{}{"ok": true, "result": result})
+}
+
+func (f *FakeMessenger) ChatByID(id int64) (*telebot.Chat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, FakeCall{Method: "ChatByID", To: strconv.FormatInt(id, 10)})
+	if err := f.Errors["ChatByID"]; err != nil {
+		return nil, err
+	}
+	if chat, ok := f.Chats[id]; ok {
+		return chat, nil
+	}
+	return &telebot.Chat{ID: id, Type: telebot.ChatSuperGroup, Title: "support"}, nil
+}
+
+func (f *FakeMessenger) ChatMemberOf(chat, user telebot.Recipient) (*telebot.ChatMember, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, FakeCall{Method: "ChatMemberOf", To: chat.Recipient(), What: user.Recipient()})
+	if err := f.Errors["ChatMemberOf"]; err != nil {
+		return nil, err
+	}
+	return f.Member, nil
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// FakeContext — telebot.Context для вызова обработчиков напрямую.
+// Обработчики отвечают через Messenger, поэтому контекст только описывает
+// обновление. Методы, которыми обработчики не пользуются, не реализованы
+// и паникуют.
+type FakeContext struct {
+	telebot.Context
+
+	message  *telebot.Message
+	callback *telebot.Callback
+}
+
+var _ telebot.Context = (*FakeContext)(nil)
+
+// NewFakeMessageContext — контекст входящего сообщения m.
+func NewFakeMessageContext(m *telebot.Message) *FakeContext {
+	return &FakeContext{message: m}
+}
+
+// NewFakeCallbackContext — контекст нажатия кнопки с данными data под
+// сообщением m.
+func NewFakeCallbackContext(from *telebot.User, m *telebot.Message, data string) *FakeContext {
+	return &FakeContext{
+		message: m,
+		callback: &telebot.Callback{
+			ID:      strconv.FormatInt(time.Now().UnixNano(), 10),
+			Sender:  from,
+			Message: m,
+			Data:    data,
+		},
+	}
+}
+
+func (c *FakeContext) Message() *telebot.Message {
+	return c.message
+}
+
+func (c *FakeContext) Callback() *telebot.Callback {
+	return c.callback
+}
+
+func (c *FakeContext) Sender() *telebot.User {
+	if c.callback != nil {
+		return c.callback.Sender
+	}
+	if c.message != nil {
+		return c.message.Sender
+	}
+	return nil
+}
+
+func (c *FakeContext) Chat() *telebot.Chat {
+	if c.message != nil {
+		return c.message.Chat
+	}
+	return nil
+}
+
+func (c *FakeContext) Recipient() telebot.Recipient {
+	if chat := c.Chat(); chat != nil {
+		return chat
+	}
+	return c.Sender()
+}
+
+func (c *FakeContext) Text() string {
+	if c.message == nil {
+		return ""
+	}
+	if c.message.Caption != "" {
+		return c.message.Caption
+	}
+	return c.message.Text
+}
+
+func (c *FakeContext) Data() string {
+	if c.callback != nil {
+		return c.callback.Data
+	}
+	return ""
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// FakeBotAPI — HTTP-сервер в том же процессе, который отвечает на методы
+// Bot API вместо api.telegram.org. Обновления для бота задаются сценарием
+// (PushMessage, PressButton), а все запросы бота записываются, чтобы
+// сценарий мог дождаться нужного (Expect). Группа supportGroupID считается
+// форумом, где бот — администратор с правом управлять темами.
+type FakeBotAPI struct {
+	Token string
+	Me    telebot.User
+
+	server         *httptest.Server
+	supportGroupID int64
+
+	mu           sync.Mutex
+	changed      chan struct{}
+	updates      []telebot.Update
+	lastUpdateID int
+	delivered    int
+	lastMessage  int
+	lastThreadID int
+	requests     []FakeAPIRequest
+}
+
+// FakeAPIRequest — запрос бота к FakeBotAPI.
+type FakeAPIRequest struct {
+	Method string
+	// Params — параметры запроса; вложенные объекты остаются строками JSON
+	Params map[string]string
+	// Files — содержимое загруженных файлов по имени параметра
+	Files map[string][]byte
+	// Message — сообщение, созданное запросом отправки или правки
+	Message *telebot.Message
+
+	consumed bool
+}
+
+// NewFakeBotAPI запускает сервер. Его нужно остановить через Close.
+func NewFakeBotAPI(supportGroupID int64) *FakeBotAPI {
+	api := &FakeBotAPI{
+		Token:          "123456789:fake-token-for-local-bot-api-server",
+		Me:             telebot.User{ID: 123456789, IsBot: true, FirstName: "Support", Username: "support_test_bot"},
+		supportGroupID: supportGroupID,
+		changed:        make(chan struct{}),
+	}
+	api.server = httptest.NewServer(http.HandlerFunc(api.serveHTTP))
+	return api
+}
+
+// URL — адрес для Settings.URL (или api_url в конфигурации).
+func (api *FakeBotAPI) URL() string {
+	return api.server.URL
+}
+
+func (api *FakeBotAPI) Close() {
+	api.server.Close()
+}
+
+// notify будит ожидающих getUpdates и Expect. Вызывается под api.mu.
+func (api *FakeBotAPI) notify() {
+	close(api.changed)
+	api.changed = make(chan struct{})
+}
+
+// PushMessage ставит в очередь входящее сообщение. ID и дата
+// заполняются, если не заданы.
+func (api *FakeBotAPI) PushMessage(m *telebot.Message) *telebot.Message {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	if m.ID == 0 {
+		api.lastMessage++
+		m.ID = api.lastMessage
+	}
+	if m.Unixtime == 0 {
+		m.Unixtime = time.Now().Unix()
+	}
+	if m.ThreadID != 0 {
+		m.TopicMessage = true
+	}
+	api.pushUpdate(telebot.Update{Message: m})
+	return m
+}
+
+// PressButton ставит в очередь нажатие кнопки с данными data под
+// сообщением m от пользователя from.
+func (api *FakeBotAPI) PressButton(from *telebot.User, m *telebot.Message, data string) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.pushUpdate(telebot.Update{Callback: &telebot.Callback{
+		ID:      strconv.Itoa(api.lastUpdateID + 1),
+		Sender:  from,
+		Message: m,
+		Data:    data,
+	}})
+}
+
+func (api *FakeBotAPI) pushUpdate(u telebot.Update) {
+	api.lastUpdateID++
+	u.ID = api.lastUpdateID
+	api.updates = append(api.updates, u)
+	api.notify()
+}
+
+// Requests возвращает записанные запросы метода method (все, если пусто).
+func (api *FakeBotAPI) Requests(method string) []FakeAPIRequest {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	var reqs []FakeAPIRequest
+	for _, r := range api.requests {
+		if method == "" || r.Method == method {
+			reqs = append(reqs, r)
+		}
+	}
+	return reqs
+}
+
+// Expect ждёт запрос метода method, подходящий под match (nil — любой),
+// который ещё не был получен через Expect.
+func (api *FakeBotAPI) Expect(method string, match func(FakeAPIRequest) bool, timeout time.Duration) (FakeAPIRequest, error) {
+	deadline := time.After(timeout)
+	for {
+		api.mu.Lock()
+		for i := range api.requests {
+			r := &api.requests[i]
+			if r.consumed || r.Method != method || (match != nil && !match(*r)) {
+				continue
+			}
+			r.consumed = true
+			api.mu.Unlock()
+			return *r, nil
+		}
+		changed := api.changed
+		api.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return FakeAPIRequest{}, fmt.Errorf("не дождались запроса %s за %s", method, timeout)
+		}
+	}
+}
+
+// WaitDelivered ждёт, пока бот получит все поставленные в очередь обновления.
+func (api *FakeBotAPI) WaitDelivered(timeout time.Duration) error {
+	deadline := time.After(timeout)
+	for {
+		api.mu.Lock()
+		done := api.delivered >= api.lastUpdateID
+		changed := api.changed
+		api.mu.Unlock()
+		if done {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return fmt.Errorf("бот не получил обновления за %s", timeout)
+		}
+	}
+}
+
+func (api *FakeBotAPI) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	method, ok := strings.CutPrefix(r.URL.Path, "/bot"+api.Token+"/")
+	if !ok {
+		writeAPIError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	req, err := parseAPIRequest(method, r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return
+	}
+
+	if method == "getUpdates" {
+		api.serveUpdates(w, r, req)
+		return
+	}
+
+	api.mu.Lock()
+	result, err := api.handle(&req)
+	api.mu.Unlock()
+
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+	} else {
+		writeAPIResult(w, result)
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	// Запрос виден Expect только после ответа, чтобы сценарий не завершился
+	// раньше, чем бот его получит
+	api.mu.Lock()
+	api.requests = append(api.requests, req)
+	api.notify()
+	api.mu.Unlock()
+}
+
+// serveUpdates отвечает на long polling: ждёт обновлений с offset
+// не дольше timeout запроса.
+func (api *FakeBotAPI) serveUpdates(w http.ResponseWriter, r *http.Request, req FakeAPIRequest) {
+	offset, _ := strconv.Atoi(req.Params["offset"])
+	timeout, _ := strconv.Atoi(req.Params["timeout"])
+	deadline := time.After(time.Duration(timeout) * time.Second)
+
+	for {
+		api.mu.Lock()
+		var pending []telebot.Update
+		for _, u := range api.updates {
+			if u.ID >= offset {
+				pending = append(pending, u)
+			}
+		}
+		// Подтверждённые обновления больше не нужны
+		api.updates = pending
+		changed := api.changed
+		api.mu.Unlock()
+
+		if len(pending) > 0 {
+			writeAPIResult(w, pending)
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+			api.mu.Lock()
+			api.delivered = max(api.delivered, pending[len(pending)-1].ID)
+			api.notify()
+			api.mu.Unlock()
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			writeAPIResult(w, []telebot.Update{})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handle отвечает на метод Bot API. Вызывается под api.mu.
+func (api *FakeBotAPI) handle(req *FakeAPIRequest) (interface{}, error) {
+	p := req.Params
+	switch req.Method {
+	case "getMe":
+		return api.Me, nil
+	case "deleteWebhook", "setWebhook", "answerCallbackQuery", "pinChatMessage",
+		"editForumTopic", "closeForumTopic", "reopenForumTopic", "deleteForumTopic":
+		return true, nil
+	case "getChat":
+		chat, err := api.chat(p["chat_id"])
+		if err != nil {
+			return nil, err
+		}
+		// В telebot.Chat нет поля is_forum, а бот проверяет именно его
+		return map[string]interface{}{
+			"id":       chat.ID,
+			"type":     chat.Type,
+			"title":    chat.Title,
+			"is_forum": chat.ID == api.supportGroupID,
+		}, nil
+	case "getChatMember":
+		if _, err := api.chat(p["chat_id"]); err != nil {
+			return nil, err
+		}
+		return telebot.ChatMember{
+			User:   &api.Me,
+			Role:   telebot.Administrator,
+			Rights: telebot.Rights{CanManageTopics: true, CanPinMessages: true},
+		}, nil
+	case "createForumTopic":
+		if _, err := api.chat(p["chat_id"]); err != nil {
+			return nil, err
+		}
+		api.lastThreadID++
+		return map[string]interface{}{"message_thread_id": api.lastThreadID, "name": p["name"]}, nil
+	case "sendMessage", "sendPhoto", "sendVideo", "sendDocument", "sendAudio",
+		"sendVoice", "sendAnimation", "sendSticker", "sendVideoNote":
+		chat, err := api.chat(p["chat_id"])
+		if err != nil {
+			return nil, err
+		}
+		api.lastMessage++
+		m := &telebot.Message{
+			ID:       api.lastMessage,
+			Sender:   &api.Me,
+			Chat:     chat,
+			Unixtime: time.Now().Unix(),
+			Text:     p["text"],
+			Caption:  p["caption"],
+		}
+		if err := api.fillMessage(m, p); err != nil {
+			return nil, err
+		}
+		req.Message = m
+		return m, nil
+	case "editMessageText", "editMessageCaption":
+		chat, err := api.chat(p["chat_id"])
+		if err != nil {
+			return nil, err
+		}
+		id, _ := strconv.Atoi(p["message_id"])
+		m := &telebot.Message{ID: id, Sender: &api.Me, Chat: chat, Text: p["text"], Caption: p["caption"]}
+		if err := api.fillMessage(m, p); err != nil {
+			return nil, err
+		}
+		req.Message = m
+		return m, nil
+	}
+	return nil, fmt.Errorf("метод %s не поддерживается", req.Method)
+}
+
+func (api *FakeBotAPI) fillMessage(m *telebot.Message, p map[string]string) error {
+	m.ThreadID, _ = strconv.Atoi(p["message_thread_id"])
+	m.TopicMessage = m.ThreadID != 0
+	if id, _ := strconv.Atoi(p["reply_to_message_id"]); id != 0 {
+		m.ReplyTo = &telebot.Message{ID: id, Chat: m.Chat}
+	}
+	if markup := p["reply_markup"]; markup != "" {
+		m.ReplyMarkup = &telebot.ReplyMarkup{}
+		if err := json.Unmarshal([]byte(markup), m.ReplyMarkup); err != nil {
+			return fmt.Errorf("reply_markup: %v", err)
+		}
+	}
+	return nil
+}
+
+// chat возвращает чат по chat_id: группа поддержки или личный чат.
+func (api *FakeBotAPI) chat(rawID string) (*telebot.Chat, error) {
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("chat_id: %q не является числом", rawID)
+	case id == api.supportGroupID:
+		return &telebot.Chat{ID: id, Type: telebot.ChatSuperGroup, Title: "Support"}, nil
+	case id > 0:
+		return &telebot.Chat{ID: id, Type: telebot.ChatPrivate}, nil
+	}
+	return nil, fmt.Errorf("chat not found")
+}
+
+func parseAPIRequest(method string, r *http.Request) (FakeAPIRequest, error) {
+	req := FakeAPIRequest{Method: method, Params: map[string]string{}}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return req, err
+		}
+		for k, v := range r.MultipartForm.Value {
+			req.Params[k] = v[0]
+		}
+		req.Files = map[string][]byte{}
+		for k, headers := range r.MultipartForm.File {
+			f, err := headers[0].Open()
+			if err != nil {
+				return req, err
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return req, err
+			}
+			req.Files[k] = data
+			req.Params[k] = headers[0].Filename
+		}
+		return req, nil
+	}
+
+	var params map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && err != io.EOF {
+		return req, err
+	}
+	for k, v := range params {
+		if s, ok := v.(string); ok {
+			req.Params[k] = s
+			continue
+		}
+		data, _ := json.Marshal(v)
+		req.Params[k] = string(data)
+	}
+	return req, nil
+}
+
+func writeAPIResult(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+func writeAPIError(w http.ResponseWriter, code int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error_code": code, "description": description})
+}
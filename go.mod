@@ -3,6 +3,7 @@ module my-telegram-bot
 go 1.24
 
 require (
+	github.com/lib/pq v1.10.9
 	gopkg.in/telebot.v3 v3.3.8
 	modernc.org/sqlite v1.38.0
 )
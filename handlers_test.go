@@ -0,0 +1,547 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gopkg.in/telebot.v3"
+)
+
+const testGroupID = -1001000000001
+
+// handlerEnv — сервис поверх FakeMessenger и временной SQLite-базы.
+type handlerEnv struct {
+	bot   *FakeMessenger
+	store Store
+	svc   *Service
+	user  *telebot.User
+	agent *telebot.User
+}
+
+func newHandlerEnv(t *testing.T) *handlerEnv {
+	t.Helper()
+
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "support.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	cfg := defaultConfig()
+	cfg.SupportGroupID = testGroupID
+	cfg.SupportGroupLink = "https://t.me/+support"
+
+	bot := NewFakeMessenger()
+	me := &telebot.User{ID: 42, IsBot: true, FirstName: "Support", Username: "support_bot"}
+	return &handlerEnv{
+		bot:   bot,
+		store: store,
+		svc:   NewService(bot, me, store, &cfg),
+		user:  &telebot.User{ID: 1001, FirstName: "Иван", Username: "ivan", LanguageCode: "ru"},
+		agent: &telebot.User{ID: 2002, FirstName: "Анна", Username: "anna"},
+	}
+}
+
+var lastTestMessageID = 10000
+
+func (e *handlerEnv) userMessage(t *testing.T, text string) {
+	t.Helper()
+	lastTestMessageID++
+	m := &telebot.Message{
+		ID:     lastTestMessageID,
+		Sender: e.user,
+		Chat:   &telebot.Chat{ID: e.user.ID, Type: telebot.ChatPrivate},
+		Text:   text,
+	}
+	if err := e.svc.handleTextMessages(NewFakeMessageContext(m)); err != nil {
+		t.Fatalf("сообщение пользователя %q: %v", text, err)
+	}
+}
+
+func (e *handlerEnv) topicMessage(t *testing.T, threadID int, text string) {
+	t.Helper()
+	lastTestMessageID++
+	m := &telebot.Message{
+		ID:       lastTestMessageID,
+		Sender:   e.agent,
+		Chat:     &telebot.Chat{ID: testGroupID, Type: telebot.ChatSuperGroup},
+		ThreadID: threadID,
+		Text:     text,
+	}
+	if err := e.svc.handleTextMessages(NewFakeMessageContext(m)); err != nil {
+		t.Fatalf("сообщение в теме %q: %v", text, err)
+	}
+}
+
+// press нажимает от имени from кнопку с данными data под сообщением m.
+func (e *handlerEnv) press(t *testing.T, from *telebot.User, m *telebot.Message, data string) {
+	t.Helper()
+	if err := e.svc.handleCallbacks(NewFakeCallbackContext(from, m, "\f"+data)); err != nil {
+		t.Fatalf("кнопка %s: %v", data, err)
+	}
+}
+
+// createTicket создаёт обращение первым сообщением пользователя и
+// возвращает его вместе с карточкой в теме.
+func (e *handlerEnv) createTicket(t *testing.T) (*Ticket, *telebot.Message) {
+	t.Helper()
+	e.userMessage(t, "Не проходит оплата картой")
+
+	ticket, err := e.store.GetOpenUserTicket(e.user.ID)
+	if err != nil {
+		t.Fatalf("обращение не сохранено: %v", err)
+	}
+	for _, c := range e.sent(testGroupID) {
+		if c.SendOptions().ReplyMarkup != nil {
+			return ticket, c.Message
+		}
+	}
+	t.Fatalf("карточка обращения не отправлена")
+	return nil, nil
+}
+
+// sent возвращает отправленные в чат chatID сообщения.
+func (e *handlerEnv) sent(chatID int64) []FakeCall {
+	var calls []FakeCall
+	for _, c := range e.bot.Calls("Send") {
+		if c.To == strconv.FormatInt(chatID, 10) {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// expectSent проверяет, что в чат chatID ушло сообщение с want в тексте.
+func (e *handlerEnv) expectSent(t *testing.T, chatID int64, want string) FakeCall {
+	t.Helper()
+	var texts []string
+	for _, c := range e.sent(chatID) {
+		if strings.Contains(c.Text(), want) {
+			return c
+		}
+		texts = append(texts, c.Text())
+	}
+	t.Fatalf("в чат %d не отправлено %q, отправлено: %q", chatID, want, texts)
+	return FakeCall{}
+}
+
+// expectResponse проверяет ответ на последнее нажатие кнопки.
+func (e *handlerEnv) expectResponse(t *testing.T, want string) {
+	t.Helper()
+	calls := e.bot.Calls("Respond")
+	if len(calls) == 0 {
+		t.Fatalf("нажатие осталось без ответа")
+	}
+	if got := calls[len(calls)-1].Text(); got != want {
+		t.Fatalf("ответ на нажатие %q, ожидался %q", got, want)
+	}
+}
+
+func (e *handlerEnv) ticket(t *testing.T, id int64) *Ticket {
+	t.Helper()
+	ticket, err := e.store.GetTicket(id)
+	if err != nil {
+		t.Fatalf("GetTicket(%d): %v", id, err)
+	}
+	return ticket
+}
+
+func TestHandlers(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, e *handlerEnv)
+	}{
+		{"создание обращения", func(t *testing.T, e *handlerEnv) {
+			ticket, card := e.createTicket(t)
+
+			if n := len(e.bot.Calls("Raw:createForumTopic")); n != 1 {
+				t.Fatalf("создано тем: %d", n)
+			}
+			if ticket.ThreadID == 0 || card.ThreadID != ticket.ThreadID {
+				t.Fatalf("тема обращения %d, карточка в теме %d", ticket.ThreadID, card.ThreadID)
+			}
+			if ticket.Status != "open" || ticket.Priority != PriorityNormal {
+				t.Fatalf("новое обращение: статус %q, приоритет %q", ticket.Status, ticket.Priority)
+			}
+			created := e.expectSent(t, e.user.ID, tr("ru", "ticket_created", ticket.ID, e.svc.cfg.SupportGroupLink))
+			if created.SendOptions().ReplyMarkup == nil {
+				t.Fatalf("у сообщения о создании нет кнопок срочности")
+			}
+		}},
+		{"сообщение пользователя в тему", func(t *testing.T, e *handlerEnv) {
+			ticket, _ := e.createTicket(t)
+			e.bot.Reset()
+
+			e.userMessage(t, "Спасибо, жду")
+
+			relay := e.expectSent(t, testGroupID, "Спасибо, жду")
+			if got := relay.SendOptions().ThreadID; got != ticket.ThreadID {
+				t.Fatalf("сообщение отправлено в тему %d, ожидалась %d", got, ticket.ThreadID)
+			}
+			e.expectSent(t, e.user.ID, tr("ru", "message_added", ticket.ID))
+			if n := len(e.bot.Calls("Raw:createForumTopic")); n != 0 {
+				t.Fatalf("для второго сообщения создана новая тема")
+			}
+		}},
+		{"ответ поддержки пользователю", func(t *testing.T, e *handlerEnv) {
+			ticket, _ := e.createTicket(t)
+			e.bot.Reset()
+
+			e.topicMessage(t, ticket.ThreadID, "Проверяем платёж")
+
+			e.expectSent(t, e.user.ID, tr("ru", "reply_header", ticket.ID)+"Проверяем платёж")
+			history, err := e.store.GetTicketHistory(ticket.ID)
+			if err != nil {
+				t.Fatalf("GetTicketHistory: %v", err)
+			}
+			last := history[len(history)-1]
+			if !last.IsSupport || last.Text != "Проверяем платёж" {
+				t.Fatalf("ответ не записан в историю: %+v", last)
+			}
+		}},
+		{"взятие в работу", func(t *testing.T, e *handlerEnv) {
+			ticket, card := e.createTicket(t)
+			e.bot.Reset()
+
+			e.press(t, e.agent, card, "take_btn_"+strconv.FormatInt(ticket.ID, 10))
+
+			e.expectResponse(t, tr(e.svc.supportLanguage(), "taken_cb"))
+			ticket = e.ticket(t, ticket.ID)
+			if ticket.Status != "in_progress" || ticket.AssigneeID != e.agent.ID {
+				t.Fatalf("статус %q, ответственный %d", ticket.Status, ticket.AssigneeID)
+			}
+			e.expectSent(t, e.user.ID, tr("ru", "user_assigned_take", ticket.ID, displayName(e.agent)))
+			if n := len(e.bot.Calls("Edit")); n == 0 {
+				t.Fatalf("карточка не обновлена")
+			}
+		}},
+		{"закрытие обращения", func(t *testing.T, e *handlerEnv) {
+			ticket, card := e.createTicket(t)
+			e.bot.Reset()
+
+			e.press(t, e.agent, card, "close_btn_"+strconv.FormatInt(ticket.ID, 10))
+
+			e.expectResponse(t, tr(e.svc.supportLanguage(), "ticket_closed_cb"))
+			ticket = e.ticket(t, ticket.ID)
+			if ticket.Status != "closed" || ticket.ClosedAt == "" {
+				t.Fatalf("статус %q, закрыто %q", ticket.Status, ticket.ClosedAt)
+			}
+			e.expectSent(t, e.user.ID, tr("ru", "closed_by_support", ticket.ID))
+			survey := e.expectSent(t, e.user.ID, tr("ru", "csat_survey", ticket.ID))
+			if survey.SendOptions().ReplyMarkup == nil {
+				t.Fatalf("у опроса нет кнопок оценки")
+			}
+			if n := len(e.bot.Calls("Raw:closeForumTopic")); n != 1 {
+				t.Fatalf("тема закрыта %d раз", n)
+			}
+
+			// Повторное нажатие не меняет закрытое обращение
+			e.press(t, e.agent, card, "close_btn_"+strconv.FormatInt(ticket.ID, 10))
+			e.expectResponse(t, tr(e.svc.supportLanguage(), "ticket_is_closed"))
+		}},
+		{"внутренние заметки", func(t *testing.T, e *handlerEnv) {
+			ticket, _ := e.createTicket(t)
+			e.topicMessage(t, ticket.ThreadID, "Проверяем платёж")
+			e.bot.Reset()
+
+			topicMsg := func(text, caption string) *telebot.Message {
+				lastTestMessageID++
+				m := &telebot.Message{
+					ID:       lastTestMessageID,
+					Sender:   e.agent,
+					Chat:     &telebot.Chat{ID: testGroupID, Type: telebot.ChatSuperGroup},
+					ThreadID: ticket.ThreadID,
+					Text:     text,
+					Caption:  caption,
+				}
+				if caption != "" {
+					m.Photo = &telebot.Photo{File: telebot.File{FileID: "photo-1"}}
+				}
+				return m
+			}
+
+			// Подпись с переводом строки сразу после команды
+			photo := topicMsg("", "/note\nкарта клиента поддельная")
+			if err := e.svc.handleMediaMessages(NewFakeMessageContext(photo)); err != nil {
+				t.Fatalf("заметка с вложением: %v", err)
+			}
+
+			// Payload у telebot заканчивается на первой строке
+			cmd := topicMsg("/note первая строка\nвторая строка", "")
+			cmd.Payload = "первая строка"
+			if err := e.svc.handleNoteCommand(NewFakeMessageContext(cmd)); err != nil {
+				t.Fatalf("/note: %v", err)
+			}
+
+			// Ответ, исправленный на заметку, клиенту не отправляется
+			history, err := e.store.GetTicketHistory(ticket.ID)
+			if err != nil {
+				t.Fatalf("GetTicketHistory: %v", err)
+			}
+			var reply *telebot.Message
+			for _, m := range history {
+				if m.Text == "Проверяем платёж" {
+					reply = topicMsg("/note\nпроверить позже", "")
+					reply.ID = m.MessageID
+				}
+			}
+			if reply == nil {
+				t.Fatalf("ответ поддержки не найден в истории")
+			}
+			if err := e.svc.handleEditedMessage(NewFakeMessageContext(reply)); err != nil {
+				t.Fatalf("правка ответа: %v", err)
+			}
+
+			if sent := e.sent(e.user.ID); len(sent) != 0 {
+				t.Fatalf("клиенту отправлено %d сообщений", len(sent))
+			}
+			for _, method := range []string{"Edit", "EditCaption"} {
+				if n := len(e.bot.Calls(method)); n != 0 {
+					t.Fatalf("%s вызван %d раз", method, n)
+				}
+			}
+
+			history, err = e.store.GetTicketHistory(ticket.ID)
+			if err != nil {
+				t.Fatalf("GetTicketHistory: %v", err)
+			}
+			var notes []string
+			for _, m := range history {
+				if m.IsInternal {
+					notes = append(notes, m.Text)
+				}
+			}
+			want := []string{"карта клиента поддельная", "первая строка\nвторая строка", "проверить позже"}
+			if strings.Join(notes, "|") != strings.Join(want, "|") {
+				t.Fatalf("заметки %q, ожидались %q", notes, want)
+			}
+		}},
+		{"правка ответа поддержки", func(t *testing.T, e *handlerEnv) {
+			ticket, _ := e.createTicket(t)
+			header := tr("ru", "reply_header", ticket.ID)
+			long := strings.Repeat("а", MaxMessageLength-len([]rune(header))+10)
+			e.topicMessage(t, ticket.ThreadID, "Проверяем платёж")
+			e.topicMessage(t, ticket.ThreadID, long)
+			e.bot.Reset()
+
+			history, err := e.store.GetTicketHistory(ticket.ID)
+			if err != nil {
+				t.Fatalf("GetTicketHistory: %v", err)
+			}
+			for _, tt := range []struct{ old, edited, want string }{
+				{"Проверяем платёж", "Платёж прошёл", header + "Платёж прошёл"},
+				// Заголовок длинного ответа ушёл отдельным сообщением
+				{long, long + "!", long + "!"},
+			} {
+				var m *telebot.Message
+				for _, stored := range history {
+					if stored.Text == tt.old {
+						m = &telebot.Message{
+							ID:       stored.MessageID,
+							Sender:   e.agent,
+							Chat:     &telebot.Chat{ID: testGroupID, Type: telebot.ChatSuperGroup},
+							ThreadID: ticket.ThreadID,
+							Text:     tt.edited,
+						}
+					}
+				}
+				if m == nil {
+					t.Fatalf("ответ не найден в истории")
+				}
+				e.bot.Reset()
+				if err := e.svc.handleEditedMessage(NewFakeMessageContext(m)); err != nil {
+					t.Fatalf("правка ответа: %v", err)
+				}
+				edits := e.bot.Calls("Edit")
+				if len(edits) != 1 || edits[0].Text() != tt.want {
+					t.Fatalf("копия исправлена %d раз, ожидался текст длиной %d", len(edits), len([]rune(tt.want)))
+				}
+				if sent := e.sent(e.user.ID); len(sent) != 0 {
+					t.Fatalf("вместо правки клиенту отправлено %d сообщений", len(sent))
+				}
+			}
+		}},
+		{"восстановление темы командой", func(t *testing.T, e *handlerEnv) {
+			ticket, _ := e.createTicket(t)
+			oldThreadID := ticket.ThreadID
+
+			repair := func(payload string) {
+				lastTestMessageID++
+				m := &telebot.Message{
+					ID:      lastTestMessageID,
+					Sender:  e.agent,
+					Chat:    &telebot.Chat{ID: testGroupID, Type: telebot.ChatSuperGroup},
+					Text:    strings.TrimSpace("/repair " + payload),
+					Payload: payload,
+				}
+				e.bot.Reset()
+				if err := e.svc.handleRepairCommand(NewFakeMessageContext(m)); err != nil {
+					t.Fatalf("/repair %s: %v", payload, err)
+				}
+			}
+			id := strconv.FormatInt(ticket.ID, 10)
+
+			// Тема на месте: новая не создаётся
+			repair(id)
+			e.expectSent(t, testGroupID, tr(e.svc.supportLanguage(), "repair_topic_exists", ticket.ID, e.svc.topicLink(oldThreadID), ticket.ID))
+			if n := len(e.bot.Calls("Raw:createForumTopic")); n != 0 {
+				t.Fatalf("при живой теме создано тем: %d", n)
+			}
+			if got := e.ticket(t, ticket.ID).ThreadID; got != oldThreadID {
+				t.Fatalf("тема обращения %d, ожидалась %d", got, oldThreadID)
+			}
+
+			// force заменяет живую тему и закрывает прежнюю
+			repair(id + " force")
+			if n := len(e.bot.Calls("Raw:createForumTopic")); n != 1 {
+				t.Fatalf("с force создано тем: %d", n)
+			}
+			ticket = e.ticket(t, ticket.ID)
+			if ticket.ThreadID == oldThreadID {
+				t.Fatalf("тема обращения не заменена")
+			}
+			closed := e.bot.Calls("Raw:closeForumTopic")
+			if len(closed) != 1 || toString(closed[0].What.(map[string]interface{})["message_thread_id"]) != strconv.Itoa(oldThreadID) {
+				t.Fatalf("прежняя тема не закрыта: %+v", closed)
+			}
+
+			// Удалённая тема создаётся заново без force
+			e.bot.Errors["Raw:editForumTopic"] = telebot.NewError(400, "Bad Request: TOPIC_ID_INVALID")
+			repair(id)
+			if n := len(e.bot.Calls("Raw:createForumTopic")); n != 1 {
+				t.Fatalf("вместо удалённой темы создано тем: %d", n)
+			}
+		}},
+		{"срочность после решения поддержки", func(t *testing.T, e *handlerEnv) {
+			ticket, card := e.createTicket(t)
+			var created *telebot.Message
+			for _, c := range e.sent(e.user.ID) {
+				if c.SendOptions().ReplyMarkup != nil && strings.Contains(c.Text(), tr("ru", "ticket_created", ticket.ID, e.svc.cfg.SupportGroupLink)) {
+					created = c.Message
+				}
+			}
+			if created == nil {
+				t.Fatalf("сообщение о создании не отправлено")
+			}
+
+			// Агент повысил приоритет и вернул обычный
+			id := strconv.FormatInt(ticket.ID, 10)
+			e.press(t, e.agent, card, "priority_btn_"+id+"|"+PriorityHigh)
+			e.press(t, e.agent, card, "priority_btn_"+id+"|"+PriorityNormal)
+
+			e.press(t, e.user, created, "urgency_"+id+"|"+PriorityHigh)
+			if got := e.ticket(t, ticket.ID).Priority; got != PriorityNormal {
+				t.Fatalf("срочность пользователя перекрыла решение агента: %q", got)
+			}
+		}},
+		{"команды агентов в личном чате", func(t *testing.T, e *handlerEnv) {
+			e.createTicket(t)
+			e.bot.Reset()
+
+			for _, cmd := range []struct {
+				text    string
+				payload string
+				handle  func(telebot.Context) error
+			}{
+				{"/note проверить оплату", "проверить оплату", e.svc.handleNoteCommand},
+				{"/assign", "", e.svc.handleAssignCommand},
+				{"/priority urgent", "urgent", e.svc.handlePriorityCommand},
+				{"/reopen", "", e.svc.handleReopenCommand},
+			} {
+				lastTestMessageID++
+				m := &telebot.Message{
+					ID:      lastTestMessageID,
+					Sender:  e.user,
+					Chat:    &telebot.Chat{ID: e.user.ID, Type: telebot.ChatPrivate},
+					Text:    cmd.text,
+					Payload: cmd.payload,
+				}
+				if err := cmd.handle(NewFakeMessageContext(m)); err != nil {
+					t.Fatalf("%s: %v", cmd.text, err)
+				}
+			}
+			if calls := e.bot.Calls("Send"); len(calls) != 0 {
+				t.Fatalf("в личном чате отвечено на команды агентов: %d сообщений", len(calls))
+			}
+		}},
+		{"история обращений", func(t *testing.T, e *handlerEnv) {
+			ticket, _ := e.createTicket(t)
+			e.topicMessage(t, ticket.ThreadID, "Проверяем платёж")
+			e.bot.Reset()
+
+			lastTestMessageID++
+			list := &telebot.Message{
+				ID:     lastTestMessageID,
+				Sender: e.user,
+				Chat:   &telebot.Chat{ID: e.user.ID, Type: telebot.ChatPrivate},
+				Text:   "/history",
+			}
+			if err := e.svc.handleHistoryCommand(NewFakeMessageContext(list)); err != nil {
+				t.Fatalf("/history: %v", err)
+			}
+			reply := e.expectSent(t, e.user.ID, tr("ru", "your_tickets"))
+			markup := reply.SendOptions().ReplyMarkup
+			if markup == nil || len(markup.InlineKeyboard) < 2 {
+				t.Fatalf("в списке нет кнопки обращения")
+			}
+			btn := markup.InlineKeyboard[0][0]
+			if btn.Unique != "ticket_"+strconv.FormatInt(ticket.ID, 10) {
+				t.Fatalf("кнопка обращения %q", btn.Unique)
+			}
+
+			e.bot.Reset()
+			e.press(t, e.user, reply.Message, btn.Unique)
+			details := e.expectSent(t, e.user.ID, "Не проходит оплата картой")
+			if !strings.Contains(details.Text(), "Проверяем платёж") {
+				t.Fatalf("в истории нет ответа поддержки: %q", details.Text())
+			}
+			e.expectResponse(t, "")
+		}},
+		{"заблокированный пользователь", func(t *testing.T, e *handlerEnv) {
+			err := e.store.BlockUser(UserBlock{UserID: e.user.ID, BlockedByID: e.agent.ID, BlockedAt: "2026-01-01 10:00:00"})
+			if err != nil {
+				t.Fatalf("BlockUser: %v", err)
+			}
+
+			for _, cmd := range []struct {
+				text    string
+				handler telebot.HandlerFunc
+			}{
+				{"/start", e.svc.handleStart},
+				{"/language", e.svc.handleLanguageCommand},
+				{"/history", e.svc.handleHistoryCommand},
+				{tr("ru", "btn_new_ticket"), e.svc.handleNewTicketButton},
+				{tr("ru", "btn_close_ticket"), e.svc.handleCloseTicketButton},
+				{tr("ru", "btn_my_tickets"), e.svc.handleMyTicketsButton},
+			} {
+				lastTestMessageID++
+				m := &telebot.Message{
+					ID:     lastTestMessageID,
+					Sender: e.user,
+					Chat:   &telebot.Chat{ID: e.user.ID, Type: telebot.ChatPrivate},
+					Text:   cmd.text,
+				}
+				if err := cmd.handler(NewFakeMessageContext(m)); err != nil {
+					t.Fatalf("%s: %v", cmd.text, err)
+				}
+			}
+
+			sent := e.sent(e.user.ID)
+			if len(sent) != 1 || !strings.HasPrefix(sent[0].Text(), tr("ru", "blocked_user")) {
+				var texts []string
+				for _, c := range sent {
+					texts = append(texts, c.Text())
+				}
+				t.Fatalf("заблокированному пользователю отправлено: %q", texts)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newHandlerEnv(t))
+		})
+	}
+}
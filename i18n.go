@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Все тексты для пользователей и агентов берутся из каталогов сообщений.
+// Русский каталог полный и служит запасным: если в другом каталоге нет
+// ключа, используется русский текст.
+const fallbackLanguage = "ru"
+
+var catalogs = map[string]map[string]string{
+	"ru": localeRU,
+	"en": localeEN,
+}
+
+// UserLanguage — язык пользователя. IsOverride означает, что язык выбран
+// командой /language, иначе он определён по настройкам Telegram.
+type UserLanguage struct {
+	UserID     int64  `json:"user_id"`
+	Language   string `json:"language"`
+	IsOverride bool   `json:"is_override"`
+}
+
+// tr возвращает сообщение из каталога языка lang, подставляя аргументы.
+func tr(lang, key string, args ...interface{}) string {
+	msg, ok := catalogs[lang][key]
+	if !ok {
+		msg, ok = catalogs[fallbackLanguage][key]
+	}
+	if !ok {
+		log.Printf("Нет текста для ключа %q", key)
+		msg = key
+	}
+
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+func isSupportedLanguage(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// supportedLanguages возвращает коды языков в алфавитном порядке.
+func supportedLanguages() []string {
+	langs := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// detectLanguage выбирает язык по language_code из Telegram
+// ("en", "en-US" → "en"); неподдерживаемые языки заменяются языком по умолчанию.
+func (s *Service) detectLanguage(code string) string {
+	lang := strings.ToLower(strings.SplitN(code, "-", 2)[0])
+	if isSupportedLanguage(lang) {
+		return lang
+	}
+	return s.cfg.DefaultLanguage
+}
+
+// userLanguage возвращает язык собеседника и запоминает его, чтобы на
+// том же языке можно было писать пользователю из группы поддержки.
+func (s *Service) userLanguage(u *telebot.User) string {
+	saved, err := s.store.GetUserLanguage(u.ID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Ошибка получения языка пользователя: %v", err)
+	}
+	if saved != nil && saved.IsOverride && isSupportedLanguage(saved.Language) {
+		return saved.Language
+	}
+
+	lang := s.detectLanguage(u.LanguageCode)
+	if saved == nil || saved.Language != lang || saved.IsOverride {
+		if err := s.store.SaveUserLanguage(UserLanguage{UserID: u.ID, Language: lang}); err != nil {
+			log.Printf("Ошибка сохранения языка пользователя: %v", err)
+		}
+	}
+	return lang
+}
+
+// languageOf возвращает сохранённый язык пользователя по ID, когда
+// собеседник недоступен (например, при ответе из группы поддержки).
+func (s *Service) languageOf(userID int64) string {
+	saved, err := s.store.GetUserLanguage(userID)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Ошибка получения языка пользователя: %v", err)
+		}
+		return s.cfg.DefaultLanguage
+	}
+	if !isSupportedLanguage(saved.Language) {
+		return s.cfg.DefaultLanguage
+	}
+	return saved.Language
+}
+
+// supportLanguage — язык сообщений в группе поддержки.
+func (s *Service) supportLanguage() string {
+	return s.cfg.SupportLanguage
+}
+
+// registerButton привязывает обработчик к кнопке клавиатуры на всех языках,
+// чтобы кнопки работали независимо от языка, на котором они были показаны.
+func registerButton(b *telebot.Bot, key string, handler telebot.HandlerFunc) {
+	for _, lang := range supportedLanguages() {
+		b.Handle(&telebot.Btn{Text: tr(lang, key)}, handler)
+	}
+}
+
+func (s *Service) handleLanguageCommand(c telebot.Context) error {
+	if c.Chat().Type != telebot.ChatPrivate {
+		return s.reply(c, tr(s.supportLanguage(), "language_group"))
+	}
+	if rejected, err := s.rejectBlockedUser(c); rejected {
+		return err
+	}
+
+	lang := s.userLanguage(c.Sender())
+	if payload := strings.ToLower(strings.TrimSpace(c.Message().Payload)); payload != "" {
+		return s.setUserLanguage(c, payload)
+	}
+
+	markup := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for _, l := range supportedLanguages() {
+		rows = append(rows, markup.Row(markup.Data(tr(l, "language_name"), "lang_"+l)))
+	}
+	rows = append(rows, markup.Row(markup.Data(tr(lang, "btn_language_auto"), "lang_auto")))
+	markup.Inline(rows...)
+
+	return s.send(c, tr(lang, "language_choose"), markup)
+}
+
+func (s *Service) handleLanguageButton(c telebot.Context, choice string) error {
+	if err := s.setUserLanguage(c, choice); err != nil {
+		return err
+	}
+	return s.respond(c)
+}
+
+// setUserLanguage сохраняет выбор пользователя: код языка или "auto"
+// для возврата к языку из настроек Telegram.
+func (s *Service) setUserLanguage(c telebot.Context, choice string) error {
+	user := c.Sender()
+
+	if choice == "auto" {
+		if err := s.store.SaveUserLanguage(UserLanguage{UserID: user.ID, Language: s.detectLanguage(user.LanguageCode)}); err != nil {
+			log.Printf("Ошибка сохранения языка пользователя: %v", err)
+			return s.send(c, tr(s.userLanguage(user), "error_request"))
+		}
+		lang := s.userLanguage(user)
+		if err := s.send(c, tr(lang, "language_auto_set", tr(lang, "language_name"))); err != nil {
+			return err
+		}
+		return s.showUserMenu(c)
+	}
+
+	if !isSupportedLanguage(choice) {
+		lang := s.userLanguage(user)
+		return s.send(c, tr(lang, "language_unknown", choice, strings.Join(supportedLanguages(), ", ")))
+	}
+
+	if err := s.store.SaveUserLanguage(UserLanguage{UserID: user.ID, Language: choice, IsOverride: true}); err != nil {
+		log.Printf("Ошибка сохранения языка пользователя: %v", err)
+		return s.send(c, tr(choice, "error_request"))
+	}
+
+	if err := s.send(c, tr(choice, "language_set", tr(choice, "language_name"))); err != nil {
+		return err
+	}
+	// Клавиатура отправляется заново, чтобы кнопки были на новом языке
+	return s.showUserMenu(c)
+}
@@ -0,0 +1,284 @@
+package main
+
+var localeEN = map[string]string{
+	"language_name":     "English",
+	"language_choose":   "🌐 Choose your language:",
+	"btn_language_auto": "🔄 Automatic (from Telegram settings)",
+	"language_set":      "✅ Language changed: %s",
+	"language_auto_set": "✅ Language will follow your Telegram settings: %s",
+	"language_unknown":  "Unknown language %q. Available: %s",
+	"language_group":    "The support group language is set in the configuration (support_language)",
+
+	// User menu
+	"btn_new_ticket":   "New request",
+	"btn_close_ticket": "Close request",
+	"btn_my_tickets":   "My requests",
+	"choose_action":    "Choose an action:",
+	"welcome": "🛠️ Welcome to support!\n\n" +
+		"You can create a new request or view your previous ones.",
+	"help": "ℹ️ How to use the bot:\n\n" +
+		"1. Press '%s' to create a request\n" +
+		"2. The bot will create a topic in the support group\n" +
+		"3. All your further messages will be added to that topic\n" +
+		"4. Support agents will reply in the topic\n\n" +
+		"🌐 Change language: /language\n\n" +
+		"Support group: %s",
+
+	// User requests
+	"error_request":    "❌ Failed to process your request",
+	"error_message":    "❌ Failed to process your message",
+	"previous_closed":  "Your previous request is already closed. Send a message describing the problem to create a new one, or resume it in '%s'.",
+	"already_open":     "❌ You already have an active request #%d\n\nPlease wait for support to reply or close the current request.",
+	"describe_problem": "Send a message describing the problem to create a new request.",
+	"no_open_to_close": "You have no active requests to close.",
+	"already_closed":   "This request is already closed.",
+	"error_closing":    "❌ Failed to close the request",
+	"closed_success":   "✅ Request #%d has been closed.",
+	"closed_use_new":   "❌ Your request is already closed. Press '%s' to create a new one.",
+	"ticket_title":     "Request from %s",
+	"error_create":     "❌ Failed to create the request",
+	"topic_failed":     "⚠️ Request #%d is saved, but it could not be passed to support yet. We will retry automatically; if the matter is urgent, please contact the administrator: %s",
+	"ticket_created": "✅ Request #%d has been created!\n\n" +
+		"Support agents will reply in the support group:\n%s\n\n" +
+		"All your further messages will be added to this request.",
+	"error_relay":          "❌ Could not deliver the message to the support group",
+	"message_added":        "✅ Your message has been added to request #%d",
+	"reply_header":         "📨 Reply to request #%d:\n\n",
+	"edited_by_support":    "✏️ Support edited the message:\n\n%s",
+	"closed_by_support":    "✔️ Your request #%d has been closed. Thank you for contacting us!",
+	"user_assigned_take":   "✅ Your request #%d is being worked on!\n👨‍💼 Handled by %s",
+	"user_assigned_change": "🔄 Your request #%d has been passed to another specialist.\n👨‍💼 Now handled by %s",
+
+	// Request history
+	"error_history_list": "❌ Failed to load your requests",
+	"no_tickets":         "You have no requests yet.",
+	"your_tickets":       "📋 Your recent requests:",
+	"btn_back":           "← Back",
+	"btn_back_to_list":   "← Back to list",
+	"btn_resume":         "🔄 Resume request",
+	"error_data":         "Failed to load data",
+	"error_history":      "Failed to load the history",
+	"error_send_history": "Failed to send the history",
+	"not_your_ticket":    "This is not your request",
+	"ticket_details": "📋 Request #%d\n\n" +
+		"📌 Subject: %s\n" +
+		"🕒 Created: %s\n" +
+		"🔍 Status: %s\n\n" +
+		"--- Conversation ---\n\n",
+	"handled_by":     "👨‍💼 Your request is handled by %s\n\n",
+	"archived_note":  "🗄 The conversation was moved to the archive on %s\n\n",
+	"sender_you":     "You",
+	"sender_support": "Support (%s)",
+	"edited_mark":    ", edited %s",
+
+	"status_open":        "🟢 Open",
+	"status_in_progress": "🟡 In progress",
+	"status_closed":      "🔴 Closed",
+
+	// Attachments
+	"media_photo":           "🖼 Photo",
+	"media_document":        "📄 Document",
+	"media_audio":           "🎵 Audio",
+	"media_voice":           "🎤 Voice message",
+	"media_video":           "🎬 Video",
+	"media_video_note":      "📹 Video message",
+	"media_animation":       "🎞 GIF",
+	"media_sticker":         "🏷 Sticker",
+	"attachment_not_found":  "Attachment not found",
+	"attachment_header":     "📎 Attachment from request #%d [%s]",
+	"error_send_attachment": "Failed to send the attachment",
+
+	// Support group
+	"topic_name": "Request #%d: %s",
+	"card_text": "🚨 Request #%d\n\n" +
+		"👤 From: %s\n" +
+		"🆔 ID: %d\n\n" +
+		"📝 Message:\n%s\n\n" +
+		"🕒 Date: %s\n" +
+		"🔗 Status: %s",
+	"card_assignee": "\n👨‍💼 Assignee: %s",
+	"new_message_header": "📨 New message in request #%d\n\n" +
+		"👤 From: %s %s (@%s)\n" +
+		"🆔 ID: %d\n\n" +
+		"📝 Message:\n",
+	"edited_by_user": "✏️ The user edited the message:\n\n%s",
+	"closed_by_user": "⚠️ Request #%d was closed by the user\n\n" +
+		"👤 User: @%s\n" +
+		"🕒 Closed at: %s",
+	"btn_accept":          "✅ Accept",
+	"btn_close":           "❌ Close",
+	"btn_take":            "🙋 Take over",
+	"btn_unassign":        "🙅 Unassign",
+	"btn_reopen":          "🔄 Reopen",
+	"ticket_closed_cb":    "Request closed",
+	"ticket_is_closed":    "The request is already closed",
+	"topic_only":          "This command only works in a request topic",
+	"topic_ticket_absent": "No request found for this topic",
+
+	// Assignments
+	"assign_action_take":     "taken",
+	"assign_action_reassign": "reassigned",
+	"assign_action_unassign": "unassigned",
+	"already_responsible":    "You are already handling this request",
+	"taken_cb":               "Request taken",
+	"no_assignee":            "No assignee",
+	"unassigned_cb":          "Assignee removed",
+	"cannot_assign_bot":      "A bot cannot be assigned",
+	"already_assigned":       "%s is already handling request #%d",
+	"error_assign":           "❌ Failed to assign the request",
+	"assigned":               "👨‍💼 Request #%d is assigned to %s",
+	"error_unassign":         "❌ Failed to remove the assignee",
+	"unassigned":             "🙅 Request #%d is no longer assigned",
+	"error_assignments":      "❌ Failed to load the assignment history",
+	"no_assignments":         "Request #%d has never been assigned",
+	"assignments_header":     "📜 Assignment history of request #%d\n\n",
+	"assignments_line":       "🕒 %s — %s",
+	"assignments_changed_by": " (by %s)",
+
+	// Notes
+	"note_usage": "Usage: /note <note text>\nThe note is kept in the history and is not sent to the customer.",
+	"error_note": "❌ Failed to save the note",
+	"note_saved": "🔒 Internal note on request #%d — not sent to the customer",
+
+	// Reopening
+	"reopened_by_support": "🔄 Your request #%d has been reopened by support. You can continue the conversation.",
+	"reopened_by_user":    "🔄 Request #%d was reopened by the user %s",
+	"reopen_not_closed":   "Request #%d is not closed",
+	"reopen_has_open":     "The user already has an active request",
+	"reopen_has_open_you": "You already have an active request. Close it to resume this one.",
+	"error_reopen":        "❌ Failed to reopen the request",
+	"reopened_user":       "🔄 Request #%d has been reopened. Tell us what else needs to be done.",
+	"reopened_cb":         "Request reopened",
+	"reopened_agent":      "🔄 Request #%d has been reopened, the user was notified",
+
+	// Satisfaction survey
+	"csat_survey":        "📊 Please rate our support for request #%d:\n1 — very poor, 5 — excellent",
+	"csat_reopened":      "The request has been reopened, you can rate it after it is closed",
+	"error_save_rating":  "Failed to save the rating",
+	"csat_topic":         "⭐ Customer rating for request #%d: %s (%d/%d)",
+	"btn_skip":           "Skip",
+	"csat_thanks":        "Thank you for rating request #%d: %s\n\nIf you like, leave a comment as a reply to this message.",
+	"error_save_comment": "❌ Failed to save the comment",
+	"csat_comment_topic": "💬 Customer comment on the rating of request #%d:\n%s",
+	"csat_comment_thx":   "🙏 Thank you for the feedback! Your comment was added to the rating of request #%d.",
+	"csat_summary":       "%.2f of %d, CSAT %.0f%% (ratings: %d)",
+	"csat_report_header": "📊 Customer satisfaction\n🗓 %s — %s (%d days)\n\n",
+	"csat_report_empty":  "No ratings in this period",
+	"csat_no_agent":      "Unassigned",
+	"csat_average":       "⭐ Average rating: %s\n",
+	"csat_previous":      "↕️ Previous period: %s\n",
+	"csat_distribution":  "\nDistribution:\n",
+	"csat_by_agent":      "\n👨‍💼 By assignee:\n",
+	"csat_usage":         "Usage: /csat [number of days], 30 by default",
+	"error_report":       "❌ Failed to build the report",
+
+	// Auto-closing
+	"btn_keep_open":       "✅ Yes, I still need help",
+	"stale_warning":       "⏳ We haven't heard from you on request #%d for a while. Do you still need help?\n\nIf we get no reply within %s, the request will be closed automatically.",
+	"stale_warning_topic": "⏳ The user has not replied for a while and was sent a reminder. Without a reply the request will close in %s.",
+	"auto_closed_topic":   "🤖 Request #%d was closed automatically: the user did not respond to the reminder",
+	"auto_closed":         "🔒 Request #%d was closed automatically because we got no reply. If you still need help, resume it in '%s' or write to us again.",
+	"keep_open_closed":    "The request is already closed. You can resume it in '%s'.",
+	"keep_open_done":      "👍 Request #%d stays open. We'll get back to you soon.",
+	"keep_open_topic":     "✋ The user confirmed they still need help",
+	"duration_days":       "%d days",
+	"duration_hours":      "%d h",
+	"duration_minutes":    "%d min",
+
+	// Search
+	"search_usage": "Usage: /search [text] [status:open|in_progress|closed] [priority:low|normal|high|urgent] [user:@name|ID] [assignee:@name|name|ID] [from:YYYY-MM-DD] [to:YYYY-MM-DD]\n" +
+		"Give some text or at least one filter.",
+	"error_search":       "❌ Failed to search requests",
+	"search_empty":       "🔍 Nothing found",
+	"search_header":      "🔍 Requests found: %d (page %d of %d)\n",
+	"search_result_user": "👤 %s · 🕒 %s",
+	"search_expired":     "These search results are outdated, run /search again",
+	"btn_prev_page":      "← Previous",
+	"btn_next_page":      "Next →",
+
+	// Transcript export
+	"btn_export":                     "📥 %s",
+	"export_usage":                   "Usage: /export [request number] [html|json|txt]\nIn a request topic the number can be omitted.",
+	"error_export":                   "❌ Failed to export the conversation",
+	"transcript_caption":             "📄 Conversation of request #%d",
+	"transcript_title":               "Request #%d",
+	"transcript_subject":             "Subject",
+	"transcript_user":                "User",
+	"transcript_created":             "Created",
+	"transcript_status":              "Status",
+	"transcript_assignee":            "Assignee",
+	"transcript_closed":              "Closed",
+	"transcript_archived":            "Conversation archived on",
+	"transcript_exported":            "Exported",
+	"transcript_status_changes":      "Status history",
+	"transcript_status_change":       "%s: %s → %s (%s)",
+	"transcript_messages":            "Conversation",
+	"transcript_no_messages":         "No messages",
+	"transcript_note":                "🔒 Note (%s)",
+	"transcript_attachment":          "📎 %s, file_id: %s",
+	"transcript_customer_attachment": "📎 %s",
+	"transcript_support":             "Support",
+
+	// Blocking and rate limiting
+	"block_usage":                "Usage: /block [user ID] [duration: 30m, 12h, 7d] [reason]\nIn a request topic the ID can be omitted.",
+	"unblock_usage":              "Usage: /unblock [user ID]\nIn a request topic the ID can be omitted.",
+	"block_self":                 "You cannot block yourself or the bot",
+	"error_block":                "❌ Failed to change the block",
+	"blocked":                    "🚫 User %d is blocked",
+	"blocked_user":               "⛔ You cannot write to support",
+	"blocked_until":              " until %s",
+	"blocked_forever":            " permanently",
+	"blocked_reason":             "\nReason: %s",
+	"not_blocked":                "User %d is not blocked",
+	"unblocked":                  "✅ User %d is unblocked",
+	"rate_limited_messages":      "⏳ You are sending too many messages. They are not being delivered, please wait %s.",
+	"rate_limited_tickets":       "⏳ You are creating too many requests. Please try again in %s.",
+	"rate_limited_topic":         "⚠️ The user exceeded the message limit (%d per %s), new messages are temporarily not forwarded",
+	"rate_limited_tickets_topic": "⚠️ The user exceeded the new request limit (%d per %s), new requests are temporarily not created",
+
+	// Archiving
+	"retention_header":        "🗄 Archiving at %s\n\n📦 Requests archived: %d\n",
+	"retention_deleted":       "💬 Messages removed from the database: %d\n",
+	"retention_line":          "• #%d — %d msg. → %s\n",
+	"retention_errors":        "\n⚠️ Errors: %d\n",
+	"retention_error_dir":     "archive directory: %v",
+	"retention_error_list":    "selecting requests: %v",
+	"retention_error_history": "reading the history: %v",
+	"retention_error_edits":   "reading the edits: %v",
+	"retention_error_write":   "writing the archive: %v",
+	"retention_error_delete":  "removing from the database: %v",
+	"and_more":                "… and %d more\n",
+
+	// Priority
+	"priority_low":                "low",
+	"priority_normal":             "normal",
+	"priority_high":               "high",
+	"priority_urgent":             "urgent",
+	"card_priority":               "\n⚡ Priority: %s",
+	"btn_priority_down":           "⬇️ %s",
+	"btn_priority_up":             "⬆️ %s",
+	"btn_urgency_low":             "🐢 Not urgent",
+	"btn_urgency_high":            "⚡ Urgent",
+	"urgency_set":                 "\n\nUrgency: %s",
+	"priority_escalated_topic":    "🔥 Priority raised to “%s” (%s)",
+	"priority_escalated_assignee": "\n%s, please take a look",
+	"priority_changed_topic":      "⚡ Priority changed: %s → %s (%s)",
+	"priority_set":                "Request #%d priority: %s",
+	"priority_current":            "⚡ Request #%d priority: %s",
+	"priority_usage":              "Usage: /priority low|normal|high|urgent",
+	"error_priority":              "❌ Failed to change the priority",
+	"queue_usage":                 "Usage: /queue [same filters as /search]\nShows requests that are not closed: most urgent first, oldest first among equals.",
+
+	// Topic repair
+	"topic_restored":      "♻️ The request topic has been restored. The saved conversation follows (messages: %d)",
+	"replay_header":       "🗂 %s, %s:\n\n",
+	"repair_usage":        "Usage: /repair [request number [force]]\nWithout a number, topics are restored for all requests left without one. An existing topic is replaced only with force.",
+	"repair_done":         "♻️ Topics restored: %d, errors: %d",
+	"repair_ticket_done":  "♻️ The topic of request #%d has been recreated: %s",
+	"repair_failed":       "❌ Could not restore the topic of request #%d: %s",
+	"repair_topic_exists": "ℹ️ The topic of request #%d still exists: %s\nTo create a new one anyway, send /repair %d force",
+
+	// Outbox
+	"delivery_failed_user":  "❗️ Message to the user was not delivered (attempts: %d)\nError: %s\n\n%s",
+	"delivery_failed_topic": "❗️ User's message could not be relayed to the topic (attempts: %d)\nError: %s\n\n%s",
+}
@@ -0,0 +1,284 @@
+package main
+
+var localeRU = map[string]string{
+	"language_name":     "Русский",
+	"language_choose":   "🌐 Выберите язык:",
+	"btn_language_auto": "🔄 Автоматически (по настройкам Telegram)",
+	"language_set":      "✅ Язык изменён: %s",
+	"language_auto_set": "✅ Язык будет определяться по настройкам Telegram: %s",
+	"language_unknown":  "Неизвестный язык %q. Доступны: %s",
+	"language_group":    "Язык группы поддержки задаётся в конфигурации (support_language)",
+
+	// Меню пользователя
+	"btn_new_ticket":   "Новое обращение",
+	"btn_close_ticket": "Закрыть обращение",
+	"btn_my_tickets":   "Мои обращения",
+	"choose_action":    "Выберите действие:",
+	"welcome": "🛠️ Добро пожаловать в поддержку!\n\n" +
+		"Вы можете создать новое обращение или просмотреть историю предыдущих.",
+	"help": "ℹ️ Как использовать бота:\n\n" +
+		"1. Нажмите '%s' для создания запроса\n" +
+		"2. Бот создаст тему в группе поддержки\n" +
+		"3. Все ваши последующие сообщения будут добавляться в эту тему\n" +
+		"4. Администраторы ответят в теме\n\n" +
+		"🌐 Сменить язык: /language\n\n" +
+		"Группа поддержки: %s",
+
+	// Обращения пользователя
+	"error_request":    "❌ Ошибка при обработке запроса",
+	"error_message":    "❌ Ошибка при обработке сообщения",
+	"previous_closed":  "Ваше предыдущее обращение уже закрыто. Отправьте сообщение с описанием проблемы для создания нового или возобновите его в разделе '%s'.",
+	"already_open":     "❌ У вас уже есть активное обращение #%d\n\nПожалуйста, дождитесь ответа поддержки или закройте текущее обращение.",
+	"describe_problem": "Отправьте сообщение с описанием проблемы для создания нового обращения.",
+	"no_open_to_close": "У вас нет активных обращений для закрытия.",
+	"already_closed":   "Это обращение уже закрыто.",
+	"error_closing":    "❌ Ошибка при закрытии обращения",
+	"closed_success":   "✅ Обращение #%d успешно закрыто.",
+	"closed_use_new":   "❌ Ваше обращение уже закрыто. Нажмите '%s' для создания нового.",
+	"ticket_title":     "Обращение от %s",
+	"error_create":     "❌ Ошибка при создании обращения",
+	"topic_failed":     "⚠️ Обращение #%d сохранено, но передать его в поддержку пока не удалось. Мы повторим попытку автоматически, а если вопрос срочный, свяжитесь с администратором: %s",
+	"ticket_created": "✅ Обращение #%d создано!\n\n" +
+		"Администраторы ответят в группе поддержки:\n%s\n\n" +
+		"Все ваши последующие сообщения будут добавляться в эту тему.",
+	"error_relay":          "❌ Не удалось отправить сообщение в группу поддержки",
+	"message_added":        "✅ Ваше сообщение добавлено к обращению #%d",
+	"reply_header":         "📨 Ответ по обращению #%d:\n\n",
+	"edited_by_support":    "✏️ Поддержка исправила сообщение:\n\n%s",
+	"closed_by_support":    "✔️ Ваше обращение #%d закрыто. Спасибо, что обратились к нам!",
+	"user_assigned_take":   "✅ Ваше обращение #%d принято в работу!\n👨‍💼 Вашим обращением занимается %s",
+	"user_assigned_change": "🔄 Ваше обращение #%d передано другому специалисту.\n👨‍💼 Теперь им занимается %s",
+
+	// История обращений
+	"error_history_list": "❌ Ошибка при получении истории обращений",
+	"no_tickets":         "У вас пока нет обращений.",
+	"your_tickets":       "📋 Ваши последние обращения:",
+	"btn_back":           "← Назад",
+	"btn_back_to_list":   "← Назад к списку",
+	"btn_resume":         "🔄 Возобновить обращение",
+	"error_data":         "Ошибка при получении данных",
+	"error_history":      "Ошибка при получении истории",
+	"error_send_history": "Ошибка при отправке истории",
+	"not_your_ticket":    "Это не ваше обращение",
+	"ticket_details": "📋 Обращение #%d\n\n" +
+		"📌 Тема: %s\n" +
+		"🕒 Создано: %s\n" +
+		"🔍 Статус: %s\n\n" +
+		"--- История переписки ---\n\n",
+	"handled_by":     "👨‍💼 Вашим обращением занимается %s\n\n",
+	"archived_note":  "🗄 Переписка перенесена в архив %s\n\n",
+	"sender_you":     "Вы",
+	"sender_support": "Поддержка (%s)",
+	"edited_mark":    ", изменено %s",
+
+	"status_open":        "🟢 Открыто",
+	"status_in_progress": "🟡 В работе",
+	"status_closed":      "🔴 Закрыто",
+
+	// Вложения
+	"media_photo":           "🖼 Фото",
+	"media_document":        "📄 Документ",
+	"media_audio":           "🎵 Аудио",
+	"media_voice":           "🎤 Голосовое сообщение",
+	"media_video":           "🎬 Видео",
+	"media_video_note":      "📹 Видеосообщение",
+	"media_animation":       "🎞 GIF",
+	"media_sticker":         "🏷 Стикер",
+	"attachment_not_found":  "Вложение не найдено",
+	"attachment_header":     "📎 Вложение из обращения #%d [%s]",
+	"error_send_attachment": "Ошибка при отправке вложения",
+
+	// Группа поддержки
+	"topic_name": "Обращение #%d: %s",
+	"card_text": "🚨 Обращение #%d\n\n" +
+		"👤 От: %s\n" +
+		"🆔 ID: %d\n\n" +
+		"📝 Сообщение:\n%s\n\n" +
+		"🕒 Дата: %s\n" +
+		"🔗 Статус: %s",
+	"card_assignee": "\n👨‍💼 Ответственный: %s",
+	"new_message_header": "📨 Новое сообщение по обращению #%d\n\n" +
+		"👤 От: %s %s (@%s)\n" +
+		"🆔 ID: %d\n\n" +
+		"📝 Сообщение:\n",
+	"edited_by_user": "✏️ Пользователь исправил сообщение:\n\n%s",
+	"closed_by_user": "⚠️ Обращение #%d закрыто пользователем\n\n" +
+		"👤 Пользователь: @%s\n" +
+		"🕒 Время закрытия: %s",
+	"btn_accept":          "✅ Принято",
+	"btn_close":           "❌ Закрыто",
+	"btn_take":            "🙋 Взять себе",
+	"btn_unassign":        "🙅 Снять назначение",
+	"btn_reopen":          "🔄 Переоткрыть",
+	"ticket_closed_cb":    "Обращение закрыто",
+	"ticket_is_closed":    "Обращение уже закрыто",
+	"topic_only":          "Команда работает только в теме обращения",
+	"topic_ticket_absent": "Обращение для этой темы не найдено",
+
+	// Назначения
+	"assign_action_take":     "взял(а) в работу",
+	"assign_action_reassign": "передано",
+	"assign_action_unassign": "назначение снято",
+	"already_responsible":    "Вы уже отвечаете за это обращение",
+	"taken_cb":               "Обращение принято в работу",
+	"no_assignee":            "Ответственный не назначен",
+	"unassigned_cb":          "Назначение снято",
+	"cannot_assign_bot":      "Нельзя назначить бота ответственным",
+	"already_assigned":       "%s уже отвечает за обращение #%d",
+	"error_assign":           "❌ Ошибка при назначении ответственного",
+	"assigned":               "👨‍💼 Ответственный за обращение #%d: %s",
+	"error_unassign":         "❌ Ошибка при снятии назначения",
+	"unassigned":             "🙅 Назначение по обращению #%d снято",
+	"error_assignments":      "❌ Ошибка при получении истории назначений",
+	"no_assignments":         "По обращению #%d ещё никто не назначался",
+	"assignments_header":     "📜 История назначений по обращению #%d\n\n",
+	"assignments_line":       "🕒 %s — %s",
+	"assignments_changed_by": " (изменил(а) %s)",
+
+	// Заметки
+	"note_usage": "Использование: /note <текст заметки>\nЗаметка сохранится в истории и не будет отправлена клиенту.",
+	"error_note": "❌ Ошибка при сохранении заметки",
+	"note_saved": "🔒 Внутренняя заметка по обращению #%d — клиенту не отправлена",
+
+	// Повторное открытие
+	"reopened_by_support": "🔄 Ваше обращение #%d снова открыто поддержкой. Вы можете продолжить переписку.",
+	"reopened_by_user":    "🔄 Обращение #%d снова открыто пользователем %s",
+	"reopen_not_closed":   "Обращение #%d не закрыто",
+	"reopen_has_open":     "У пользователя уже есть активное обращение",
+	"reopen_has_open_you": "У вас уже есть активное обращение. Закройте его, чтобы возобновить это.",
+	"error_reopen":        "❌ Ошибка при переоткрытии обращения",
+	"reopened_user":       "🔄 Обращение #%d снова открыто. Опишите, что ещё нужно сделать.",
+	"reopened_cb":         "Обращение снова открыто",
+	"reopened_agent":      "🔄 Обращение #%d снова открыто, пользователь уведомлён",
+
+	// Оценка качества
+	"csat_survey":        "📊 Оцените, пожалуйста, работу поддержки по обращению #%d:\n1 — очень плохо, 5 — отлично",
+	"csat_reopened":      "Обращение снова открыто, оценить его можно после закрытия",
+	"error_save_rating":  "Ошибка при сохранении оценки",
+	"csat_topic":         "⭐ Оценка клиента по обращению #%d: %s (%d/%d)",
+	"btn_skip":           "Пропустить",
+	"csat_thanks":        "Спасибо за оценку обращения #%d: %s\n\nЕсли хотите, оставьте комментарий ответом на это сообщение.",
+	"error_save_comment": "❌ Ошибка при сохранении комментария",
+	"csat_comment_topic": "💬 Комментарий клиента к оценке обращения #%d:\n%s",
+	"csat_comment_thx":   "🙏 Спасибо за отзыв! Комментарий добавлен к оценке обращения #%d.",
+	"csat_summary":       "%.2f из %d, CSAT %.0f%% (оценок: %d)",
+	"csat_report_header": "📊 Удовлетворённость клиентов\n🗓 %s — %s (%d дн.)\n\n",
+	"csat_report_empty":  "Оценок за период нет",
+	"csat_no_agent":      "Без ответственного",
+	"csat_average":       "⭐ Средняя оценка: %s\n",
+	"csat_previous":      "↕️ Предыдущий период: %s\n",
+	"csat_distribution":  "\nРаспределение:\n",
+	"csat_by_agent":      "\n👨‍💼 По ответственным:\n",
+	"csat_usage":         "Использование: /csat [количество дней], по умолчанию 30",
+	"error_report":       "❌ Ошибка при построении отчёта",
+
+	// Автозакрытие
+	"btn_keep_open":       "✅ Да, вопрос ещё актуален",
+	"stale_warning":       "⏳ По обращению #%d давно нет ответа. Вопрос ещё актуален?\n\nЕсли мы не получим ответа в течение %s, обращение будет закрыто автоматически.",
+	"stale_warning_topic": "⏳ Пользователь давно не отвечает, ему отправлено напоминание. Без ответа обращение закроется через %s.",
+	"auto_closed_topic":   "🤖 Обращение #%d закрыто автоматически: пользователь не ответил на напоминание",
+	"auto_closed":         "🔒 Обращение #%d закрыто автоматически, так как мы не получили ответа. Если вопрос остался, возобновите его в разделе '%s' или напишите нам снова.",
+	"keep_open_closed":    "Обращение уже закрыто. Его можно возобновить в разделе '%s'.",
+	"keep_open_done":      "👍 Обращение #%d остаётся открытым. Мы скоро вернёмся к вам.",
+	"keep_open_topic":     "✋ Пользователь подтвердил, что вопрос ещё актуален",
+	"duration_days":       "%d дн.",
+	"duration_hours":      "%d ч",
+	"duration_minutes":    "%d мин",
+
+	// Поиск
+	"search_usage": "Использование: /search [текст] [status:open|in_progress|closed] [priority:low|normal|high|urgent] [user:@имя|ID] [assignee:@имя|имя|ID] [from:ГГГГ-ММ-ДД] [to:ГГГГ-ММ-ДД]\n" +
+		"Нужно указать текст или хотя бы один фильтр.",
+	"error_search":       "❌ Ошибка при поиске обращений",
+	"search_empty":       "🔍 Ничего не найдено",
+	"search_header":      "🔍 Найдено обращений: %d (страница %d из %d)\n",
+	"search_result_user": "👤 %s · 🕒 %s",
+	"search_expired":     "Результаты поиска устарели, повторите /search",
+	"btn_prev_page":      "← Назад",
+	"btn_next_page":      "Далее →",
+
+	// Выгрузка переписки
+	"btn_export":                     "📥 %s",
+	"export_usage":                   "Использование: /export [номер обращения] [html|json|txt]\nВ теме обращения номер можно не указывать.",
+	"error_export":                   "❌ Ошибка при выгрузке переписки",
+	"transcript_caption":             "📄 Переписка по обращению #%d",
+	"transcript_title":               "Обращение #%d",
+	"transcript_subject":             "Тема",
+	"transcript_user":                "Пользователь",
+	"transcript_created":             "Создано",
+	"transcript_status":              "Статус",
+	"transcript_assignee":            "Ответственный",
+	"transcript_closed":              "Закрыто",
+	"transcript_archived":            "Переписка в архиве с",
+	"transcript_exported":            "Выгружено",
+	"transcript_status_changes":      "История статусов",
+	"transcript_status_change":       "%s: %s → %s (%s)",
+	"transcript_messages":            "Переписка",
+	"transcript_no_messages":         "Сообщений нет",
+	"transcript_note":                "🔒 Заметка (%s)",
+	"transcript_attachment":          "📎 %s, file_id: %s",
+	"transcript_customer_attachment": "📎 %s",
+	"transcript_support":             "Поддержка",
+
+	// Блокировки и ограничение частоты
+	"block_usage":                "Использование: /block [ID пользователя] [срок: 30m, 12h, 7d] [причина]\nВ теме обращения ID можно не указывать.",
+	"unblock_usage":              "Использование: /unblock [ID пользователя]\nВ теме обращения ID можно не указывать.",
+	"block_self":                 "Нельзя заблокировать себя или бота",
+	"error_block":                "❌ Ошибка при изменении блокировки",
+	"blocked":                    "🚫 Пользователь %d заблокирован",
+	"blocked_user":               "⛔ Вы не можете писать в поддержку",
+	"blocked_until":              " до %s",
+	"blocked_forever":            " бессрочно",
+	"blocked_reason":             "\nПричина: %s",
+	"not_blocked":                "Пользователь %d не заблокирован",
+	"unblocked":                  "✅ Пользователь %d разблокирован",
+	"rate_limited_messages":      "⏳ Вы отправляете слишком много сообщений. Сообщения не доставляются, подождите %s.",
+	"rate_limited_tickets":       "⏳ Вы создаёте слишком много обращений. Попробуйте снова через %s.",
+	"rate_limited_topic":         "⚠️ Пользователь превысил лимит сообщений (%d за %s), новые сообщения временно не пересылаются",
+	"rate_limited_tickets_topic": "⚠️ Пользователь превысил лимит новых обращений (%d за %s), новые обращения временно не создаются",
+
+	// Архивация
+	"retention_header":        "🗄 Архивация от %s\n\n📦 Обращений в архиве: %d\n",
+	"retention_deleted":       "💬 Удалено сообщений из БД: %d\n",
+	"retention_line":          "• #%d — %d сообщ. → %s\n",
+	"retention_errors":        "\n⚠️ Ошибок: %d\n",
+	"retention_error_dir":     "каталог архива: %v",
+	"retention_error_list":    "выборка обращений: %v",
+	"retention_error_history": "чтение истории: %v",
+	"retention_error_edits":   "чтение правок: %v",
+	"retention_error_write":   "запись архива: %v",
+	"retention_error_delete":  "удаление из БД: %v",
+	"and_more":                "… и ещё %d\n",
+
+	// Приоритет
+	"priority_low":                "низкий",
+	"priority_normal":             "обычный",
+	"priority_high":               "высокий",
+	"priority_urgent":             "срочный",
+	"card_priority":               "\n⚡ Приоритет: %s",
+	"btn_priority_down":           "⬇️ %s",
+	"btn_priority_up":             "⬆️ %s",
+	"btn_urgency_low":             "🐢 Не срочно",
+	"btn_urgency_high":            "⚡ Срочно",
+	"urgency_set":                 "\n\nСрочность: %s",
+	"priority_escalated_topic":    "🔥 Приоритет повышен до «%s» (%s)",
+	"priority_escalated_assignee": "\n%s, обратите внимание",
+	"priority_changed_topic":      "⚡ Приоритет изменён: %s → %s (%s)",
+	"priority_set":                "Приоритет обращения #%d: %s",
+	"priority_current":            "⚡ Приоритет обращения #%d: %s",
+	"priority_usage":              "Использование: /priority low|normal|high|urgent",
+	"error_priority":              "❌ Ошибка при изменении приоритета",
+	"queue_usage":                 "Использование: /queue [фильтры как у /search]\nПоказывает незакрытые обращения: сначала срочные, среди равных — старые.",
+
+	// Восстановление тем
+	"topic_restored":      "♻️ Тема обращения восстановлена. Ниже — сохранённая переписка (сообщений: %d)",
+	"replay_header":       "🗂 %s, %s:\n\n",
+	"repair_usage":        "Использование: /repair [номер обращения [force]]\nБез номера восстанавливаются темы всех обращений, оставшихся без темы. Существующую тему заменяет только force.",
+	"repair_done":         "♻️ Восстановлено тем: %d, ошибок: %d",
+	"repair_ticket_done":  "♻️ Тема обращения #%d создана заново: %s",
+	"repair_failed":       "❌ Не удалось восстановить тему обращения #%d: %s",
+	"repair_topic_exists": "ℹ️ Тема обращения #%d на месте: %s\nЧтобы всё равно создать новую, отправьте /repair %d force",
+
+	// Очередь отправки
+	"delivery_failed_user":  "❗️ Сообщение пользователю не доставлено (попыток: %d)\nОшибка: %s\n\n%s",
+	"delivery_failed_topic": "❗️ Сообщение пользователя не удалось переслать в тему (попыток: %d)\nОшибка: %s\n\n%s",
+}
@@ -1,190 +1,324 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"gopkg.in/telebot.v3"
 	_ "modernc.org/sqlite"
 )
 
-const (
-	SupportGroupLink = "https://t.me/+d9t6S8-8iy1hOTli"
-	SupportGroupID   = -1002574381342
-	MaxMessagesLimit = 4000
-)
-
 type Ticket struct {
-	ID        int64
-	UserID    int64
-	UserName  string
-	Title     string
-	Message   string
-	CreatedAt string
-	Status    string
-	ThreadID  int
+	ID         int64  `json:"id"`
+	UserID     int64  `json:"user_id"`
+	UserName   string `json:"user_name"`
+	Title      string `json:"title"`
+	Message    string `json:"message"`
+	CreatedAt  string `json:"created_at"`
+	Status     string `json:"status"`
+	ThreadID   int    `json:"thread_id"`
+	ClosedAt   string `json:"closed_at,omitempty"`
+	ArchivedAt string `json:"archived_at,omitempty"`
+
+	UserFullName  string `json:"user_full_name"`
+	CardMessageID int    `json:"card_message_id"`
+	AssigneeID    int64  `json:"assignee_id,omitempty"`
+	AssigneeName  string `json:"assignee_name,omitempty"`
+	// Когда пользователю отправлено предупреждение об автозакрытии
+	StaleWarnedAt string `json:"stale_warned_at,omitempty"`
+	Priority      string `json:"priority"`
+	// Приоритет выставлен поддержкой, и пользователь его не меняет
+	PrioritySetBySupport bool `json:"priority_set_by_support,omitempty"`
 }
 
 type TicketMessage struct {
-	ID        int64
-	TicketID  int64
-	MessageID int
-	UserID    int64
-	UserName  string
-	Text      string
-	Date      string
-	IsSupport bool
-}
-
-var (
-	db  *sql.DB
-	bot *telebot.Bot
-)
+	ID        int64  `json:"id"`
+	TicketID  int64  `json:"ticket_id"`
+	MessageID int    `json:"message_id"`
+	UserID    int64  `json:"user_id"`
+	UserName  string `json:"user_name"`
+	Text      string `json:"text"`
+	Date      string `json:"date"`
+	IsSupport bool   `json:"is_support"`
+	MediaType string `json:"media_type,omitempty"`
+	FileID    string `json:"file_id,omitempty"`
+
+	// Внутренняя заметка агентов, клиенту не показывается
+	IsInternal bool `json:"is_internal,omitempty"`
+	// Когда сообщение последний раз редактировалось
+	EditedAt string `json:"edited_at,omitempty"`
+}
+
+// StatusChange — запись о смене статуса обращения.
+type StatusChange struct {
+	ID            int64  `json:"id"`
+	TicketID      int64  `json:"ticket_id"`
+	FromStatus    string `json:"from_status"`
+	ToStatus      string `json:"to_status"`
+	ChangedByID   int64  `json:"changed_by_id"`
+	ChangedByName string `json:"changed_by_name"`
+	IsSupport     bool   `json:"is_support"`
+	Date          string `json:"date"`
+}
 
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.Println("=== ЗАПУСК БОТА ПОДДЕРЖКИ ===")
 
-	if err := initDB(); err != nil {
+	configPath := flag.String("config", "", "путь к файлу конфигурации (по умолчанию "+DefaultConfigPath+")")
+	flag.Parse()
+
+	var (
+		cfg *Config
+		err error
+	)
+	if *configPath != "" {
+		cfg, err = loadConfig(*configPath, true)
+	} else {
+		cfg, err = loadConfig(DefaultConfigPath, false)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store, err := openStore(cfg)
+	if err != nil {
 		log.Fatalf("Ошибка инициализации БД: %v", err)
 	}
-	defer db.Close()
 
-	token := os.Getenv("TELEGRAM_BOT_TOKEN")
-	if token == "" {
-		log.Fatal("Укажите TELEGRAM_BOT_TOKEN в переменных окружения")
+	bot, svc, err := startBot(cfg, store)
+	if err != nil {
+		store.Close()
+		log.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	served := make(chan struct{})
+	var serveErr error
+	go func() {
+		serveErr = serve(bot, stop)
+		close(served)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	log.Println("=== БОТ ГОТОВ К РАБОТЕ ===")
+	select {
+	case sig := <-signals:
+		log.Printf("Получен сигнал %s, завершение работы (не дольше %s)", sig, cfg.ShutdownTimeout)
+	case <-served:
+		log.Printf("Приём обновлений остановлен: %v, завершение работы (не дольше %s)", serveErr, cfg.ShutdownTimeout)
+	}
+	signal.Stop(signals)
+
+	if err := svc.shutdown(stop, served, cfg.ShutdownTimeout.Duration); err != nil {
+		log.Printf("Предупреждение: %v", err)
+	}
+
+	// serveErr можно читать только после закрытия served: если приём
+	// обновлений не остановился за отведённое время, serve ещё работает
+	// и запишет его позже, а выход считается неудачным
+	failed := true
+	select {
+	case <-served:
+		failed = serveErr != nil
+	default:
+	}
+
+	if err := store.Close(); err != nil {
+		log.Printf("Ошибка закрытия БД: %v", err)
+	}
+	log.Println("=== БОТ ОСТАНОВЛЕН ===")
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// startBot подключается к Bot API, проверяет группу поддержки, регистрирует
+// обработчики и запускает фоновые задачи. Обновления начинает принимать
+// serve.
+func startBot(cfg *Config, store Store) (*telebot.Bot, *Service, error) {
+	var poller telebot.Poller = &telebot.LongPoller{Timeout: cfg.PollTimeout.Duration}
+	if cfg.Mode == ModeWebhook {
+		poller = NewWebhookPoller(cfg.Webhook)
 	}
 
 	pref := telebot.Settings{
-		Token:   token,
-		Poller:  &telebot.LongPoller{Timeout: 10 * time.Second},
+		URL:     cfg.APIURL,
+		Token:   cfg.BotToken,
+		Poller:  poller,
 		OnError: func(err error, c telebot.Context) { log.Printf("Ошибка: %v", err) },
 		Verbose: true,
+		// Обработчики запускает в горутинах trackHandler
+		Synchronous: true,
 	}
 
-	var err error
-	bot, err = telebot.NewBot(pref)
+	bot, err := telebot.NewBot(pref)
 	if err != nil {
-		log.Panic(err)
+		return nil, nil, fmt.Errorf("ошибка подключения к Bot API: %v", err)
 	}
 
-	log.Printf("Бот @%s запущен", bot.Me.Username)
+	log.Printf("Бот @%s запущен (режим: %s)", bot.Me.Username, cfg.Mode)
 
-	if err := verifyGroupAccess(); err != nil {
-		log.Printf("Предупреждение: %v", err)
+	if cfg.Mode == ModePolling {
+		// getUpdates не работает, пока у бота зарегистрирован webhook
+		if err := bot.RemoveWebhook(); err != nil {
+			log.Printf("Ошибка удаления webhook: %v", err)
+		}
 	}
 
-	registerHandlers()
+	svc := NewService(bot, bot.Me, store, cfg)
+	if err := svc.verifyGroupAccess(); err != nil {
+		return nil, nil, err
+	}
 
-	log.Println("=== БОТ ГОТОВ К РАБОТЕ ===")
-	bot.Start()
-}
+	svc.registerHandlers(bot)
 
-func initDB() error {
-	var err error
-	db, err = sql.Open("sqlite", "file:support.db?cache=shared")
-	if err != nil {
-		return err
+	if cfg.Retention.Enabled {
+		svc.startRetentionScheduler(cfg.Retention)
+	}
+	if cfg.AutoClose.Enabled {
+		svc.startAutoCloseScheduler(cfg.AutoClose)
 	}
+	if cfg.TopicRepair.Enabled {
+		svc.startTopicRepairScheduler(cfg.TopicRepair)
+	}
+	svc.startPeriodic(cfg.Outbox.Interval.Duration, svc.deliverOutbox)
+	return bot, svc, nil
+}
 
-	_, err = db.Exec(`
-	CREATE TABLE IF NOT EXISTS tickets (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user_id INTEGER NOT NULL,
-		user_name TEXT NOT NULL,
-		title TEXT NOT NULL,
-		message TEXT NOT NULL,
-		created_at TEXT NOT NULL,
-		status TEXT NOT NULL DEFAULT 'open',
-		thread_id INTEGER DEFAULT 0
-	);
-	CREATE TABLE IF NOT EXISTS ticket_messages (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		ticket_id INTEGER NOT NULL,
-		message_id INTEGER NOT NULL,
-		user_id INTEGER NOT NULL,
-		user_name TEXT NOT NULL,
-		text TEXT NOT NULL,
-		date TEXT NOT NULL,
-		is_support BOOLEAN NOT NULL DEFAULT FALSE,
-		FOREIGN KEY(ticket_id) REFERENCES tickets(id)
-	);
-	CREATE INDEX IF NOT EXISTS idx_ticket_messages_ticket_id ON ticket_messages(ticket_id);
-	`)
+// openStore открывает хранилище, выбранное в конфигурации.
+func openStore(cfg *Config) (Store, error) {
+	var (
+		store *SQLStore
+		err   error
+	)
+	switch cfg.DBDriver {
+	case DriverPostgres:
+		store, err = NewPostgresStore(cfg.DBDSN)
+	default:
+		store, err = NewSQLiteStore(cfg.DBPath)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	go checkMessagesLimit()
-	return nil
+	return store, nil
 }
 
-func checkMessagesLimit() {
-	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM ticket_messages").Scan(&count)
+// verifyGroupAccess проверяет, что настроенная группа поддержки существует,
+// является форумом и бот обладает нужными правами администратора.
+// Все найденные проблемы возвращаются одной ошибкой.
+func (s *Service) verifyGroupAccess() error {
+	cfgErr := &ConfigError{}
+
+	chat, err := s.bot.ChatByID(s.cfg.SupportGroupID)
 	if err != nil {
-		log.Printf("Ошибка проверки количества сообщений: %v", err)
-		return
-	}
-
-	if count > MaxMessagesLimit {
-		excess := count - MaxMessagesLimit
-		_, err = db.Exec(`
-			DELETE FROM ticket_messages 
-			WHERE id IN (
-				SELECT id FROM ticket_messages 
-				ORDER BY date ASC 
-				LIMIT ?
-			)`, excess)
-		if err != nil {
-			log.Printf("Ошибка удаления старых сообщений: %v", err)
-		}
+		cfgErr.add("support_group_id: группа %d недоступна боту: %v", s.cfg.SupportGroupID, err)
+		return cfgErr
+	}
+
+	if chat.Type != telebot.ChatSuperGroup {
+		cfgErr.add("support_group_id: чат %d не является супергруппой (тип %s)", chat.ID, chat.Type)
 	}
-}
 
-func verifyGroupAccess() error {
-	chat, err := bot.ChatByID(SupportGroupID)
+	isForum, err := s.isForumChat(s.cfg.SupportGroupID)
 	if err != nil {
-		return fmt.Errorf("ошибка получения чата: %v", err)
+		cfgErr.add("support_group_id: не удалось проверить режим тем: %v", err)
+	} else if !isForum {
+		cfgErr.add("support_group_id: в группе %q не включены темы", chat.Title)
 	}
 
-	member, err := bot.ChatMemberOf(chat, bot.Me)
+	member, err := s.bot.ChatMemberOf(chat, s.me)
 	if err != nil {
-		return fmt.Errorf("ошибка проверки прав: %v", err)
+		cfgErr.add("support_group_id: ошибка проверки прав: %v", err)
+		return cfgErr
 	}
 
-	if !member.CanManageTopics {
-		return fmt.Errorf("бот не может управлять темами")
+	if member.Role != telebot.Administrator && member.Role != telebot.Creator {
+		cfgErr.add("support_group_id: бот не является администратором группы %q", chat.Title)
+	} else {
+		if !member.CanManageTopics {
+			cfgErr.add("support_group_id: бот не может управлять темами")
+		}
+		if !member.CanPinMessages {
+			log.Printf("Предупреждение: бот не может закреплять сообщения в группе поддержки")
+		}
 	}
 
+	if len(cfgErr.Problems) > 0 {
+		return cfgErr
+	}
 	return nil
 }
 
-func registerHandlers() {
-	bot.Handle("/start", handleStart)
-	bot.Handle("/help", handleHelp)
-	bot.Handle("/mytickets", handleMyTickets)
-	bot.Handle("/history", handleHistoryCommand)
+func (s *Service) isForumChat(chatID int64) (bool, error) {
+	resp, err := s.bot.Raw("getChat", map[string]interface{}{"chat_id": chatID})
+	if err != nil {
+		return false, err
+	}
+
+	var result struct {
+		Result struct {
+			IsForum bool `json:"is_forum"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return false, fmt.Errorf("ошибка парсинга ответа: %v", err)
+	}
+	return result.Result.IsForum, nil
+}
+
+// registerHandlers подключает обработчики сервиса к боту b.
+func (s *Service) registerHandlers(b *telebot.Bot) {
+	b.Use(s.trackHandler)
+
+	b.Handle("/start", s.handleStart)
+	b.Handle("/help", s.handleHelp)
+	b.Handle("/mytickets", s.handleMyTickets)
+	b.Handle("/history", s.handleHistoryCommand)
+
+	b.Handle("/assign", s.handleAssignCommand)
+	b.Handle("/unassign", s.handleUnassignCommand)
+	b.Handle("/assignments", s.handleAssignmentsCommand)
+	b.Handle(noteCommand, s.handleNoteCommand)
+	b.Handle("/reopen", s.handleReopenCommand)
+	b.Handle("/csat", s.handleRatingReportCommand)
+	b.Handle("/search", s.handleSearchCommand)
+	b.Handle("/export", s.handleExportCommand)
+	b.Handle("/block", s.handleBlockCommand)
+	b.Handle("/unblock", s.handleUnblockCommand)
+	b.Handle("/repair", s.handleRepairCommand)
+	b.Handle("/priority", s.handlePriorityCommand)
+	b.Handle("/queue", s.handleQueueCommand)
+
+	b.Handle("/language", s.handleLanguageCommand)
 
-	bot.Handle(&telebot.Btn{Text: "Новое обращение"}, handleNewTicketButton)
-	bot.Handle(&telebot.Btn{Text: "Закрыть обращение"}, handleCloseTicketButton)
-	bot.Handle(&telebot.Btn{Text: "Мои обращения"}, handleMyTicketsButton)
+	registerButton(b, "btn_new_ticket", s.handleNewTicketButton)
+	registerButton(b, "btn_close_ticket", s.handleCloseTicketButton)
+	registerButton(b, "btn_my_tickets", s.handleMyTicketsButton)
 
-	bot.Handle(telebot.OnCallback, handleCallbacks)
-	bot.Handle(telebot.OnText, handleTextMessages)
+	b.Handle(telebot.OnCallback, s.handleCallbacks)
+	b.Handle(telebot.OnText, s.handleTextMessages)
+	b.Handle(telebot.OnMedia, s.handleMediaMessages)
+	b.Handle(telebot.OnEdited, s.handleEditedMessage)
 }
 
-func showUserMenu(c telebot.Context) error {
+func (s *Service) showUserMenu(c telebot.Context) error {
+	lang := s.userLanguage(c.Sender())
 	menu := &telebot.ReplyMarkup{}
-	btnNew := menu.Text("Новое обращение")
-	btnClose := menu.Text("Закрыть обращение")
-	btnHistory := menu.Text("Мои обращения")
+	btnNew := menu.Text(tr(lang, "btn_new_ticket"))
+	btnClose := menu.Text(tr(lang, "btn_close_ticket"))
+	btnHistory := menu.Text(tr(lang, "btn_my_tickets"))
 
 	menu.Reply(
 		menu.Row(btnNew),
@@ -192,112 +326,115 @@ func showUserMenu(c telebot.Context) error {
 		menu.Row(btnHistory),
 	)
 
-	return c.Send("Выберите действие:", menu)
+	return s.send(c, tr(lang, "choose_action"), menu)
 }
 
-func handleStart(c telebot.Context) error {
-	msg := "🛠️ Добро пожаловать в поддержку!\n\n" +
-		"Вы можете создать новое обращение или просмотреть историю предыдущих."
-
-	if err := c.Send(msg); err != nil {
+func (s *Service) handleStart(c telebot.Context) error {
+	if rejected, err := s.rejectBlockedUser(c); rejected {
+		return err
+	}
+	if err := s.send(c, tr(s.userLanguage(c.Sender()), "welcome")); err != nil {
 		return err
 	}
-	return showUserMenu(c)
+	return s.showUserMenu(c)
 }
 
-func handleHelp(c telebot.Context) error {
-	return c.Send(
-		"ℹ️ Как использовать бота:\n\n" +
-			"1. Нажмите 'Новое обращение' для создания запроса\n" +
-			"2. Бот создаст тему в группе поддержки\n" +
-			"3. Все ваши последующие сообщения будут добавляться в эту тему\n" +
-			"4. Администраторы ответят в теме\n\n" +
-			"Группа поддержки: " + SupportGroupLink,
-	)
+func (s *Service) handleHelp(c telebot.Context) error {
+	if rejected, err := s.rejectBlockedUser(c); rejected {
+		return err
+	}
+	lang := s.userLanguage(c.Sender())
+	return s.send(c, tr(lang, "help", tr(lang, "btn_new_ticket"), s.cfg.SupportGroupLink))
 }
 
-func handleNewTicketButton(c telebot.Context) error {
+func (s *Service) handleNewTicketButton(c telebot.Context) error {
+	if rejected, err := s.rejectBlockedUser(c); rejected {
+		return err
+	}
 	user := c.Sender()
-	openTicket, err := getOpenUserTicket(user.ID)
-	if err != nil && err != sql.ErrNoRows {
+	lang := s.userLanguage(user)
+	openTicket, err := s.store.GetOpenUserTicket(user.ID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
 		log.Printf("Ошибка проверки тикетов: %v", err)
-		return c.Send("❌ Ошибка при обработке запроса")
+		return s.send(c, tr(lang, "error_request"))
 	}
 
 	if openTicket != nil {
 		if openTicket.Status == "closed" {
-			return c.Send("Ваше предыдущее обращение уже закрыто. Отправьте сообщение с описанием проблемы для создания нового.")
+			return s.send(c, tr(lang, "previous_closed", tr(lang, "btn_my_tickets")))
 		}
-		return c.Send(fmt.Sprintf(
-			"❌ У вас уже есть активное обращение #%d\n\n"+
-				"Пожалуйста, дождитесь ответа поддержки или закройте текущее обращение.",
-			openTicket.ID))
+		return s.send(c, tr(lang, "already_open", openTicket.ID))
 	}
 
-	return c.Send("Отправьте сообщение с описанием проблемы для создания нового обращения.")
+	return s.send(c, tr(lang, "describe_problem"))
 }
 
-func handleCloseTicketButton(c telebot.Context) error {
+func (s *Service) handleCloseTicketButton(c telebot.Context) error {
+	if rejected, err := s.rejectBlockedUser(c); rejected {
+		return err
+	}
 	user := c.Sender()
-	openTicket, err := getOpenUserTicket(user.ID)
+	lang := s.userLanguage(user)
+	openTicket, err := s.store.GetOpenUserTicket(user.ID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return c.Send("У вас нет активных обращений для закрытия.")
+		if errors.Is(err, ErrNotFound) {
+			return s.send(c, tr(lang, "no_open_to_close"))
 		}
 		log.Printf("Ошибка проверки тикетов: %v", err)
-		return c.Send("❌ Ошибка при обработке запроса")
+		return s.send(c, tr(lang, "error_request"))
 	}
 
 	if openTicket.Status == "closed" {
-		return c.Send("Это обращение уже закрыто.")
+		return s.send(c, tr(lang, "already_closed"))
 	}
 
-	if err := updateTicketStatus(openTicket.ID, "closed"); err != nil {
+	prevStatus := openTicket.Status
+	if err := s.changeTicketStatus(openTicket, "closed", user, false); err != nil {
 		log.Printf("Ошибка обновления статуса: %v", err)
-		return c.Send("❌ Ошибка при закрытии обращения")
+		return s.send(c, tr(lang, "error_closing"))
 	}
+	s.refreshTicketViews(openTicket, prevStatus, nil)
 
-	text := fmt.Sprintf(
-		"⚠️ Обращение #%d закрыто пользователем\n\n"+
-			"👤 Пользователь: @%s\n"+
-			"🕒 Время закрытия: %s",
+	text := tr(s.supportLanguage(), "closed_by_user",
 		openTicket.ID,
 		user.Username,
-		time.Now().Format("2006-01-02 15:04:05"),
+		time.Now().Format(DateTimeLayout),
 	)
 
-	if _, err := bot.Send(
-		telebot.ChatID(SupportGroupID),
-		text,
-		&telebot.SendOptions{ThreadID: openTicket.ThreadID},
-	); err != nil {
-		log.Printf("Ошибка отправки уведомления в группу: %v", err)
-	}
+	s.notifyTopic(openTicket, text)
 
-	return c.Send(fmt.Sprintf("✅ Обращение #%d успешно закрыто.", openTicket.ID))
+	if err := s.send(c, tr(lang, "closed_success", openTicket.ID)); err != nil {
+		return err
+	}
+	s.sendSatisfactionSurvey(openTicket)
+	return nil
 }
 
-func handleHistoryCommand(c telebot.Context) error {
-	return showTicketHistory(c.Sender().ID, c)
+func (s *Service) handleHistoryCommand(c telebot.Context) error {
+	return s.handleMyTickets(c)
 }
 
-func handleMyTicketsButton(c telebot.Context) error {
-	return handleMyTickets(c)
+func (s *Service) handleMyTicketsButton(c telebot.Context) error {
+	return s.handleMyTickets(c)
 }
 
-func handleMyTickets(c telebot.Context) error {
-	return showTicketHistory(c.Sender().ID, c)
+func (s *Service) handleMyTickets(c telebot.Context) error {
+	if rejected, err := s.rejectBlockedUser(c); rejected {
+		return err
+	}
+	return s.showTicketHistory(c.Sender().ID, c)
 }
 
-func showTicketHistory(userID int64, c telebot.Context) error {
-	tickets, err := getUserTickets(userID, 10)
+func (s *Service) showTicketHistory(userID int64, c telebot.Context) error {
+	lang := s.userLanguage(c.Sender())
+	tickets, err := s.store.GetUserTickets(userID, 10)
 	if err != nil {
 		log.Printf("Ошибка получения тикетов: %v", err)
-		return c.Send("❌ Ошибка при получении истории обращений")
+		return s.send(c, tr(lang, "error_history_list"))
 	}
 
 	if len(tickets) == 0 {
-		return c.Send("У вас пока нет обращений.")
+		return s.send(c, tr(lang, "no_tickets"))
 	}
 
 	menu := &telebot.ReplyMarkup{}
@@ -312,439 +449,484 @@ func showTicketHistory(userID int64, c telebot.Context) error {
 		}
 
 		btn := menu.Data(
-			fmt.Sprintf("#%d %s - %s %s", t.ID, t.Title, status, t.CreatedAt[:10]),
+			fmt.Sprintf("#%d %s - %s%s %s", t.ID, t.Title, status, priorityMark(t.Priority), t.CreatedAt[:10]),
 			"ticket_"+strconv.FormatInt(t.ID, 10),
 		)
 		rows = append(rows, menu.Row(btn))
 	}
 
-	btnBack := menu.Data("← Назад", "back_to_menu")
+	btnBack := menu.Data(tr(lang, "btn_back"), "back_to_menu")
 	rows = append(rows, menu.Row(btnBack))
 
 	menu.Inline(rows...)
 
-	return c.Send("📋 Ваши последние обращения:", menu)
+	return s.send(c, tr(lang, "your_tickets"), menu)
 }
 
-func handleCallbacks(c telebot.Context) error {
+func (s *Service) handleCallbacks(c telebot.Context) error {
 	data := c.Callback().Data
 
 	// Удаляем возможные специальные символы в начале
 	data = strings.TrimLeft(data, "\f")
 
+	if rejected, err := s.rejectBlockedCallback(c); rejected {
+		return err
+	}
+
+	// Кнопки карточек в группе поддержки не регистрируются через bot.Handle:
+	// ID тикета хранится в самих данных кнопки, поэтому карточки
+	// продолжают работать после перезапуска бота.
 	switch {
 	case strings.HasPrefix(data, "ticket_"):
-		ticketID, err := strconv.ParseInt(strings.TrimPrefix(data, "ticket_"), 10, 64)
-		if err != nil {
-			log.Printf("Ошибка парсинга ID тикета: %v", err)
-			return c.Respond()
+		ticketID, ok := parseCallbackID(data, "ticket_")
+		if !ok {
+			return s.respond(c)
+		}
+		return s.showTicketDetails(c, ticketID)
+	case strings.HasPrefix(data, "attachment_"):
+		messageID, ok := parseCallbackID(data, "attachment_")
+		if !ok {
+			return s.respond(c)
+		}
+		return s.handleAttachmentButton(c, messageID)
+	case strings.HasPrefix(data, "take_btn_"):
+		ticketID, ok := parseCallbackID(data, "take_btn_")
+		if !ok || !s.isSupportGroupCallback(c) {
+			return s.respond(c)
+		}
+		return s.handleTakeButton(c, ticketID)
+	case strings.HasPrefix(data, "close_btn_"):
+		ticketID, ok := parseCallbackID(data, "close_btn_")
+		if !ok || !s.isSupportGroupCallback(c) {
+			return s.respond(c)
+		}
+		return s.handleCloseButton(c, ticketID)
+	case strings.HasPrefix(data, "unassign_btn_"):
+		ticketID, ok := parseCallbackID(data, "unassign_btn_")
+		if !ok || !s.isSupportGroupCallback(c) {
+			return s.respond(c)
+		}
+		return s.handleUnassignButton(c, ticketID)
+	case strings.HasPrefix(data, "priority_btn_"):
+		ticketID, ok := parseCallbackID(data, "priority_btn_")
+		if !ok || !s.isSupportGroupCallback(c) {
+			return s.respond(c)
+		}
+		return s.handlePriorityButton(c, ticketID, data)
+	case strings.HasPrefix(data, "urgency_"):
+		ticketID, ok := parseCallbackID(data, "urgency_")
+		if !ok {
+			return s.respond(c)
+		}
+		return s.handleUrgencyButton(c, ticketID, data)
+	case strings.HasPrefix(data, "reopen_btn_"):
+		ticketID, ok := parseCallbackID(data, "reopen_btn_")
+		if !ok || !s.isSupportGroupCallback(c) {
+			return s.respond(c)
+		}
+		return s.handleReopenButton(c, ticketID)
+	case strings.HasPrefix(data, "reopen_"):
+		ticketID, ok := parseCallbackID(data, "reopen_")
+		if !ok {
+			return s.respond(c)
 		}
-		return showTicketDetails(c, ticketID)
+		return s.handleUserReopenButton(c, ticketID)
+	case strings.HasPrefix(data, "csat_skip_"):
+		ticketID, ok := parseCallbackID(data, "csat_skip_")
+		if !ok {
+			return s.respond(c)
+		}
+		return s.handleSkipCommentButton(c, ticketID)
+	case strings.HasPrefix(data, "csat_"):
+		return s.handleRatingButton(c, data)
+	case strings.HasPrefix(data, "keep_open_"):
+		ticketID, ok := parseCallbackID(data, "keep_open_")
+		if !ok {
+			return s.respond(c)
+		}
+		return s.handleKeepOpenButton(c, ticketID)
+	case strings.HasPrefix(data, "search_"):
+		if !s.isSupportGroupCallback(c) {
+			return s.respond(c)
+		}
+		return s.handleSearchPageButton(c, data)
+	case strings.HasPrefix(data, "export_"):
+		return s.handleExportButton(c, data)
+	case strings.HasPrefix(data, "lang_"):
+		return s.handleLanguageButton(c, strings.TrimPrefix(data, "lang_"))
 	case data == "back_to_menu":
-		return handleBackToMenu(c)
+		return s.handleBackToMenu(c)
 	case data == "back_to_history":
-		return handleMyTickets(c)
+		return s.handleMyTickets(c)
 	}
-	return nil
+	return s.respond(c)
 }
 
-func showTicketDetails(c telebot.Context, ticketID int64) error {
-	ticket, err := getTicket(ticketID)
+// parseCallbackID извлекает числовой ID из данных кнопки вида "<prefix><id>".
+// Telebot может дописать к данным "|payload", он отбрасывается.
+func parseCallbackID(data, prefix string) (int64, bool) {
+	raw := strings.TrimPrefix(data, prefix)
+	if i := strings.IndexByte(raw, '|'); i >= 0 {
+		raw = raw[:i]
+	}
+
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		log.Printf("Ошибка парсинга ID из callback %q: %v", data, err)
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *Service) isSupportGroupCallback(c telebot.Context) bool {
+	msg := c.Callback().Message
+	return msg != nil && msg.Chat != nil && msg.Chat.ID == s.cfg.SupportGroupID
+}
+
+func (s *Service) showTicketDetails(c telebot.Context, ticketID int64) error {
+	lang := s.userLanguage(c.Sender())
+	ticket, err := s.store.GetTicket(ticketID)
 	if err != nil {
 		log.Printf("Ошибка получения тикета: %v", err)
-		return c.Respond(&telebot.CallbackResponse{Text: "Ошибка при получении данных"})
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "error_data")})
 	}
 
 	// Проверяем, принадлежит ли тикет пользователю
 	if ticket.UserID != c.Sender().ID {
-		return c.Respond(&telebot.CallbackResponse{Text: "Это не ваше обращение"})
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "not_your_ticket")})
 	}
 
-	history, err := getTicketHistory(ticketID)
+	history, err := s.store.GetTicketHistory(ticketID)
 	if err != nil {
 		log.Printf("Ошибка получения истории: %v", err)
-		return c.Respond(&telebot.CallbackResponse{Text: "Ошибка при получении истории"})
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "error_history")})
 	}
+	history = customerHistory(history)
 
 	var msg strings.Builder
-	msg.WriteString(fmt.Sprintf(
-		"📋 Обращение #%d\n\n"+
-			"📌 Тема: %s\n"+
-			"🕒 Создано: %s\n"+
-			"🔍 Статус: %s\n\n"+
-			"--- История переписки ---\n\n",
-		ticket.ID, ticket.Title, ticket.CreatedAt, getStatusText(ticket.Status),
-	))
-
-	for _, m := range history {
-		sender := "Вы"
+	msg.WriteString(tr(lang, "ticket_details", ticket.ID, ticket.Title, ticket.CreatedAt, getStatusText(lang, ticket.Status)))
+
+	if ticket.AssigneeID != 0 && ticket.Status != "closed" {
+		msg.WriteString(tr(lang, "handled_by", ticket.AssigneeName))
+	}
+
+	if ticket.ArchivedAt != "" {
+		msg.WriteString(tr(lang, "archived_note", ticket.ArchivedAt))
+	}
+
+	for i, m := range history {
+		sender := tr(lang, "sender_you")
 		if m.IsSupport {
-			sender = fmt.Sprintf("Поддержка (%s)", m.UserName)
+			sender = tr(lang, "sender_support", m.UserName)
+		}
+		date := m.Date
+		if m.EditedAt != "" {
+			date += tr(lang, "edited_mark", m.EditedAt)
 		}
 		msg.WriteString(fmt.Sprintf(
 			"💬 %s [%s]:\n%s\n\n",
-			sender, m.Date, m.Text,
+			sender, date, historyEntryText(lang, m, i+1),
 		))
 	}
 
 	menu := &telebot.ReplyMarkup{}
-	btnBack := menu.Data("← Назад к списку", "back_to_history")
-	menu.Inline(menu.Row(btnBack))
+	rows := attachmentButtons(lang, menu, history)
+	rows = append(rows, exportButtons(lang, menu, ticket.ID))
+	if ticket.Status == "closed" {
+		rows = append(rows, menu.Row(menu.Data(tr(lang, "btn_resume"), fmt.Sprintf("reopen_%d", ticket.ID))))
+	}
+	btnBack := menu.Data(tr(lang, "btn_back_to_list"), "back_to_history")
+	rows = append(rows, menu.Row(btnBack))
+	menu.Inline(rows...)
 
 	// Отправляем новое сообщение с историей вместо редактирования
-	_, err = bot.Send(
+	_, err = s.bot.Send(
 		c.Sender(),
 		msg.String(),
 		&telebot.SendOptions{ReplyMarkup: menu},
 	)
 	if err != nil {
 		log.Printf("Ошибка отправки истории: %v", err)
-		return c.Respond(&telebot.CallbackResponse{Text: "Ошибка при отправке истории"})
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "error_send_history")})
 	}
 
-	return c.Respond()
+	return s.respond(c)
 }
 
-func handleBackToMenu(c telebot.Context) error {
-	return showUserMenu(c)
+func (s *Service) handleBackToMenu(c telebot.Context) error {
+	return s.showUserMenu(c)
 }
 
-func handleTextMessages(c telebot.Context) error {
+func (s *Service) handleTextMessages(c telebot.Context) error {
 	if strings.HasPrefix(c.Text(), "/") {
 		return nil
 	}
 
 	if c.Chat().Type == telebot.ChatPrivate {
-		return handleUserMessage(c)
+		return s.handleUserMessage(c)
 	}
 
-	if c.Chat().ID == SupportGroupID {
-		return handleSupportGroupMessage(c)
+	if c.Chat().ID == s.cfg.SupportGroupID {
+		return s.handleSupportGroupMessage(c)
 	}
 
 	return nil
 }
 
-func handleUserMessage(c telebot.Context) error {
+func (s *Service) handleUserMessage(c telebot.Context) error {
+	if rejected, err := s.rejectBlockedUser(c); rejected {
+		return err
+	}
+	if handled, err := s.handleRatingComment(c); handled {
+		return err
+	}
+
 	user := c.Sender()
-	openTicket, err := getOpenUserTicket(user.ID)
-	if err != nil && err != sql.ErrNoRows {
+	lang := s.userLanguage(user)
+	openTicket, err := s.store.GetOpenUserTicket(user.ID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
 		log.Printf("Ошибка проверки тикетов: %v", err)
-		return c.Send("❌ Ошибка при обработке сообщения")
+		return s.send(c, tr(lang, "error_message"))
 	}
 
 	if openTicket == nil {
-		return createNewTicket(c)
+		if throttled, err := s.throttleTicketCreation(c); throttled {
+			return err
+		}
+		return s.createNewTicket(c)
 	}
 
 	if openTicket.Status == "closed" {
-		return c.Send("❌ Ваше обращение уже закрыто. Нажмите 'Новое обращение' для создания нового.")
+		return s.send(c, tr(lang, "closed_use_new", tr(lang, "btn_new_ticket")))
 	}
 
-	return forwardToExistingTicket(c, openTicket)
+	if throttled, err := s.throttleMessage(c, openTicket); throttled {
+		return err
+	}
+	return s.forwardToExistingTicket(c, openTicket)
 }
 
-func createNewTicket(c telebot.Context) error {
+func (s *Service) createNewTicket(c telebot.Context) error {
 	user := c.Sender()
+	lang := s.userLanguage(user)
 	msg := c.Message()
 
 	ticket := Ticket{
-		UserID:    user.ID,
-		UserName:  user.Username,
-		Title:     fmt.Sprintf("Обращение от %s", user.FirstName),
-		Message:   msg.Text,
-		CreatedAt: time.Now().Format("2006-01-02 15:04:05"),
-		Status:    "open",
+		UserID:       user.ID,
+		UserName:     user.Username,
+		UserFullName: strings.TrimSpace(user.FirstName + " " + user.LastName),
+		Title:        tr(lang, "ticket_title", user.FirstName),
+		Message:      s.messageSummary(msg),
+		CreatedAt:    time.Now().Format(DateTimeLayout),
+		Status:       "open",
+		Priority:     PriorityNormal,
 	}
 
-	ticketID, err := createTicket(ticket)
+	ticketID, err := s.store.CreateTicket(ticket)
 	if err != nil {
 		log.Printf("Ошибка создания тикета: %v", err)
-		return c.Send("❌ Ошибка при создании обращения")
+		return s.send(c, tr(lang, "error_create"))
 	}
+	ticket.ID = ticketID
 
-	if err := sendToSupportGroup(ticketID, ticket, msg); err != nil {
-		log.Printf("Ошибка отправки в группу: %v", err)
-		return c.Send(fmt.Sprintf(
-			"⚠️ Не удалось создать тему в группе.\nСвяжитесь с администратором: %s",
-			SupportGroupLink))
+	// История сохраняется до создания темы: если тему создать не удастся,
+	// переписку перенесут в тему при её восстановлении
+	if err := s.saveMessage(newTicketMessage(ticketID, msg, false)); err != nil {
+		log.Printf("Ошибка сохранения сообщения в историю: %v", err)
 	}
 
-	if err := saveMessageToHistory(ticketID, msg.ID, user.ID, user.Username, msg.Text, false); err != nil {
-		log.Printf("Ошибка сохранения сообщения в историю: %v", err)
+	if err := s.sendToSupportGroup(&ticket, msg); err != nil {
+		log.Printf("Ошибка отправки в группу: %v", err)
+		return s.send(c, tr(lang, "topic_failed", ticketID, s.cfg.SupportGroupLink))
 	}
 
-	if err := c.Send(fmt.Sprintf(
-		"✅ Обращение #%d создано!\n\n"+
-			"Администраторы ответят в группе поддержки:\n%s\n\n"+
-			"Все ваши последующие сообщения будут добавляться в эту тему.",
-		ticketID, SupportGroupLink)); err != nil {
+	if err := s.send(c, tr(lang, "ticket_created", ticketID, s.cfg.SupportGroupLink), urgencyMarkup(lang, ticketID)); err != nil {
 		return err
 	}
 
-	return showUserMenu(c)
+	return s.showUserMenu(c)
 }
 
-func forwardToExistingTicket(c telebot.Context, ticket *Ticket) error {
+func (s *Service) forwardToExistingTicket(c telebot.Context, ticket *Ticket) error {
 	user := c.Sender()
+	lang := s.userLanguage(user)
 	msg := c.Message()
 
-	_, err := db.Exec(
-		`UPDATE tickets SET message = ? WHERE id = ?`,
-		msg.Text, ticket.ID,
-	)
-	if err != nil {
+	if err := s.store.UpdateTicketMessage(ticket.ID, s.messageSummary(msg)); err != nil {
 		log.Printf("Ошибка обновления тикета: %v", err)
-		return c.Send("❌ Ошибка при обработке сообщения")
+		return s.send(c, tr(lang, "error_message"))
 	}
+	s.resetStaleWarning(ticket)
 
-	if err := saveMessageToHistory(ticket.ID, msg.ID, user.ID, user.Username, msg.Text, false); err != nil {
+	if err := s.saveMessage(newTicketMessage(ticket.ID, msg, false)); err != nil {
 		log.Printf("Ошибка сохранения сообщения в историю: %v", err)
 	}
 
-	text := fmt.Sprintf(
-		"📨 Новое сообщение по обращению #%d\n\n"+
-			"👤 От: %s %s (@%s)\n"+
-			"🆔 ID: %d\n\n"+
-			"📝 Сообщение:\n%s",
+	// Без темы сообщение попало бы в общий чат группы. Оно уже в истории
+	// и придёт в новую тему вместе с остальной перепиской.
+	if ticket.ThreadID == 0 {
+		if err := s.repairTicketTopic(ticket, 0); err != nil {
+			log.Printf("Ошибка восстановления темы обращения #%d: %v", ticket.ID, err)
+		}
+		return s.send(c, tr(lang, "message_added", ticket.ID))
+	}
+
+	header := tr(s.supportLanguage(), "new_message_header",
 		ticket.ID,
 		user.FirstName,
 		user.LastName,
 		user.Username,
 		user.ID,
-		msg.Text,
 	)
 
-	_, err = bot.Send(
-		telebot.ChatID(SupportGroupID),
-		text,
-		&telebot.SendOptions{ThreadID: ticket.ThreadID},
-	)
-	if err != nil {
+	out := relayOutbox(ticket.ID, s.cfg.SupportGroupID, msg, header)
+	out.ThreadID = ticket.ThreadID
+	if target := s.topicReplyTarget(ticket.ID, msg); target != nil {
+		out.ReplyTo = target.ID
+	}
+	// Отложенное сообщение дойдёт позже, пользователю об этом знать не нужно
+	_, deferred, err := s.enqueue(out)
+	switch {
+	case err != nil && topicGone(err):
+		if err := s.repairTicketTopic(ticket, 0); err != nil {
+			log.Printf("Ошибка восстановления темы обращения #%d: %v", ticket.ID, err)
+		}
+	case err != nil && !deferred:
 		log.Printf("Ошибка отправки сообщения в тему: %v", err)
-		return c.Send("❌ Не удалось отправить сообщение в группу поддержки")
+		return s.send(c, tr(lang, "error_relay"))
 	}
 
-	return c.Send("✅ Ваше сообщение добавлено к обращению #" + strconv.FormatInt(ticket.ID, 10))
+	return s.send(c, tr(lang, "message_added", ticket.ID))
 }
 
-func handleSupportGroupMessage(c telebot.Context) error {
-	if c.Chat().ID != SupportGroupID || c.Sender().ID == bot.Me.ID || c.Message().ThreadID == 0 || c.Message().IsService() {
+func (s *Service) handleSupportGroupMessage(c telebot.Context) error {
+	if c.Chat().ID != s.cfg.SupportGroupID || c.Sender().ID == s.me.ID || c.Message().ThreadID == 0 || c.Message().IsService() {
 		return nil
 	}
 
-	var ticketID int64
-	err := db.QueryRow(
-		`SELECT id FROM tickets WHERE thread_id = ?`,
-		c.Message().ThreadID,
-	).Scan(&ticketID)
+	ticket, err := s.store.GetTicketByThreadID(c.Message().ThreadID)
 	if err != nil {
 		log.Printf("Ошибка поиска тикета: %v", err)
 		return nil
 	}
 
-	ticket, err := getTicket(ticketID)
-	if err != nil {
-		log.Printf("Ошибка получения тикета: %v", err)
-		return nil
+	if text, ok := noteCaption(c.Message()); ok {
+		return s.saveInternalNote(c, ticket, text)
 	}
 
-	if err := saveMessageToHistory(
-		ticketID,
-		c.Message().ID,
-		c.Sender().ID,
-		c.Sender().Username,
-		c.Message().Text,
-		true,
-	); err != nil {
+	if err := s.saveMessage(newTicketMessage(ticket.ID, c.Message(), true)); err != nil {
 		log.Printf("Ошибка сохранения сообщения поддержки: %v", err)
 	}
+	s.resetStaleWarning(ticket)
 
-	replyText := fmt.Sprintf(
-		"📨 Ответ по обращению #%d:\n\n%s\n\n",
-		ticket.ID,
-		c.Message().Text,
-	)
+	header := tr(s.languageOf(ticket.UserID), "reply_header", ticket.ID)
 
-	if _, err := bot.Send(telebot.ChatID(ticket.UserID), replyText); err != nil {
+	out := relayOutbox(ticket.ID, ticket.UserID, c.Message(), header)
+	if target := s.userReplyTarget(ticket.ID, c.Message()); target != nil {
+		out.ReplyTo = target.ID
+	}
+	if _, deferred, err := s.enqueue(out); err != nil && !deferred {
 		log.Printf("Ошибка отправки ответа: %v", err)
 	}
 	return nil
 }
 
-func getOpenUserTicket(userID int64) (*Ticket, error) {
-	row := db.QueryRow(
-		`SELECT id, user_id, user_name, title, message, created_at, status, thread_id 
-		FROM tickets 
-		WHERE user_id = ? AND status != 'closed'
-		ORDER BY id DESC LIMIT 1`,
-		userID,
-	)
-
-	var t Ticket
-	err := row.Scan(&t.ID, &t.UserID, &t.UserName, &t.Title, &t.Message, &t.CreatedAt, &t.Status, &t.ThreadID)
-	if err != nil {
-		return nil, err
-	}
-	return &t, nil
-}
-
-func createTicket(t Ticket) (int64, error) {
-	res, err := db.Exec(
-		`INSERT INTO tickets (user_id, user_name, title, message, created_at, status)
-		VALUES (?, ?, ?, ?, ?, ?)`,
-		t.UserID, t.UserName, t.Title, t.Message, t.CreatedAt, t.Status,
-	)
-	if err != nil {
-		return 0, err
-	}
-	return res.LastInsertId()
-}
-
-func sendToSupportGroup(ticketID int64, t Ticket, origMsg *telebot.Message) error {
-	text := fmt.Sprintf(
-		"🚨 Обращение #%d\n\n"+
-			"👤 От: %s %s (@%s)\n"+
-			"🆔 ID: %d\n\n"+
-			"📝 Сообщение:\n%s\n\n"+
-			"🕒 Дата: %s\n"+
-			"🔗 Статус: %s",
-		ticketID,
-		origMsg.Sender.FirstName,
-		origMsg.Sender.LastName,
-		t.UserName,
-		t.UserID,
-		t.Message,
-		t.CreatedAt,
-		t.Status,
-	)
-
-	topicName := fmt.Sprintf("Обращение #%d: %s", ticketID, t.Title)
-	threadID, err := createForumTopic(topicName)
+func (s *Service) sendToSupportGroup(t *Ticket, origMsg *telebot.Message) error {
+	threadID, err := s.createForumTopic(s.topicName(t), s.topicIcon(t.Status))
 	if err != nil {
 		log.Printf("Не удалось создать тему: %v", err)
 		return fmt.Errorf("не удалось создать тему: %v", err)
 	}
 
 	if threadID != 0 {
-		_, err = db.Exec(
-			`UPDATE tickets SET thread_id = ? WHERE id = ?`,
-			threadID, ticketID,
-		)
-		if err != nil {
+		t.ThreadID = threadID
+		if err := s.store.SetTicketThreadID(t.ID, threadID); err != nil {
 			log.Printf("Ошибка сохранения thread_id: %v", err)
 		}
 	}
 
-	btnTake := telebot.Btn{Unique: fmt.Sprintf("take_btn_%d", ticketID), Text: "✅ Принято"}
-	btnClose := telebot.Btn{Unique: fmt.Sprintf("close_btn_%d", ticketID), Text: "❌ Закрыто"}
-
-	markup := &telebot.ReplyMarkup{}
-	markup.Inline(markup.Row(btnTake, btnClose))
-
-	bot.Handle(&btnTake, func(c telebot.Context) error {
-		return handleTakeButton(c, ticketID)
-	})
-	bot.Handle(&btnClose, func(c telebot.Context) error {
-		return handleCloseButton(c, ticketID)
-	})
-
-	_, err = bot.Send(
-		telebot.ChatID(SupportGroupID),
-		text,
+	card, err := s.bot.Send(
+		telebot.ChatID(s.cfg.SupportGroupID),
+		s.ticketCardText(t),
 		&telebot.SendOptions{
-			ReplyMarkup: markup,
+			ReplyMarkup: s.ticketCardMarkup(t),
 			ThreadID:    threadID,
 		},
 	)
-	return err
-}
-
-func handleTakeButton(c telebot.Context, ticketID int64) error {
-	if err := updateTicketStatus(ticketID, "in_progress"); err != nil {
-		log.Printf("Ошибка обновления статуса: %v", err)
-		return c.Respond()
-	}
-
-	ticket, err := getTicket(ticketID)
 	if err != nil {
-		log.Printf("Ошибка получения тикета: %v", err)
-		return c.Respond()
+		return err
 	}
 
-	_, err = bot.Send(
-		telebot.ChatID(ticket.UserID),
-		fmt.Sprintf("✅ Ваше обращение #%d принято в работу!", ticketID),
-	)
-	if err != nil {
-		log.Printf("Ошибка отправки уведомления пользователю: %v", err)
+	t.CardMessageID = card.ID
+	if err := s.store.SetTicketCardMessageID(t.ID, card.ID); err != nil {
+		log.Printf("Ошибка сохранения карточки: %v", err)
 	}
 
-	btnClose := telebot.Btn{Unique: fmt.Sprintf("close_btn_%d", ticketID), Text: "❌ Закрыто"}
-	markup := &telebot.ReplyMarkup{}
-	markup.Inline(markup.Row(btnClose))
-
-	editedText := strings.Replace(
-		c.Message().Text,
-		"🔗 Статус: open",
-		"🔗 Статус: in_progress",
-		1,
-	)
-
-	_, err = bot.Edit(
-		c.Message(),
-		editedText,
-		&telebot.SendOptions{ReplyMarkup: markup},
-	)
-	if err != nil {
-		log.Printf("Ошибка обновления сообщения: %v", err)
+	// Первое сообщение пользователя в теме представлено карточкой,
+	// а если оно с вложением — копией вложения. Тема и карточка к этому
+	// моменту уже есть, так что без копии обращение всё равно создано.
+	topicMessageID := card.ID
+	if mediaType, fileID := messageMedia(origMsg); mediaType != "" {
+		media, err := s.sendMedia(
+			telebot.ChatID(s.cfg.SupportGroupID),
+			mediaType,
+			fileID,
+			origMsg.Caption,
+			&telebot.SendOptions{ThreadID: threadID},
+		)
+		if err != nil {
+			log.Printf("Ошибка отправки вложения обращения #%d в тему: %v", t.ID, err)
+		} else {
+			topicMessageID = media.ID
+		}
 	}
+	s.linkMessages(t.ID, origMsg.ID, topicMessageID)
+	return nil
+}
 
-	return c.Respond(&telebot.CallbackResponse{Text: "Обращение принято в работу"})
+func (s *Service) takeButton(markup *telebot.ReplyMarkup, ticketID int64) telebot.Btn {
+	return markup.Data(tr(s.supportLanguage(), "btn_accept"), fmt.Sprintf("take_btn_%d", ticketID))
 }
 
-func handleCloseButton(c telebot.Context, ticketID int64) error {
-	if err := updateTicketStatus(ticketID, "closed"); err != nil {
-		log.Printf("Ошибка обновления статуса: %v", err)
-		return c.Respond()
-	}
+func (s *Service) closeButton(markup *telebot.ReplyMarkup, ticketID int64) telebot.Btn {
+	return markup.Data(tr(s.supportLanguage(), "btn_close"), fmt.Sprintf("close_btn_%d", ticketID))
+}
 
-	ticket, err := getTicket(ticketID)
+func (s *Service) handleCloseButton(c telebot.Context, ticketID int64) error {
+	ticket, err := s.store.GetTicket(ticketID)
 	if err != nil {
 		log.Printf("Ошибка получения тикета: %v", err)
-		return c.Respond()
+		return s.respond(c)
 	}
 
-	_, err = bot.Send(
-		telebot.ChatID(ticket.UserID),
-		fmt.Sprintf("✔️ Ваше обращение #%d закрыто. Спасибо, что обратились к нам!", ticketID),
-	)
-	if err != nil {
-		log.Printf("Ошибка отправки уведомления пользователю: %v", err)
+	if ticket.Status == "closed" {
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(s.supportLanguage(), "ticket_is_closed")})
 	}
 
-	editedText := strings.Replace(
-		c.Message().Text,
-		fmt.Sprintf("🔗 Статус: %s", ticket.Status),
-		"🔗 Статус: closed",
-		1,
-	)
-
-	_, err = bot.Edit(c.Message(), editedText)
-	if err != nil {
-		log.Printf("Ошибка обновления сообщения: %v", err)
+	prevStatus := ticket.Status
+	if err := s.changeTicketStatus(ticket, "closed", c.Sender(), true); err != nil {
+		log.Printf("Ошибка обновления статуса: %v", err)
+		return s.respond(c)
 	}
 
-	return c.Respond(&telebot.CallbackResponse{Text: "Обращение закрыто"})
+	s.notifyUser(ticket, tr(s.languageOf(ticket.UserID), "closed_by_support", ticketID))
+
+	s.sendSatisfactionSurvey(ticket)
+	s.refreshTicketViews(ticket, prevStatus, c.Message())
+
+	return s.respond(c, &telebot.CallbackResponse{Text: tr(s.supportLanguage(), "ticket_closed_cb")})
 }
 
-func createForumTopic(name string) (int, error) {
+func (s *Service) createForumTopic(name, iconID string) (int, error) {
 	params := map[string]interface{}{
-		"chat_id": SupportGroupID,
+		"chat_id": s.cfg.SupportGroupID,
 		"name":    name,
 	}
+	if iconID != "" {
+		params["icon_custom_emoji_id"] = iconID
+	}
 
-	resp, err := bot.Raw("createForumTopic", params)
+	resp, err := s.bot.Raw("createForumTopic", params)
 	if err != nil {
 		return 0, fmt.Errorf("ошибка API: %v", err)
 	}
@@ -767,95 +949,64 @@ func createForumTopic(name string) (int, error) {
 	return result.Result.MessageThreadID, nil
 }
 
-func getUserTickets(userID int64, limit int) ([]Ticket, error) {
-	rows, err := db.Query(
-		`SELECT id, title, status, created_at FROM tickets
-		WHERE user_id = ? ORDER BY created_at DESC LIMIT ?`,
-		userID,
-		limit,
-	)
-	if err != nil {
-		return nil, err
+// changeTicketStatus меняет статус обращения и записывает переход в историю.
+// Переданный тикет обновляется на месте.
+func (s *Service) changeTicketStatus(t *Ticket, status string, by *telebot.User, isSupport bool) error {
+	change := newStatusChange(t, status, by, isSupport)
+	if err := s.store.UpdateTicketStatus(change); err != nil {
+		return err
 	}
-	defer rows.Close()
+	applyStatusChange(t, change)
+	return nil
+}
 
-	var tickets []Ticket
-	for rows.Next() {
-		var t Ticket
-		if err := rows.Scan(&t.ID, &t.Title, &t.Status, &t.CreatedAt); err != nil {
-			return nil, err
-		}
-		tickets = append(tickets, t)
+func newStatusChange(t *Ticket, status string, by *telebot.User, isSupport bool) StatusChange {
+	return StatusChange{
+		TicketID:      t.ID,
+		FromStatus:    t.Status,
+		ToStatus:      status,
+		ChangedByID:   by.ID,
+		ChangedByName: displayName(by),
+		IsSupport:     isSupport,
+		Date:          time.Now().Format(DateTimeLayout),
 	}
-	return tickets, nil
 }
 
-func getTicket(id int64) (*Ticket, error) {
-	row := db.QueryRow(
-		`SELECT id, user_id, user_name, title, message, created_at, status, thread_id 
-		FROM tickets WHERE id = ?`,
-		id,
-	)
-
-	var t Ticket
-	err := row.Scan(&t.ID, &t.UserID, &t.UserName, &t.Title, &t.Message, &t.CreatedAt, &t.Status, &t.ThreadID)
-	if err != nil {
-		return nil, err
+// applyStatusChange отражает в t сохранённую смену статуса.
+func applyStatusChange(t *Ticket, change StatusChange) {
+	t.Status = change.ToStatus
+	t.ClosedAt = ""
+	if change.ToStatus == "closed" {
+		t.ClosedAt = change.Date
 	}
-	return &t, nil
 }
 
-func updateTicketStatus(id int64, status string) error {
-	_, err := db.Exec(
-		`UPDATE tickets SET status = ? WHERE id = ?`,
-		status, id,
-	)
-	return err
+func newTicketMessage(ticketID int64, msg *telebot.Message, isSupport bool) TicketMessage {
+	m := TicketMessage{
+		TicketID:  ticketID,
+		MessageID: msg.ID,
+		UserID:    msg.Sender.ID,
+		UserName:  msg.Sender.Username,
+		Text:      msg.Text,
+		Date:      time.Now().Format(DateTimeLayout),
+		IsSupport: isSupport,
+	}
+	m.MediaType, m.FileID = messageMedia(msg)
+	if m.MediaType != "" {
+		m.Text = msg.Caption
+	}
+	return m
 }
 
-func saveMessageToHistory(ticketID int64, messageID int, userID int64, userName, text string, isSupport bool) error {
-	_, err := db.Exec(
-		`INSERT INTO ticket_messages 
-		(ticket_id, message_id, user_id, user_name, text, date, is_support)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		ticketID, messageID, userID, userName, text, time.Now().Format("2006-01-02 15:04:05"), isSupport,
-	)
+func (s *Service) saveMessage(m TicketMessage) error {
+	_, err := s.store.SaveMessage(m)
 	return err
 }
 
-func getTicketHistory(ticketID int64) ([]TicketMessage, error) {
-	rows, err := db.Query(
-		`SELECT user_name, text, date, is_support 
-		FROM ticket_messages 
-		WHERE ticket_id = ? 
-		ORDER BY date ASC`,
-		ticketID,
-	)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var history []TicketMessage
-	for rows.Next() {
-		var m TicketMessage
-		err := rows.Scan(&m.UserName, &m.Text, &m.Date, &m.IsSupport)
-		if err != nil {
-			return nil, err
-		}
-		history = append(history, m)
-	}
-	return history, nil
-}
-
-func getStatusText(status string) string {
+func getStatusText(lang, status string) string {
 	switch status {
-	case "open":
-		return "🟢 Открыто"
-	case "in_progress":
-		return "🟡 В работе"
-	case "closed":
-		return "🔴 Закрыто"
+	case "open", "in_progress", "closed":
+		return tr(lang, "status_"+status)
 	default:
 		return status
 	}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"gopkg.in/telebot.v3"
+)
+
+const (
+	MediaPhoto     = "photo"
+	MediaDocument  = "document"
+	MediaAudio     = "audio"
+	MediaVoice     = "voice"
+	MediaVideo     = "video"
+	MediaVideoNote = "video_note"
+	MediaAnimation = "animation"
+	MediaSticker   = "sticker"
+
+	// Ограничение Telegram на длину подписи к медиа
+	MaxCaptionLength = 1024
+)
+
+// messageMedia возвращает тип вложения и его file_id.
+// Для текстовых сообщений возвращаются пустые строки.
+func messageMedia(m *telebot.Message) (string, string) {
+	switch {
+	case m.Photo != nil:
+		return MediaPhoto, m.Photo.FileID
+	case m.Voice != nil:
+		return MediaVoice, m.Voice.FileID
+	case m.Audio != nil:
+		return MediaAudio, m.Audio.FileID
+	case m.Animation != nil:
+		return MediaAnimation, m.Animation.FileID
+	case m.Document != nil:
+		return MediaDocument, m.Document.FileID
+	case m.Sticker != nil:
+		return MediaSticker, m.Sticker.FileID
+	case m.Video != nil:
+		return MediaVideo, m.Video.FileID
+	case m.VideoNote != nil:
+		return MediaVideoNote, m.VideoNote.FileID
+	}
+	return "", ""
+}
+
+func getMediaText(lang, mediaType string) string {
+	switch mediaType {
+	case MediaPhoto, MediaDocument, MediaAudio, MediaVoice,
+		MediaVideo, MediaVideoNote, MediaAnimation, MediaSticker:
+		return tr(lang, "media_"+mediaType)
+	default:
+		return mediaType
+	}
+}
+
+// messageSummary возвращает текст сообщения, подпись к медиа
+// или название вложения, если подписи нет. Результат показывается
+// в группе поддержки, поэтому используется её язык.
+func (s *Service) messageSummary(m *telebot.Message) string {
+	if m.Text != "" {
+		return m.Text
+	}
+	mediaType, _ := messageMedia(m)
+	if m.Caption != "" {
+		return fmt.Sprintf("[%s] %s", getMediaText(s.supportLanguage(), mediaType), m.Caption)
+	}
+	return fmt.Sprintf("[%s]", getMediaText(s.supportLanguage(), mediaType))
+}
+
+// mediaSendable собирает отправляемое вложение по типу и file_id.
+// Стикеры и видеосообщения не поддерживают подписи.
+func mediaSendable(mediaType, fileID, caption string) telebot.Sendable {
+	file := telebot.File{FileID: fileID}
+
+	switch mediaType {
+	case MediaPhoto:
+		return &telebot.Photo{File: file, Caption: caption}
+	case MediaDocument:
+		return &telebot.Document{File: file, Caption: caption}
+	case MediaAudio:
+		return &telebot.Audio{File: file, Caption: caption}
+	case MediaVoice:
+		return &telebot.Voice{File: file, Caption: caption}
+	case MediaVideo:
+		return &telebot.Video{File: file, Caption: caption}
+	case MediaAnimation:
+		return &telebot.Animation{File: file, Caption: caption}
+	case MediaVideoNote:
+		return &telebot.VideoNote{File: file}
+	case MediaSticker:
+		return &telebot.Sticker{File: file}
+	}
+	return nil
+}
+
+func supportsCaption(mediaType string) bool {
+	return mediaType != MediaSticker && mediaType != MediaVideoNote
+}
+
+// sendMedia отправляет вложение с заголовком. Если заголовок не помещается
+// в подпись или тип медиа не поддерживает подписи, заголовок уходит
+// отдельным текстовым сообщением перед вложением.
+func (s *Service) sendMedia(to telebot.Recipient, mediaType, fileID, header string, opts *telebot.SendOptions) (*telebot.Message, error) {
+	if !headerSeparate(mediaType, header) {
+		return s.sendMediaBody(to, mediaType, fileID, header, false, opts)
+	}
+	if _, err := s.bot.Send(to, header, opts); err != nil {
+		return nil, err
+	}
+	return s.sendMediaBody(to, mediaType, fileID, "", true, opts)
+}
+
+// headerSeparate сообщает, уходит ли заголовок отдельным сообщением.
+func headerSeparate(mediaType, header string) bool {
+	return !supportsCaption(mediaType) || len([]rune(header)) > MaxCaptionLength
+}
+
+// sendMediaBody отправляет само вложение с подписью caption. headerSent
+// означает, что заголовок уже ушёл отдельным сообщением.
+func (s *Service) sendMediaBody(to telebot.Recipient, mediaType, fileID, caption string, headerSent bool, opts *telebot.SendOptions) (*telebot.Message, error) {
+	media := mediaSendable(mediaType, fileID, caption)
+	if media == nil {
+		return nil, fmt.Errorf("неподдерживаемый тип вложения: %s", mediaType)
+	}
+
+	var sendOpts *telebot.SendOptions
+	if opts != nil {
+		sendOpts = &telebot.SendOptions{ThreadID: opts.ThreadID}
+		// Если заголовок ушёл отдельно, ответом помечен он
+		if !headerSent {
+			sendOpts.ReplyTo = opts.ReplyTo
+			sendOpts.AllowWithoutReply = opts.AllowWithoutReply
+		}
+	}
+	return s.bot.Send(to, media, sendOpts)
+}
+
+func (s *Service) handleMediaMessages(c telebot.Context) error {
+	if c.Chat().Type == telebot.ChatPrivate {
+		return s.handleUserMessage(c)
+	}
+
+	if c.Chat().ID == s.cfg.SupportGroupID {
+		return s.handleSupportGroupMessage(c)
+	}
+
+	return nil
+}
+
+func (s *Service) handleAttachmentButton(c telebot.Context, messageID int64) error {
+	lang := s.userLanguage(c.Sender())
+	m, err := s.store.GetTicketMessage(messageID)
+	if err != nil || m.IsInternal || m.FileID == "" {
+		if err != nil {
+			log.Printf("Ошибка получения вложения: %v", err)
+		}
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "attachment_not_found")})
+	}
+
+	ticket, err := s.store.GetTicket(m.TicketID)
+	if err != nil {
+		log.Printf("Ошибка получения тикета: %v", err)
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "error_data")})
+	}
+
+	if ticket.UserID != c.Sender().ID {
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "not_your_ticket")})
+	}
+
+	header := tr(lang, "attachment_header", ticket.ID, m.Date)
+	if m.Text != "" {
+		header += "\n\n" + m.Text
+	}
+
+	if _, err := s.sendMedia(c.Sender(), m.MediaType, m.FileID, header, nil); err != nil {
+		log.Printf("Ошибка отправки вложения: %v", err)
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "error_send_attachment")})
+	}
+
+	return s.respond(c)
+}
+
+func attachmentButtons(lang string, menu *telebot.ReplyMarkup, history []TicketMessage) []telebot.Row {
+	var rows []telebot.Row
+	for i, m := range history {
+		if m.FileID == "" {
+			continue
+		}
+		btn := menu.Data(
+			fmt.Sprintf("📎 %d. %s", i+1, getMediaText(lang, m.MediaType)),
+			"attachment_"+strconv.FormatInt(m.ID, 10),
+		)
+		rows = append(rows, menu.Row(btn))
+	}
+	return rows
+}
+
+func historyEntryText(lang string, m TicketMessage, index int) string {
+	if m.MediaType == "" {
+		return m.Text
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("📎 %d. %s", index, getMediaText(lang, m.MediaType)))
+	if m.Text != "" {
+		b.WriteString("\n" + m.Text)
+	}
+	return b.String()
+}
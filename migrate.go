@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// migration — одно пронумерованное изменение схемы. Номера версий
+// идут по возрастанию без пропусков, применённые миграции не изменяются:
+// любое новое изменение схемы добавляется отдельной миграцией в конец списка.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+func execSQL(query string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+// runMigrations применяет к базе все миграции с версией выше текущей.
+// Каждая миграция выполняется в отдельной транзакции вместе с записью
+// номера версии, поэтому сбой оставляет базу в последнем согласованном состоянии.
+func runMigrations(db *sql.DB, migrations []migration) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("ошибка создания таблицы миграций: %v", err)
+	}
+
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	latest := 0
+	for i, m := range migrations {
+		if m.version != i+1 {
+			return fmt.Errorf("миграция %q имеет номер %d, ожидался %d", m.name, m.version, i+1)
+		}
+		latest = m.version
+	}
+
+	if current > latest {
+		return fmt.Errorf("версия схемы БД (%d) новее, чем поддерживает бот (%d)", current, latest)
+	}
+
+	for _, m := range migrations[current:] {
+		log.Printf("Применение миграции %d: %s", m.version, m.name)
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("ошибка миграции %d (%s): %v", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func schemaVersion(db *sql.DB) (int, error) {
+	var version sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("ошибка чтения версии схемы: %v", err)
+	}
+	return int(version.Int64), nil
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+		m.version, m.name, time.Now().Format(DateTimeLayout),
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"unicode"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Внутренние заметки агентов: сообщение в теме обращения, начинающееся
+// с /note (текст или подпись к вложению), сохраняется в истории,
+// но не пересылается клиенту и не показывается ему в истории переписки.
+const noteCommand = "/note"
+
+// noteCaption возвращает текст заметки из подписи к вложению вида
+// "/note текст" или "/note@bot текст". Текст может начинаться и с новой
+// строки.
+func noteCaption(m *telebot.Message) (string, bool) {
+	return parseNote(m.Caption)
+}
+
+// parseNote разбирает текст вида "/note текст". Команда отделяется от
+// текста любым пробельным символом, так что многострочная заметка
+// сохраняется целиком.
+func parseNote(s string) (string, bool) {
+	first, rest := s, ""
+	if i := strings.IndexFunc(s, unicode.IsSpace); i >= 0 {
+		first, rest = s[:i], s[i:]
+	}
+
+	command := strings.SplitN(first, "@", 2)[0]
+	if command != noteCommand {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
+
+func (s *Service) handleNoteCommand(c telebot.Context) error {
+	ticket, err := s.topicTicket(c)
+	if ticket == nil {
+		return err
+	}
+
+	// Payload у telebot обрывается на первом переводе строки
+	text, _ := parseNote(c.Message().Text)
+	if text == "" {
+		return s.reply(c, tr(s.supportLanguage(), "note_usage"))
+	}
+
+	return s.saveInternalNote(c, ticket, text)
+}
+
+func (s *Service) saveInternalNote(c telebot.Context, ticket *Ticket, text string) error {
+	m := newTicketMessage(ticket.ID, c.Message(), true)
+	m.Text = text
+	m.IsInternal = true
+
+	if err := s.saveMessage(m); err != nil {
+		log.Printf("Ошибка сохранения заметки: %v", err)
+		return s.reply(c, tr(s.supportLanguage(), "error_note"))
+	}
+
+	return s.reply(c, tr(s.supportLanguage(), "note_saved", ticket.ID))
+}
+
+// customerHistory убирает из истории внутренние заметки.
+func customerHistory(history []TicketMessage) []TicketMessage {
+	visible := make([]TicketMessage, 0, len(history))
+	for _, m := range history {
+		if !m.IsInternal {
+			visible = append(visible, m)
+		}
+	}
+	return visible
+}
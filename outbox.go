@@ -0,0 +1,399 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Очередь отправки. Пересылаемые сообщения и уведомления о статусе
+// обращения сначала записываются в таблицу outbox и только потом
+// отправляются, поэтому временный сбой Telegram или перезапуск бота их не
+// теряет. Неудачная попытка повторяется с растущей паузой (при ответе 429 —
+// не раньше retry_after), а после постоянной ошибки или исчерпания попыток
+// сообщение остаётся в очереди со статусом failed, и агенты получают
+// уведомление в теме обращения.
+
+const (
+	OutboxPending = "pending"
+	OutboxFailed  = "failed"
+)
+
+// Пока сообщение отправляется сразу из обработчика, фоновая доставка его
+// не берёт. Если бот остановится посреди отправки, она повторит сообщение
+// после этой паузы.
+const outboxClaim = time.Minute
+
+// Сколько текста недоставленного сообщения показывать агентам
+const outboxExcerptLength = 300
+
+// Ограничение Telegram на длину текста сообщения
+const MaxMessageLength = 4096
+
+// OutboxMessage — сообщение в очереди отправки. Text — итоговый текст или
+// подпись вместе с заголовком, ReplyMarkup — клавиатура в JSON
+// (см. outboxMarkup); HeaderSent — заголовок медиа или первая часть
+// длинного текста уже ушли отдельным сообщением, и повтор отправляет
+// только оставшееся. Если задан
+// SourceMessageID, после доставки копия связывается с исходным сообщением,
+// как при обычной пересылке.
+type OutboxMessage struct {
+	ID              int64  `json:"id"`
+	TicketID        int64  `json:"ticket_id"`
+	ChatID          int64  `json:"chat_id"`
+	ThreadID        int    `json:"thread_id,omitempty"`
+	ReplyTo         int    `json:"reply_to,omitempty"`
+	Text            string `json:"text"`
+	MediaType       string `json:"media_type,omitempty"`
+	FileID          string `json:"file_id,omitempty"`
+	SourceMessageID int    `json:"source_message_id,omitempty"`
+	ReplyMarkup     string `json:"reply_markup,omitempty"`
+	HeaderSent      bool   `json:"header_sent,omitempty"`
+	Status          string `json:"status"`
+	Attempts        int    `json:"attempts"`
+	NextAttemptAt   string `json:"next_attempt_at"`
+	LastError       string `json:"last_error,omitempty"`
+	CreatedAt       string `json:"created_at"`
+}
+
+// relayOutbox готовит пересылку сообщения m с заголовком header в чат chatID:
+// текст отправляется как есть (если вместе с заголовком он длиннее
+// MaxMessageLength — двумя сообщениями, см. splitLongText), медиа —
+// с заголовком и исходной подписью.
+func relayOutbox(ticketID, chatID int64, m *telebot.Message, header string) OutboxMessage {
+	out := OutboxMessage{
+		TicketID:        ticketID,
+		ChatID:          chatID,
+		Text:            header + m.Text,
+		SourceMessageID: m.ID,
+	}
+	if mediaType, fileID := messageMedia(m); mediaType != "" {
+		out.MediaType, out.FileID = mediaType, fileID
+		out.Text = header + m.Caption
+	}
+	return out
+}
+
+// outboxMarkup сохраняет клавиатуру для отправки из очереди. Её нужно
+// сохранять до первой отправки: telebot дописывает к данным кнопок
+// их unique прямо в переданной клавиатуре.
+func outboxMarkup(markup *telebot.ReplyMarkup) string {
+	data, err := json.Marshal(markup)
+	if err != nil {
+		log.Printf("Ошибка сохранения клавиатуры сообщения: %v", err)
+		return ""
+	}
+	return string(data)
+}
+
+// notifyUser ставит в очередь уведомление пользователю по обращению t.
+func (s *Service) notifyUser(t *Ticket, text string) {
+	if _, deferred, err := s.enqueue(OutboxMessage{TicketID: t.ID, ChatID: t.UserID, Text: text}); err != nil && !deferred {
+		log.Printf("Ошибка отправки уведомления пользователю: %v", err)
+	}
+}
+
+// notifyTopic ставит в очередь уведомление в тему обращения t.
+func (s *Service) notifyTopic(t *Ticket, text string) {
+	out := OutboxMessage{TicketID: t.ID, ChatID: s.cfg.SupportGroupID, ThreadID: t.ThreadID, Text: text}
+	if _, deferred, err := s.enqueue(out); err != nil && !deferred {
+		log.Printf("Ошибка отправки уведомления в группу: %v", err)
+	}
+}
+
+// enqueue записывает сообщение в очередь и сразу отправляет его, если в ту
+// же тему чата не ждут доставки более ранние сообщения. deferred означает, что
+// сообщение будет доставлено позже; ошибка без deferred — что доставить
+// его не удалось совсем.
+func (s *Service) enqueue(m OutboxMessage) (sent *telebot.Message, deferred bool, err error) {
+	now := time.Now()
+	m.Status = OutboxPending
+	m.CreatedAt = now.Format(DateTimeLayout)
+
+	// Сообщения в одну тему чата уходят в порядке постановки в очередь.
+	// Проверка и постановка идут под блокировкой темы: иначе два
+	// обработчика оба увидят пустую очередь и отправят сообщения напрямую
+	// в произвольном порядке.
+	lock := s.outboxLock(m.ChatID, m.ThreadID)
+	lock.Lock()
+	waiting, err := s.store.CountPendingOutbox(m.ChatID, m.ThreadID)
+	if err != nil {
+		log.Printf("Ошибка проверки очереди отправки: %v", err)
+	}
+	if waiting > 0 {
+		m.NextAttemptAt = m.CreatedAt
+	} else {
+		m.NextAttemptAt = now.Add(outboxClaim).Format(DateTimeLayout)
+	}
+
+	m.ID, err = s.store.EnqueueOutbox(m)
+	lock.Unlock()
+	if err != nil {
+		// Без очереди остаётся одна попытка
+		log.Printf("Ошибка постановки сообщения в очередь отправки: %v", err)
+		sent, err := s.sendOutboxMessage(m)
+		if err == nil {
+			s.linkOutboxMessage(m, sent)
+		}
+		return sent, false, err
+	}
+	if waiting > 0 {
+		return nil, true, nil
+	}
+	return s.attemptOutbox(m, now)
+}
+
+// Число блокировок постановки в очередь: темы делят их по хешу, так что
+// набор блокировок не растёт с числом тем.
+const outboxLockCount = 64
+
+// outboxLock возвращает блокировку постановки в очередь для темы threadID
+// чата chatID.
+func (s *Service) outboxLock(chatID int64, threadID int) *sync.Mutex {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d:%d", chatID, threadID)
+	return &s.outboxLocks[h.Sum32()%outboxLockCount]
+}
+
+// deliverOutbox отправляет по одному сообщению в каждую тему, где время
+// попытки самого раннего ожидающего сообщения наступило. Остальные ждут
+// его доставки, даже если их время уже пришло, а после 429 проход
+// прекращается целиком.
+func (s *Service) deliverOutbox(now time.Time) {
+	due, err := s.store.ListDueOutbox(now.Format(DateTimeLayout), s.cfg.Outbox.BatchSize)
+	if err != nil {
+		log.Printf("Ошибка выборки очереди отправки: %v", err)
+		return
+	}
+
+	for _, m := range due {
+		if _, deferred, err := s.attemptOutbox(m, now); deferred && isFloodError(err) {
+			return
+		}
+	}
+}
+
+// attemptOutbox отправляет сообщение из очереди и записывает результат.
+func (s *Service) attemptOutbox(m OutboxMessage, now time.Time) (*telebot.Message, bool, error) {
+	sent, err := s.sendOutboxMessage(m)
+	if err == nil {
+		if err := s.store.CompleteOutbox(m.ID); err != nil {
+			log.Printf("Ошибка удаления сообщения #%d из очереди отправки: %v", m.ID, err)
+		}
+		s.linkOutboxMessage(m, sent)
+		return sent, false, nil
+	}
+
+	if m.ChatID == s.cfg.SupportGroupID && m.ThreadID != 0 && topicGone(err) {
+		// Тема удалена: пересылки попадут в новую тему из истории
+		// обращения, когда её восстановят (repair.go)
+		log.Printf("Сообщение #%d из очереди не доставлено, тема %d удалена", m.ID, m.ThreadID)
+		if err := s.store.CompleteOutbox(m.ID); err != nil {
+			log.Printf("Ошибка удаления сообщения #%d из очереди отправки: %v", m.ID, err)
+		}
+		s.topicLost(m.TicketID, m.ThreadID)
+		return nil, true, err
+	}
+
+	attempts := m.Attempts + 1
+	if delay, ok := retryDelay(err, attempts, s.cfg.Outbox); ok && attempts < s.cfg.Outbox.MaxAttempts {
+		log.Printf("Сообщение #%d из очереди не доставлено (попытка %d), повтор через %s: %v", m.ID, attempts, delay, err)
+		if err := s.store.RetryOutbox(m.ID, now.Add(delay).Format(DateTimeLayout), err.Error()); err != nil {
+			log.Printf("Ошибка обновления очереди отправки: %v", err)
+		}
+		return nil, true, err
+	}
+
+	log.Printf("Сообщение #%d из очереди не доставлено после %d попыток: %v", m.ID, attempts, err)
+	if err := s.store.FailOutbox(m.ID, err.Error()); err != nil {
+		log.Printf("Ошибка обновления очереди отправки: %v", err)
+	}
+	s.reportFailedDelivery(m, attempts, err)
+	return nil, false, err
+}
+
+func (s *Service) sendOutboxMessage(m OutboxMessage) (*telebot.Message, error) {
+	to := telebot.ChatID(m.ChatID)
+	opts := &telebot.SendOptions{ThreadID: m.ThreadID}
+	if m.ReplyTo != 0 {
+		opts.ReplyTo = &telebot.Message{ID: m.ReplyTo}
+		opts.AllowWithoutReply = true
+	}
+	if m.ReplyMarkup != "" {
+		markup := &telebot.ReplyMarkup{}
+		if err := json.Unmarshal([]byte(m.ReplyMarkup), markup); err != nil {
+			return nil, fmt.Errorf("неверная клавиатура сообщения: %v", err)
+		}
+		opts.ReplyMarkup = markup
+	}
+	if m.MediaType == "" {
+		return s.sendOutboxText(to, m, opts)
+	}
+	if !headerSeparate(m.MediaType, m.Text) {
+		return s.sendMediaBody(to, m.MediaType, m.FileID, m.Text, false, opts)
+	}
+
+	// Заголовок отправляется один раз: повтор после сбоя отправляет только вложение
+	if !m.HeaderSent {
+		if _, err := s.bot.Send(to, m.Text, opts); err != nil {
+			return nil, err
+		}
+		if m.ID != 0 {
+			if err := s.store.MarkOutboxHeaderSent(m.ID); err != nil {
+				log.Printf("Ошибка обновления очереди отправки: %v", err)
+			}
+		}
+	}
+	return s.sendMediaBody(to, m.MediaType, m.FileID, "", true, opts)
+}
+
+// sendOutboxText отправляет текст из очереди; слишком длинный уходит двумя
+// сообщениями, клавиатура прикрепляется ко второму.
+func (s *Service) sendOutboxText(to telebot.Recipient, m OutboxMessage, opts *telebot.SendOptions) (*telebot.Message, error) {
+	first, rest := splitLongText(m.Text)
+	if rest == "" {
+		return s.bot.Send(to, m.Text, opts)
+	}
+
+	// Первая часть отправляется один раз: повтор после сбоя отправляет только остаток
+	if !m.HeaderSent {
+		if _, err := s.bot.Send(to, first, &telebot.SendOptions{
+			ThreadID:          opts.ThreadID,
+			ReplyTo:           opts.ReplyTo,
+			AllowWithoutReply: opts.AllowWithoutReply,
+		}); err != nil {
+			return nil, err
+		}
+		if m.ID != 0 {
+			if err := s.store.MarkOutboxHeaderSent(m.ID); err != nil {
+				log.Printf("Ошибка обновления очереди отправки: %v", err)
+			}
+		}
+	}
+	return s.bot.Send(to, rest, &telebot.SendOptions{ThreadID: opts.ThreadID, ReplyMarkup: opts.ReplyMarkup})
+}
+
+// splitLongText делит текст длиннее MaxMessageLength по последнему переводу
+// строки в пределах ограничения, а без него — по самому ограничению.
+// Заголовок пересылки заканчивается переводом строки, поэтому вторая часть
+// не длиннее пересылаемого сообщения. Короткий текст возвращается целиком.
+func splitLongText(text string) (string, string) {
+	r := []rune(text)
+	if len(r) <= MaxMessageLength {
+		return text, ""
+	}
+	cut := MaxMessageLength
+	for i := MaxMessageLength - 1; i > 0; i-- {
+		if r[i] == '\n' {
+			cut = i + 1
+			break
+		}
+	}
+	return string(r[:cut]), string(r[cut:])
+}
+
+func (s *Service) linkOutboxMessage(m OutboxMessage, sent *telebot.Message) {
+	if m.SourceMessageID == 0 {
+		return
+	}
+	if m.ChatID == s.cfg.SupportGroupID {
+		s.linkMessages(m.TicketID, m.SourceMessageID, sent.ID)
+	} else {
+		s.linkMessages(m.TicketID, sent.ID, m.SourceMessageID)
+	}
+}
+
+// reportFailedDelivery сообщает агентам в теме обращения, что сообщение
+// не доставлено. Уведомление отправляется напрямую, минуя очередь.
+func (s *Service) reportFailedDelivery(m OutboxMessage, attempts int, cause error) {
+	// Служебные сообщения вроде отчёта архивации не относятся к обращению
+	if m.TicketID == 0 {
+		return
+	}
+	t, err := s.store.GetTicket(m.TicketID)
+	if err != nil {
+		log.Printf("Ошибка получения тикета: %v", err)
+		return
+	}
+	if t.ThreadID == 0 {
+		return
+	}
+
+	lang := s.supportLanguage()
+	key := "delivery_failed_user"
+	if m.ChatID == s.cfg.SupportGroupID {
+		key = "delivery_failed_topic"
+	}
+	_, err = s.bot.Send(
+		telebot.ChatID(s.cfg.SupportGroupID),
+		tr(lang, key, attempts, cause.Error(), outboxExcerpt(lang, m)),
+		&telebot.SendOptions{ThreadID: t.ThreadID},
+	)
+	if err != nil {
+		log.Printf("Ошибка отправки сообщения в тему обращения #%d: %v", t.ID, err)
+	}
+}
+
+func outboxExcerpt(lang string, m OutboxMessage) string {
+	text := m.Text
+	if m.MediaType != "" {
+		text = fmt.Sprintf("[%s] %s", getMediaText(lang, m.MediaType), text)
+	}
+	if r := []rune(text); len(r) > outboxExcerptLength {
+		text = string(r[:outboxExcerptLength]) + "…"
+	}
+	return text
+}
+
+// Код ответа Bot API в конце текста ошибки telebot: "telegram: ... (403)"
+var telegramErrorCode = regexp.MustCompile(`^telegram: .*\((\d{3})\)$`)
+
+// retryDelay решает, стоит ли повторять отправку после err, и возвращает
+// паузу перед следующей попыткой.
+func retryDelay(err error, attempts int, policy OutboxConfig) (time.Duration, bool) {
+	if flood, ok := floodError(err); ok {
+		return max(time.Duration(flood.RetryAfter)*time.Second, policy.MinBackoff.Duration), true
+	}
+	if !transientError(err) {
+		return 0, false
+	}
+
+	delay := policy.MinBackoff.Duration
+	for i := 1; i < attempts && delay < policy.MaxBackoff.Duration; i++ {
+		delay *= 2
+	}
+	return min(delay, policy.MaxBackoff.Duration), true
+}
+
+// transientError отличает временные сбои (сеть, 429, 5xx) от ошибок,
+// которые повтор не исправит: чат не найден, бот заблокирован
+// пользователем, неверный запрос.
+func transientError(err error) bool {
+	msg := err.Error()
+	if m := telegramErrorCode.FindStringSubmatch(msg); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		return code == 429 || code >= 500
+	}
+	// Сетевые ошибки telebot оборачивает с таким префиксом
+	return strings.HasPrefix(msg, "telebot: ")
+}
+
+func floodError(err error) (telebot.FloodError, bool) {
+	var flood telebot.FloodError
+	ok := errors.As(err, &flood)
+	return flood, ok
+}
+
+func isFloodError(err error) bool {
+	_, ok := floodError(err)
+	return ok
+}
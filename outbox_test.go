@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// floodErrorStub — ответ 429 в том виде, в каком его возвращает telebot.
+// Настоящий FloodError вне пакета telebot собрать нельзя.
+type floodErrorStub struct{ retryAfter int }
+
+func (e floodErrorStub) Error() string {
+	return "telegram: Too Many Requests: retry after (429)"
+}
+
+func (e floodErrorStub) Unwrap() error {
+	return telebot.FloodError{RetryAfter: e.retryAfter}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := defaultConfig().Outbox
+
+	tests := []struct {
+		name      string
+		err       error
+		attempts  int
+		wantDelay time.Duration
+		wantRetry bool
+	}{
+		{"429 ждёт retry_after", floodErrorStub{30}, 1, 30 * time.Second, true},
+		{"429 не чаще минимальной паузы", floodErrorStub{1}, 1, policy.MinBackoff.Duration, true},
+		{"5xx с первой попытки", telebot.NewError(502, "Bad Gateway"), 1, policy.MinBackoff.Duration, true},
+		{"5xx пауза растёт", telebot.NewError(502, "Bad Gateway"), 3, 4 * policy.MinBackoff.Duration, true},
+		{"5xx пауза ограничена", telebot.NewError(500, "Internal Server Error"), 20, policy.MaxBackoff.Duration, true},
+		{"сетевая ошибка", errors.New("telebot: Post \"https://api.telegram.org\": connection refused"), 2, 2 * policy.MinBackoff.Duration, true},
+		{"бот заблокирован", telebot.ErrBlockedByUser, 1, 0, false},
+		{"неверный запрос", telebot.NewError(400, "Bad Request: chat not found"), 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, retry := retryDelay(tt.err, tt.attempts, policy)
+			if delay != tt.wantDelay || retry != tt.wantRetry {
+				t.Fatalf("retryDelay = %s, %v; ожидалось %s, %v", delay, retry, tt.wantDelay, tt.wantRetry)
+			}
+		})
+	}
+}
+
+// outbox возвращает все сообщения очереди в порядке постановки.
+func (e *handlerEnv) outbox(t *testing.T) []OutboxMessage {
+	t.Helper()
+	rows, err := e.store.(*SQLStore).db.Query(`SELECT id, text, status, attempts, next_attempt_at FROM outbox ORDER BY id`)
+	if err != nil {
+		t.Fatalf("чтение очереди: %v", err)
+	}
+	defer rows.Close()
+
+	var messages []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		if err := rows.Scan(&m.ID, &m.Text, &m.Status, &m.Attempts, &m.NextAttemptAt); err != nil {
+			t.Fatalf("чтение очереди: %v", err)
+		}
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+func TestOutboxAttempt(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus string
+		wantDelay  time.Duration
+	}{
+		{"429", floodErrorStub{120}, OutboxPending, 120 * time.Second},
+		{"временная ошибка", telebot.NewError(502, "Bad Gateway"), OutboxPending, defaultConfig().Outbox.MinBackoff.Duration},
+		{"постоянная ошибка", telebot.ErrBlockedByUser, OutboxFailed, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newHandlerEnv(t)
+			ticket, _ := e.createTicket(t)
+			e.bot.Reset()
+			e.bot.Errors["Send"] = tt.err
+
+			start := time.Now()
+			e.svc.notifyUser(ticket, "Ответ поддержки")
+
+			messages := e.outbox(t)
+			if len(messages) != 1 {
+				t.Fatalf("в очереди %d сообщений", len(messages))
+			}
+			m := messages[0]
+			if m.Status != tt.wantStatus || m.Attempts != 1 {
+				t.Fatalf("статус %q, попыток %d", m.Status, m.Attempts)
+			}
+
+			if tt.wantStatus == OutboxFailed {
+				lang := e.svc.supportLanguage()
+				e.expectSent(t, testGroupID, tr(lang, "delivery_failed_user", 1, tt.err.Error(), "Ответ поддержки"))
+				return
+			}
+			next, err := time.ParseInLocation(DateTimeLayout, m.NextAttemptAt, time.Local)
+			if err != nil {
+				t.Fatalf("время попытки %q: %v", m.NextAttemptAt, err)
+			}
+			if d := next.Sub(start.Truncate(time.Second)); d < tt.wantDelay || d > tt.wantDelay+2*time.Second {
+				t.Fatalf("повтор через %s, ожидалось %s", d, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestOutboxKeepsTopicOrder(t *testing.T) {
+	e := newHandlerEnv(t)
+	ticket, _ := e.createTicket(t)
+	e.bot.Reset()
+
+	// Первое сообщение не уходит, второе ждёт его в очереди
+	e.bot.Errors["Send"] = telebot.NewError(502, "Bad Gateway")
+	e.svc.notifyUser(ticket, "первое")
+	delete(e.bot.Errors, "Send")
+	e.svc.notifyUser(ticket, "второе")
+	if n := len(e.bot.Calls("Send")); n != 1 {
+		t.Fatalf("второе сообщение отправлено раньше первого: попыток %d", n)
+	}
+
+	later := time.Now().Add(time.Hour)
+	e.svc.deliverOutbox(later)
+	e.svc.deliverOutbox(later)
+
+	var texts []string
+	for _, c := range e.sent(e.user.ID) {
+		texts = append(texts, c.Text())
+	}
+	if len(texts) != 3 || texts[1] != "первое" || texts[2] != "второе" {
+		t.Fatalf("отправлено %q", texts)
+	}
+	if left := e.outbox(t); len(left) != 0 {
+		t.Fatalf("в очереди остались %+v", left)
+	}
+}
+
+func TestSplitLongText(t *testing.T) {
+	header := tr("ru", "reply_header", 1)
+	long := strings.Repeat("я", MaxMessageLength)
+	tail := strings.Repeat("я", MaxMessageLength-len([]rune("абзац\n")))
+
+	tests := []struct {
+		name      string
+		text      string
+		wantFirst string
+		wantRest  string
+	}{
+		{"короткий текст", header + "Ответ", header + "Ответ", ""},
+		{"ровно ограничение", long, long, ""},
+		{"заголовок отдельно", header + long, header, long},
+		{"по последней строке", header + "абзац\n" + tail, header + "абзац\n", tail},
+		{"без переводов строки", long + "ещё", long, "ещё"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, rest := splitLongText(tt.text)
+			if first != tt.wantFirst || rest != tt.wantRest {
+				t.Fatalf("splitLongText: %d и %d символов, ожидалось %d и %d",
+					len([]rune(first)), len([]rune(rest)), len([]rune(tt.wantFirst)), len([]rune(tt.wantRest)))
+			}
+		})
+	}
+}
+
+func TestOutboxLongText(t *testing.T) {
+	e := newHandlerEnv(t)
+	ticket, _ := e.createTicket(t)
+	e.bot.Reset()
+
+	text := strings.Repeat("я", MaxMessageLength)
+	e.topicMessage(t, ticket.ThreadID, text)
+
+	header := tr("ru", "reply_header", ticket.ID)
+	sent := e.sent(e.user.ID)
+	if len(sent) != 2 || sent[0].Text() != header || sent[1].Text() != text {
+		t.Fatalf("отправлено %d сообщений", len(sent))
+	}
+
+	// После сбоя на второй части повтор не дублирует заголовок
+	e.bot.Reset()
+	_, err := e.svc.sendOutboxMessage(OutboxMessage{TicketID: ticket.ID, ChatID: e.user.ID, Text: header + text, HeaderSent: true})
+	if err != nil {
+		t.Fatalf("sendOutboxMessage: %v", err)
+	}
+	if sent := e.sent(e.user.ID); len(sent) != 1 || sent[0].Text() != text {
+		t.Fatalf("повтор отправил %d сообщений", len(sent))
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Приоритет обращения. Агенты меняют его кнопками карточки или командой
+// /priority в теме, пользователь при создании обращения может отметить
+// его срочность. Приоритет виден в названии темы и в карточке, а очередь
+// /queue упорядочена по приоритету и затем по возрасту обращения.
+
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+// priorities перечислены по возрастанию
+var priorities = []string{PriorityLow, PriorityNormal, PriorityHigh, PriorityUrgent}
+
+// Срочность, которую может выбрать пользователь. Высший приоритет
+// назначают только агенты.
+var userPriorities = []string{PriorityLow, PriorityHigh}
+
+func priorityRankOf(priority string) int {
+	for i, p := range priorities {
+		if p == priority {
+			return i
+		}
+	}
+	return 1
+}
+
+func isPriority(priority string) bool {
+	for _, p := range priorities {
+		if p == priority {
+			return true
+		}
+	}
+	return false
+}
+
+// priorityMark возвращает отметку приоритета; у обычного её нет.
+func priorityMark(priority string) string {
+	switch priority {
+	case PriorityLow:
+		return "⬇️"
+	case PriorityHigh:
+		return "⬆️"
+	case PriorityUrgent:
+		return "🔥"
+	default:
+		return ""
+	}
+}
+
+func getPriorityText(lang, priority string) string {
+	if !isPriority(priority) {
+		priority = PriorityNormal
+	}
+	return tr(lang, "priority_"+priority)
+}
+
+// setTicketPriority меняет приоритет обращения по решению поддержки
+// и обновляет карточку и тему. После этого срочность, выбранная
+// пользователем, приоритет уже не меняет.
+func (s *Service) setTicketPriority(t *Ticket, priority string, by *telebot.User, fallbackCard *telebot.Message) error {
+	if t.Priority == priority && t.PrioritySetBySupport {
+		return nil
+	}
+	if err := s.store.SetTicketPriority(t.ID, priority); err != nil {
+		return err
+	}
+	t.PrioritySetBySupport = true
+	if t.Priority == priority {
+		return nil
+	}
+	old := t.Priority
+	t.Priority = priority
+	s.priorityChanged(t, old, by, fallbackCard)
+	return nil
+}
+
+// priorityChanged обновляет карточку и тему после смены приоритета с old.
+// При повышении до высокого или срочного в тему уходит уведомление,
+// которое упоминает ответственного.
+func (s *Service) priorityChanged(t *Ticket, old string, by *telebot.User, fallbackCard *telebot.Message) {
+	priority := t.Priority
+	log.Printf("Приоритет обращения #%d изменён: %s → %s (%s)", t.ID, old, priority, displayName(by))
+
+	s.refreshTicketViews(t, t.Status, fallbackCard)
+
+	lang := s.supportLanguage()
+	if priorityRankOf(priority) > priorityRankOf(old) && priorityRankOf(priority) >= priorityRankOf(PriorityHigh) {
+		text := tr(lang, "priority_escalated_topic", getPriorityText(lang, priority), displayName(by))
+		if t.AssigneeID != 0 && t.AssigneeID != by.ID {
+			text += tr(lang, "priority_escalated_assignee", t.AssigneeName)
+		}
+		s.notifyTopic(t, text)
+		return
+	}
+	s.notifyTopic(t, tr(lang, "priority_changed_topic", getPriorityText(lang, old), getPriorityText(lang, priority), displayName(by)))
+}
+
+// priorityButtons возвращает кнопки карточки для понижения и повышения
+// приоритета на один уровень.
+func (s *Service) priorityButtons(markup *telebot.ReplyMarkup, t *Ticket) telebot.Row {
+	lang := s.supportLanguage()
+	rank := priorityRankOf(t.Priority)
+	var row telebot.Row
+	if rank > 0 {
+		lower := priorities[rank-1]
+		row = append(row, markup.Data(tr(lang, "btn_priority_down", getPriorityText(lang, lower)), fmt.Sprintf("priority_btn_%d", t.ID), lower))
+	}
+	if rank < len(priorities)-1 {
+		higher := priorities[rank+1]
+		row = append(row, markup.Data(tr(lang, "btn_priority_up", getPriorityText(lang, higher)), fmt.Sprintf("priority_btn_%d", t.ID), higher))
+	}
+	return row
+}
+
+// urgencyMarkup — кнопки выбора срочности под сообщением о создании обращения.
+func urgencyMarkup(lang string, ticketID int64) *telebot.ReplyMarkup {
+	markup := &telebot.ReplyMarkup{}
+	var row telebot.Row
+	for _, p := range userPriorities {
+		row = append(row, markup.Data(tr(lang, "btn_urgency_"+p), fmt.Sprintf("urgency_%d", ticketID), p))
+	}
+	markup.Inline(row)
+	return markup
+}
+
+// handlePriorityButton — кнопка карточки: priority_btn_<id>|<приоритет>.
+func (s *Service) handlePriorityButton(c telebot.Context, ticketID int64, data string) error {
+	lang := s.supportLanguage()
+	_, priority, _ := strings.Cut(data, "|")
+	if !isPriority(priority) {
+		return s.respond(c)
+	}
+
+	ticket, err := s.store.GetTicket(ticketID)
+	if err != nil {
+		log.Printf("Ошибка получения тикета: %v", err)
+		return s.respond(c)
+	}
+	if ticket.Status == "closed" {
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "ticket_is_closed")})
+	}
+
+	if err := s.setTicketPriority(ticket, priority, c.Sender(), c.Message()); err != nil {
+		log.Printf("Ошибка изменения приоритета: %v", err)
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "error_priority")})
+	}
+	return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "priority_set", ticket.ID, getPriorityText(lang, priority))})
+}
+
+// handleUrgencyButton — выбор срочности пользователем: urgency_<id>|<приоритет>.
+// Кнопки одноразовые и после выбора убираются.
+func (s *Service) handleUrgencyButton(c telebot.Context, ticketID int64, data string) error {
+	lang := s.userLanguage(c.Sender())
+	_, priority, _ := strings.Cut(data, "|")
+	allowed := false
+	for _, p := range userPriorities {
+		allowed = allowed || p == priority
+	}
+	if !allowed {
+		return s.respond(c)
+	}
+
+	ticket, err := s.store.GetTicket(ticketID)
+	if err != nil {
+		log.Printf("Ошибка получения тикета: %v", err)
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "error_data")})
+	}
+	if ticket.UserID != c.Sender().ID {
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "not_your_ticket")})
+	}
+	if ticket.Status == "closed" {
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "already_closed")})
+	}
+
+	// Срочность пользователя применяется, только пока приоритет не
+	// выставляла поддержка: её решение она не перекрывает
+	if !ticket.PrioritySetBySupport && ticket.Priority != priority {
+		applied, err := s.store.SetUserTicketPriority(ticket.ID, priority)
+		if err != nil {
+			log.Printf("Ошибка изменения приоритета: %v", err)
+			return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "error_data")})
+		}
+		if applied {
+			old := ticket.Priority
+			ticket.Priority = priority
+			s.priorityChanged(ticket, old, c.Sender(), nil)
+		}
+	}
+
+	text := c.Message().Text + tr(lang, "urgency_set", tr(lang, "btn_urgency_"+priority))
+	if _, err := s.bot.Edit(c.Message(), text, &telebot.SendOptions{}); err != nil {
+		log.Printf("Ошибка обновления сообщения о создании обращения: %v", err)
+	}
+	return s.respond(c)
+}
+
+// handlePriorityCommand — /priority [low|normal|high|urgent] в теме обращения.
+// Без аргумента показывает текущий приоритет.
+func (s *Service) handlePriorityCommand(c telebot.Context) error {
+	ticket, err := s.topicTicket(c)
+	if ticket == nil {
+		return err
+	}
+
+	lang := s.supportLanguage()
+	priority := strings.ToLower(strings.TrimSpace(c.Message().Payload))
+	if priority == "" {
+		return s.reply(c, tr(lang, "priority_current", ticket.ID, getPriorityText(lang, ticket.Priority))+"\n\n"+tr(lang, "priority_usage"))
+	}
+	if !isPriority(priority) {
+		return s.reply(c, tr(lang, "priority_usage"))
+	}
+	if ticket.Status == "closed" {
+		return s.reply(c, tr(lang, "ticket_is_closed"))
+	}
+
+	if err := s.setTicketPriority(ticket, priority, c.Sender(), nil); err != nil {
+		log.Printf("Ошибка изменения приоритета: %v", err)
+		return s.reply(c, tr(lang, "error_priority"))
+	}
+	return s.reply(c, tr(lang, "priority_set", ticket.ID, getPriorityText(lang, priority)))
+}
+
+// handleQueueCommand — /queue [фильтры /search] в группе поддержки:
+// незакрытые обращения, сначала срочные, среди равных — старые.
+func (s *Service) handleQueueCommand(c telebot.Context) error {
+	if c.Chat().ID != s.cfg.SupportGroupID {
+		return nil
+	}
+
+	lang := s.supportLanguage()
+	q, err := parseSearchQuery(c.Message().Payload)
+	if err != nil {
+		log.Printf("Неверный запрос очереди %q: %v", c.Message().Payload, err)
+		return s.reply(c, tr(lang, "queue_usage"))
+	}
+	q.ByPriority = true
+	q.Active = q.Status == ""
+
+	text, markup, err := s.searchPage(s.rememberSearch(q), q, 0)
+	if err != nil {
+		log.Printf("Ошибка получения очереди: %v", err)
+		return s.reply(c, tr(lang, "error_search"))
+	}
+	return s.reply(c, text, markup)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Ограничение частоты: сообщения сверх лимита не пересылаются в тему,
+// а новые обращения сверх лимита не создаются. О первом отказе подряд
+// сообщается пользователю и агентам, остальные отбрасываются молча,
+// чтобы бот сам не превращался в источник спама.
+
+// rateLimiter считает события каждого пользователя в скользящем окне.
+// Нулевой лимит ничего не ограничивает. Раз в окно пользователи без
+// событий в нём забываются, чтобы карты не росли бесконечно.
+type rateLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	events    map[int64][]time.Time
+	throttled map[int64]bool
+	prunedAt  time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:     limit,
+		window:    window,
+		events:    map[int64][]time.Time{},
+		throttled: map[int64]bool{},
+	}
+}
+
+// allow регистрирует событие пользователя, если оно укладывается в лимит.
+// first истинно для первого отказа подряд: о нём стоит уведомить.
+func (l *rateLimiter) allow(userID int64, now time.Time) (ok, first bool) {
+	if l.limit <= 0 {
+		return true, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-l.window)
+	if now.Sub(l.prunedAt) >= l.window {
+		l.prune(cutoff)
+		l.prunedAt = now
+	}
+
+	events := l.events[userID]
+	i := 0
+	for i < len(events) && !events[i].After(cutoff) {
+		i++
+	}
+	events = events[i:]
+
+	if len(events) < l.limit {
+		l.events[userID] = append(events, now)
+		delete(l.throttled, userID)
+		return true, false
+	}
+
+	l.events[userID] = events
+	first = !l.throttled[userID]
+	l.throttled[userID] = true
+	return false, first
+}
+
+// prune забывает пользователей, последнее событие которых не позже cutoff.
+func (l *rateLimiter) prune(cutoff time.Time) {
+	for userID, events := range l.events {
+		if len(events) == 0 || !events[len(events)-1].After(cutoff) {
+			delete(l.events, userID)
+			delete(l.throttled, userID)
+		}
+	}
+}
+
+// reset забывает события пользователя, например после разблокировки.
+func (l *rateLimiter) reset(userID int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.events, userID)
+	delete(l.throttled, userID)
+}
+
+// throttleMessage проверяет лимит сообщений в обращение. Возвращает true,
+// если сообщение не нужно пересылать.
+func (s *Service) throttleMessage(c telebot.Context, ticket *Ticket) (bool, error) {
+	ok, first := s.messageLimiter.allow(c.Sender().ID, time.Now())
+	if ok {
+		return false, nil
+	}
+	if !first {
+		return true, nil
+	}
+
+	log.Printf("Пользователь %d превысил лимит сообщений в обращении #%d", c.Sender().ID, ticket.ID)
+	window := humanDuration(s.supportLanguage(), s.messageLimiter.window)
+	s.notifyTopic(ticket, tr(s.supportLanguage(), "rate_limited_topic", s.messageLimiter.limit, window))
+
+	lang := s.userLanguage(c.Sender())
+	return true, s.send(c, tr(lang, "rate_limited_messages", humanDuration(lang, s.messageLimiter.window)))
+}
+
+// throttleTicketCreation проверяет лимит новых обращений. Агентов
+// предупреждает в теме последнего обращения пользователя.
+func (s *Service) throttleTicketCreation(c telebot.Context) (bool, error) {
+	ok, first := s.ticketLimiter.allow(c.Sender().ID, time.Now())
+	if ok {
+		return false, nil
+	}
+	if !first {
+		return true, nil
+	}
+
+	log.Printf("Пользователь %d превысил лимит создания обращений", c.Sender().ID)
+	tickets, err := s.store.GetUserTickets(c.Sender().ID, 1)
+	if err != nil {
+		log.Printf("Ошибка получения обращений пользователя: %v", err)
+	}
+	if len(tickets) > 0 && tickets[0].ThreadID != 0 {
+		window := humanDuration(s.supportLanguage(), s.ticketLimiter.window)
+		s.notifyTopic(&tickets[0], tr(s.supportLanguage(), "rate_limited_tickets_topic", s.ticketLimiter.limit, window))
+	}
+
+	lang := s.userLanguage(c.Sender())
+	return true, s.send(c, tr(lang, "rate_limited_tickets", humanDuration(lang, s.ticketLimiter.window)))
+}
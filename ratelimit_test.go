@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	start := time.Date(2026, 1, 10, 10, 0, 0, 0, time.UTC)
+
+	type event struct {
+		userID    int64
+		after     time.Duration
+		wantOK    bool
+		wantFirst bool
+	}
+	tests := []struct {
+		name   string
+		limit  int
+		events []event
+	}{
+		{"без лимита", 0, []event{
+			{1, 0, true, false},
+			{1, 0, true, false},
+			{1, 0, true, false},
+		}},
+		{"лимит в окне", 2, []event{
+			{1, 0, true, false},
+			{1, time.Second, true, false},
+			{1, 2 * time.Second, false, true},
+			{1, 3 * time.Second, false, false},
+			{2, 3 * time.Second, true, false},
+		}},
+		{"окно скользит", 2, []event{
+			{1, 0, true, false},
+			{1, 30 * time.Second, true, false},
+			{1, 59 * time.Second, false, true},
+			{1, 61 * time.Second, true, false},
+			{1, 62 * time.Second, false, true},
+			{1, 91 * time.Second, true, false},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(tt.limit, time.Minute)
+			for i, e := range tt.events {
+				ok, first := l.allow(e.userID, start.Add(e.after))
+				if ok != e.wantOK || first != e.wantFirst {
+					t.Fatalf("событие %d: ok=%v first=%v, ожидалось ok=%v first=%v", i+1, ok, first, e.wantOK, e.wantFirst)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	start := time.Date(2026, 1, 10, 10, 0, 0, 0, time.UTC)
+	l := newRateLimiter(1, time.Minute)
+
+	l.allow(1, start)
+	l.allow(1, start.Add(time.Second))
+	l.allow(2, start.Add(30*time.Second))
+
+	// Через окно после прошлой очистки забываются все, кто молчал дольше окна
+	l.allow(3, start.Add(80*time.Second))
+	if _, ok := l.events[1]; ok {
+		t.Fatalf("пользователь 1 не забыт")
+	}
+	if l.throttled[1] {
+		t.Fatalf("отметка об отказе пользователю 1 не снята")
+	}
+	if _, ok := l.events[2]; !ok {
+		t.Fatalf("пользователь 2 забыт раньше окна")
+	}
+
+	// До конца следующего окна очистка не повторяется
+	l.allow(4, start.Add(100*time.Second))
+	if _, ok := l.events[2]; !ok {
+		t.Fatalf("очистка выполнена чаще раза в окно")
+	}
+	l.allow(4, start.Add(141*time.Second))
+	if _, ok := l.events[4]; !ok || len(l.events) != 1 {
+		t.Fatalf("после очистки остались пользователи %v", l.events)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Повторное открытие закрытого обращения. Тикет возвращается в статус
+// open с тем же thread_id, поэтому переписка продолжается в старой теме.
+
+var (
+	errTicketNotClosed = errors.New("обращение не закрыто")
+	errHasOpenTicket   = errors.New("у пользователя есть другое активное обращение")
+)
+
+// reopenTicket открывает обращение заново, обновляет карточку и уведомляет
+// вторую сторону: пользователя, если обращение открыл агент, и тему,
+// если обращение открыл пользователь.
+func (s *Service) reopenTicket(ticket *Ticket, by *telebot.User, bySupport bool) error {
+	if ticket.Status != "closed" {
+		return errTicketNotClosed
+	}
+
+	// У пользователя может быть только одно активное обращение
+	other, err := s.store.GetOpenUserTicket(ticket.UserID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if other != nil {
+		return errHasOpenTicket
+	}
+
+	if err := s.changeTicketStatus(ticket, "open", by, bySupport); err != nil {
+		return err
+	}
+
+	s.refreshTicketViews(ticket, "closed", nil)
+
+	if bySupport {
+		s.notifyUser(ticket, tr(s.languageOf(ticket.UserID), "reopened_by_support", ticket.ID))
+		return nil
+	}
+
+	s.notifyTopic(ticket, tr(s.supportLanguage(), "reopened_by_user", ticket.ID, displayName(by)))
+	return nil
+}
+
+func reopenErrorText(lang string, ticket *Ticket, err error) string {
+	switch {
+	case errors.Is(err, errTicketNotClosed):
+		return tr(lang, "reopen_not_closed", ticket.ID)
+	case errors.Is(err, errHasOpenTicket):
+		return tr(lang, "reopen_has_open")
+	default:
+		log.Printf("Ошибка переоткрытия обращения #%d: %v", ticket.ID, err)
+		return tr(lang, "error_reopen")
+	}
+}
+
+func (s *Service) reopenButton(markup *telebot.ReplyMarkup, ticketID int64) telebot.Btn {
+	return markup.Data(tr(s.supportLanguage(), "btn_reopen"), fmt.Sprintf("reopen_btn_%d", ticketID))
+}
+
+// handleUserReopenButton — кнопка «Возобновить» в истории обращений пользователя.
+func (s *Service) handleUserReopenButton(c telebot.Context, ticketID int64) error {
+	ticket, err := s.store.GetTicket(ticketID)
+	if err != nil {
+		log.Printf("Ошибка получения тикета: %v", err)
+		return s.respond(c)
+	}
+
+	lang := s.userLanguage(c.Sender())
+	if ticket.UserID != c.Sender().ID {
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "not_your_ticket")})
+	}
+
+	if err := s.reopenTicket(ticket, c.Sender(), false); err != nil {
+		if errors.Is(err, errHasOpenTicket) {
+			return s.respond(c, &telebot.CallbackResponse{
+				Text:      tr(lang, "reopen_has_open_you"),
+				ShowAlert: true,
+			})
+		}
+		return s.respond(c, &telebot.CallbackResponse{Text: reopenErrorText(lang, ticket, err)})
+	}
+
+	if err := s.send(c, tr(lang, "reopened_user", ticket.ID)); err != nil {
+		log.Printf("Ошибка отправки сообщения: %v", err)
+	}
+	return s.respond(c)
+}
+
+func (s *Service) handleReopenButton(c telebot.Context, ticketID int64) error {
+	ticket, err := s.store.GetTicket(ticketID)
+	if err != nil {
+		log.Printf("Ошибка получения тикета: %v", err)
+		return s.respond(c)
+	}
+
+	if err := s.reopenTicket(ticket, c.Sender(), true); err != nil {
+		return s.respond(c, &telebot.CallbackResponse{Text: reopenErrorText(s.supportLanguage(), ticket, err), ShowAlert: true})
+	}
+
+	return s.respond(c, &telebot.CallbackResponse{Text: tr(s.supportLanguage(), "reopened_cb")})
+}
+
+func (s *Service) handleReopenCommand(c telebot.Context) error {
+	ticket, err := s.topicTicket(c)
+	if ticket == nil {
+		return err
+	}
+
+	if err := s.reopenTicket(ticket, c.Sender(), true); err != nil {
+		return s.reply(c, reopenErrorText(s.supportLanguage(), ticket, err))
+	}
+
+	return s.reply(c, tr(s.supportLanguage(), "reopened_agent", ticket.ID))
+}
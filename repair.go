@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Восстановление тем обращений. Обращение остаётся без темы (thread_id = 0),
+// если createForumTopic не удался при его создании или тему удалили
+// в группе: тогда удалённая тема замечается по ошибке отправки в неё.
+// Новую тему создаёт фоновая задача, следующее сообщение пользователя
+// или команда /repair, после чего в тему заново отправляются карточка
+// и сохранённая переписка.
+
+// Ошибки Bot API, означающие, что темы больше нет
+var topicGoneErrors = []string{"message thread not found", "TOPIC_ID_INVALID", "TOPIC_DELETED"}
+
+func topicGone(err error) bool {
+	for _, marker := range topicGoneErrors {
+		if strings.Contains(err.Error(), marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// topicLost отвязывает обращение от удалённой темы threadID, чтобы её
+// восстановили.
+func (s *Service) topicLost(ticketID int64, threadID int) {
+	reset, err := s.store.ResetTicketThread(ticketID, threadID)
+	if err != nil {
+		log.Printf("Ошибка сброса темы обращения #%d: %v", ticketID, err)
+		return
+	}
+	if reset {
+		log.Printf("Тема %d обращения #%d удалена, обращение ждёт восстановления темы", threadID, ticketID)
+	}
+}
+
+func (s *Service) startTopicRepairScheduler(policy TopicRepairConfig) {
+	s.startPeriodic(policy.Interval.Duration, func(time.Time) {
+		s.repairTopics(policy.BatchSize)
+	})
+}
+
+// repairTopics восстанавливает темы не более чем limit обращений без темы.
+func (s *Service) repairTopics(limit int) (repaired, failed int) {
+	tickets, err := s.store.ListTicketsWithoutTopic(limit)
+	if err != nil {
+		log.Printf("Ошибка выборки обращений без темы: %v", err)
+		return 0, 0
+	}
+
+	for i := range tickets {
+		if err := s.repairTicketTopic(&tickets[i], 0); err != nil {
+			log.Printf("Ошибка восстановления темы обращения #%d: %v", tickets[i].ID, err)
+			failed++
+			continue
+		}
+		repaired++
+	}
+	return repaired, failed
+}
+
+// repairTicketTopic создаёт обращению t тему вместо темы oldThreadID
+// (0 — темы нет) и отправляет в неё карточку и переписку из истории.
+// Если обращение уже привязано к другой теме, t только перечитывается.
+func (s *Service) repairTicketTopic(t *Ticket, oldThreadID int) error {
+	s.repairMu.Lock()
+	defer s.repairMu.Unlock()
+
+	current, err := s.store.GetTicket(t.ID)
+	if err != nil {
+		return err
+	}
+	*t = *current
+	if t.ThreadID != oldThreadID {
+		return nil
+	}
+	if t.ArchivedAt != "" {
+		return fmt.Errorf("переписка обращения в архиве")
+	}
+
+	threadID, err := s.createForumTopic(s.topicName(t), s.topicIcon(t.Status))
+	if err != nil {
+		return fmt.Errorf("не удалось создать тему: %v", err)
+	}
+	if err := s.store.SetTicketThreadID(t.ID, threadID); err != nil {
+		return fmt.Errorf("ошибка сохранения thread_id: %v", err)
+	}
+	t.ThreadID = threadID
+
+	card, err := s.bot.Send(
+		telebot.ChatID(s.cfg.SupportGroupID),
+		s.ticketCardText(t),
+		&telebot.SendOptions{
+			ReplyMarkup: s.ticketCardMarkup(t),
+			ThreadID:    threadID,
+		},
+	)
+	if err != nil {
+		log.Printf("Ошибка отправки карточки обращения #%d: %v", t.ID, err)
+	} else {
+		t.CardMessageID = card.ID
+		if err := s.store.SetTicketCardMessageID(t.ID, card.ID); err != nil {
+			log.Printf("Ошибка сохранения карточки: %v", err)
+		}
+	}
+
+	history, err := s.store.GetTicketHistory(t.ID)
+	if err != nil {
+		log.Printf("Ошибка получения истории: %v", err)
+	}
+	lang := s.supportLanguage()
+	s.notifyTopic(t, tr(lang, "topic_restored", len(history)))
+	for _, m := range history {
+		if _, deferred, err := s.enqueue(s.replayOutbox(t, m, lang)); err != nil && !deferred {
+			log.Printf("Ошибка отправки переписки в тему обращения #%d: %v", t.ID, err)
+		}
+	}
+
+	if t.Status == "closed" {
+		if err := s.closeForumTopic(threadID); err != nil {
+			log.Printf("Ошибка закрытия темы обращения #%d: %v", t.ID, err)
+		}
+	}
+	log.Printf("Тема обращения #%d восстановлена (тема %d, сообщений: %d)", t.ID, threadID, len(history))
+	return nil
+}
+
+// replayOutbox готовит сообщение истории для отправки в новую тему.
+// Сообщения пользователя связываются с копиями, чтобы ответы на них
+// в теме попадали в ответ на исходное сообщение.
+func (s *Service) replayOutbox(t *Ticket, m TicketMessage, lang string) OutboxMessage {
+	sender := t.UserFullName
+	if t.UserName != "" {
+		sender = strings.TrimSpace(sender + " (@" + t.UserName + ")")
+	}
+	switch {
+	case m.IsInternal:
+		sender = tr(lang, "transcript_note", m.UserName)
+	case m.IsSupport:
+		sender = tr(lang, "sender_support", m.UserName)
+	}
+
+	out := OutboxMessage{
+		TicketID:  t.ID,
+		ChatID:    s.cfg.SupportGroupID,
+		ThreadID:  t.ThreadID,
+		Text:      tr(lang, "replay_header", sender, m.Date) + m.Text,
+		MediaType: m.MediaType,
+		FileID:    m.FileID,
+	}
+	if !m.IsSupport {
+		out.SourceMessageID = m.MessageID
+	}
+	return out
+}
+
+// handleRepairCommand — /repair [id [force]] в группе поддержки. С номером
+// заново создаёт тему обращения, если прежней темы больше нет: её
+// существование проверяется через editForumTopic. Живую тему заменяет
+// только /repair id force. Без номера восстанавливает темы всех
+// обращений без темы.
+func (s *Service) handleRepairCommand(c telebot.Context) error {
+	if c.Chat().ID != s.cfg.SupportGroupID {
+		return nil
+	}
+
+	lang := s.supportLanguage()
+	args := strings.Fields(c.Message().Payload)
+	if len(args) == 0 {
+		repaired, failed := s.repairTopics(s.cfg.TopicRepair.BatchSize)
+		return s.reply(c, tr(lang, "repair_done", repaired, failed))
+	}
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(args[0], "#"), 10, 64)
+	if err != nil || len(args) > 2 || (len(args) == 2 && args[1] != "force") {
+		return s.reply(c, tr(lang, "repair_usage"))
+	}
+	force := len(args) == 2
+
+	ticket, err := s.store.GetTicket(id)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Ошибка получения тикета: %v", err)
+		}
+		return s.reply(c, tr(lang, "topic_ticket_absent"))
+	}
+
+	if ticket.ThreadID != 0 && !force {
+		err := s.editForumTopic(ticket.ThreadID, s.topicName(ticket), s.topicIcon(ticket.Status))
+		switch {
+		case err == nil:
+			return s.reply(c, tr(lang, "repair_topic_exists", ticket.ID, s.topicLink(ticket.ThreadID), ticket.ID))
+		case !topicGone(err):
+			log.Printf("Ошибка проверки темы обращения #%d: %v", ticket.ID, err)
+			return s.reply(c, tr(lang, "repair_failed", ticket.ID, err.Error()))
+		}
+	}
+
+	oldThreadID := ticket.ThreadID
+	if err := s.repairTicketTopic(ticket, oldThreadID); err != nil {
+		log.Printf("Ошибка восстановления темы обращения #%d: %v", ticket.ID, err)
+		return s.reply(c, tr(lang, "repair_failed", ticket.ID, err.Error()))
+	}
+	// Заменённую тему закрываем, чтобы в ней больше не писали
+	if force && oldThreadID != 0 && ticket.ThreadID != oldThreadID {
+		if err := s.closeForumTopic(oldThreadID); err != nil && !topicGone(err) {
+			log.Printf("Ошибка закрытия прежней темы обращения #%d: %v", ticket.ID, err)
+		}
+	}
+	return s.reply(c, tr(lang, "repair_ticket_done", ticket.ID, s.topicLink(ticket.ThreadID)))
+}
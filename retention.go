@@ -0,0 +1,198 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Сколько строк отчёта выводить, чтобы не превысить лимит длины сообщения
+const maxReportLines = 30
+
+type TicketArchive struct {
+	ArchivedAt string              `json:"archived_at"`
+	Ticket     Ticket              `json:"ticket"`
+	Messages   []TicketMessage     `json:"messages"`
+	Edits      []TicketMessageEdit `json:"edits,omitempty"`
+}
+
+type ArchivedTicket struct {
+	TicketID int64
+	Messages int
+	File     string
+}
+
+// RetentionReport описывает результат одного прохода политики хранения.
+type RetentionReport struct {
+	StartedAt time.Time
+	Archived  []ArchivedTicket
+	Errors    []RetentionError
+}
+
+// RetentionError — ошибка прохода архивации. Stage — ключ каталога строк
+// с описанием шага, на котором она произошла; TicketID равен нулю, если
+// ошибка не относится к конкретному обращению.
+type RetentionError struct {
+	TicketID int64
+	Stage    string
+	Err      error
+}
+
+// Format возвращает строку отчёта об ошибке на языке lang.
+func (e RetentionError) Format(lang string) string {
+	if e.TicketID == 0 {
+		return tr(lang, e.Stage, e.Err)
+	}
+	return fmt.Sprintf("#%d: %s", e.TicketID, tr(lang, e.Stage, e.Err))
+}
+
+// Format возвращает отчёт на языке lang.
+func (r *RetentionReport) Format(lang string) string {
+	var b strings.Builder
+	b.WriteString(tr(lang, "retention_header", r.StartedAt.Format(DateTimeLayout), len(r.Archived)))
+
+	total := 0
+	for _, a := range r.Archived {
+		total += a.Messages
+	}
+	b.WriteString(tr(lang, "retention_deleted", total))
+
+	for i, a := range r.Archived {
+		if i == maxReportLines {
+			b.WriteString(tr(lang, "and_more", len(r.Archived)-maxReportLines))
+			break
+		}
+		b.WriteString(tr(lang, "retention_line", a.TicketID, a.Messages, filepath.Base(a.File)))
+	}
+
+	if len(r.Errors) > 0 {
+		b.WriteString(tr(lang, "retention_errors", len(r.Errors)))
+		for i, e := range r.Errors {
+			if i == maxReportLines {
+				b.WriteString(tr(lang, "and_more", len(r.Errors)-maxReportLines))
+				break
+			}
+			b.WriteString("• " + e.Format(lang) + "\n")
+		}
+	}
+	return b.String()
+}
+
+func (s *Service) startRetentionScheduler(policy RetentionConfig) {
+	s.startPeriodic(policy.Interval.Duration, func(now time.Time) {
+		report := s.applyRetention(policy, now)
+		if len(report.Archived) > 0 || len(report.Errors) > 0 {
+			log.Print(report.Format(s.supportLanguage()))
+			s.sendRetentionReport(report)
+		}
+	})
+}
+
+// applyRetention архивирует закрытые обращения старше срока хранения:
+// переписка выгружается в сжатый JSON-файл и только после успешной
+// записи удаляется из БД. Открытые обращения не затрагиваются.
+func (s *Service) applyRetention(policy RetentionConfig, now time.Time) *RetentionReport {
+	report := &RetentionReport{StartedAt: now}
+
+	if err := os.MkdirAll(policy.ArchiveDir, 0o750); err != nil {
+		report.Errors = append(report.Errors, RetentionError{Stage: "retention_error_dir", Err: err})
+		return report
+	}
+
+	cutoff := now.AddDate(0, 0, -policy.ArchiveAfterDays).Format(DateTimeLayout)
+	for {
+		tickets, err := s.store.ListArchivableTickets(cutoff, policy.BatchSize)
+		if err != nil {
+			report.Errors = append(report.Errors, RetentionError{Stage: "retention_error_list", Err: err})
+			return report
+		}
+
+		archived := 0
+		for _, t := range tickets {
+			a, stage, err := s.archiveTicket(policy.ArchiveDir, t, now)
+			if err != nil {
+				report.Errors = append(report.Errors, RetentionError{TicketID: t.ID, Stage: stage, Err: err})
+				continue
+			}
+			report.Archived = append(report.Archived, *a)
+			archived++
+		}
+
+		// Если в пачке ничего не удалось архивировать, повтор даст те же ошибки
+		if len(tickets) < policy.BatchSize || archived == 0 {
+			return report
+		}
+	}
+}
+
+// archiveTicket архивирует обращение t. При ошибке возвращает и ключ
+// шага, на котором она произошла (см. RetentionError).
+func (s *Service) archiveTicket(dir string, t Ticket, now time.Time) (*ArchivedTicket, string, error) {
+	history, err := s.store.GetTicketHistory(t.ID)
+	if err != nil {
+		return nil, "retention_error_history", err
+	}
+	edits, err := s.store.GetTicketEdits(t.ID)
+	if err != nil {
+		return nil, "retention_error_edits", err
+	}
+
+	archivedAt := now.Format(DateTimeLayout)
+	path := filepath.Join(dir, fmt.Sprintf("ticket-%d.json.gz", t.ID))
+	if t.ArchivedAt != "" {
+		// Обращение переоткрыли после архивации: прежний архив сохраняется
+		path = filepath.Join(dir, fmt.Sprintf("ticket-%d-%s.json.gz", t.ID, now.Format("20060102-150405")))
+	}
+	if err := writeArchive(path, TicketArchive{ArchivedAt: archivedAt, Ticket: t, Messages: history, Edits: edits}); err != nil {
+		return nil, "retention_error_write", err
+	}
+
+	if err := s.store.ArchiveTicket(t.ID, archivedAt); err != nil {
+		return nil, "retention_error_delete", err
+	}
+
+	return &ArchivedTicket{TicketID: t.ID, Messages: len(history), File: path}, "", nil
+}
+
+// writeArchive пишет архив во временный файл и переименовывает его,
+// чтобы на диске никогда не оставалось частично записанных архивов.
+func writeArchive(path string, archive TicketArchive) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	zw := gzip.NewWriter(tmp)
+	enc := json.NewEncoder(zw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(archive); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// sendRetentionReport ставит отчёт в очередь отправки в общую тему группы.
+func (s *Service) sendRetentionReport(report *RetentionReport) {
+	out := OutboxMessage{ChatID: s.cfg.SupportGroupID, Text: report.Format(s.supportLanguage())}
+	if _, deferred, err := s.enqueue(out); err != nil && !deferred {
+		log.Printf("Ошибка отправки отчёта архивации: %v", err)
+	}
+}
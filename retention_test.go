@@ -0,0 +1,214 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+func readArchive(t *testing.T, path string) TicketArchive {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("открытие архива: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("чтение архива: %v", err)
+	}
+	var a TicketArchive
+	if err := json.NewDecoder(zr).Decode(&a); err != nil {
+		t.Fatalf("разбор архива: %v", err)
+	}
+	return a
+}
+
+func TestRetentionKeepsEdits(t *testing.T) {
+	e := newHandlerEnv(t)
+	ticket, card := e.createTicket(t)
+	e.topicMessage(t, ticket.ThreadID, "Проверяем платёж")
+
+	history, err := e.store.GetTicketHistory(ticket.ID)
+	if err != nil {
+		t.Fatalf("GetTicketHistory: %v", err)
+	}
+	edit := TicketMessageEdit{
+		MessageID: history[0].ID,
+		OldText:   history[0].Text,
+		NewText:   "Не проходит оплата картой Visa",
+		Date:      time.Now().Format(DateTimeLayout),
+	}
+	if err := e.store.EditTicketMessage(edit); err != nil {
+		t.Fatalf("EditTicketMessage: %v", err)
+	}
+	e.press(t, e.agent, card, "close_btn_"+strconv.FormatInt(ticket.ID, 10))
+
+	policy := defaultConfig().Retention
+	policy.ArchiveDir = t.TempDir()
+	report := e.svc.applyRetention(policy, time.Now().AddDate(0, 0, policy.ArchiveAfterDays+1))
+	if len(report.Errors) > 0 || len(report.Archived) != 1 {
+		t.Fatalf("архивировано %d, ошибки: %v", len(report.Archived), report.Errors)
+	}
+
+	a := readArchive(t, report.Archived[0].File)
+	if len(a.Messages) != len(history) || a.Messages[0].Text != edit.NewText {
+		t.Fatalf("в архиве переписка %+v", a.Messages)
+	}
+	if len(a.Edits) != 1 || a.Edits[0].OldText != edit.OldText || a.Edits[0].NewText != edit.NewText {
+		t.Fatalf("в архиве правки %+v", a.Edits)
+	}
+
+	if history, err := e.store.GetTicketHistory(ticket.ID); err != nil || len(history) != 0 {
+		t.Fatalf("после архивации в БД переписка %+v, %v", history, err)
+	}
+	var edits int
+	err = e.store.(*SQLStore).db.QueryRow(`SELECT COUNT(*) FROM ticket_message_edits WHERE message_id = $1`, edit.MessageID).Scan(&edits)
+	if err != nil || edits != 0 {
+		t.Fatalf("после архивации в БД правок %d, %v", edits, err)
+	}
+}
+
+// archiveFixture создаёт обращение с одним сообщением; непустой closedAt
+// закрывает его в это время.
+func archiveFixture(t *testing.T, store Store, userID int64, createdAt, closedAt string) int64 {
+	t.Helper()
+	id, err := store.CreateTicket(Ticket{UserID: userID, Title: "Вопрос", CreatedAt: createdAt, Status: "open", Priority: PriorityNormal})
+	if err != nil {
+		t.Fatalf("CreateTicket: %v", err)
+	}
+	if _, err := store.SaveMessage(TicketMessage{TicketID: id, MessageID: 1, UserID: userID, Text: "Вопрос", Date: createdAt}); err != nil {
+		t.Fatalf("SaveMessage: %v", err)
+	}
+	if closedAt != "" {
+		setStatus(t, store, id, "open", "closed", closedAt)
+	}
+	return id
+}
+
+func setStatus(t *testing.T, store Store, id int64, from, to, date string) {
+	t.Helper()
+	if err := store.UpdateTicketStatus(StatusChange{TicketID: id, FromStatus: from, ToStatus: to, Date: date}); err != nil {
+		t.Fatalf("UpdateTicketStatus: %v", err)
+	}
+}
+
+func archiveFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.json.gz"))
+	if err != nil {
+		t.Fatalf("каталог архива: %v", err)
+	}
+	return files
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	now := time.Date(2026, 6, 1, 3, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name         string
+		createdAt    string
+		closedAt     string
+		wantArchived bool
+	}{
+		{"закрыто раньше срока хранения", "2026-01-10 10:00:00", "2026-01-11 10:00:00", true},
+		{"закрыто ровно на границе", "2026-02-20 10:00:00", "2026-03-03 03:00:00", false},
+		{"закрыто недавно", "2026-05-01 10:00:00", "2026-05-20 10:00:00", false},
+		{"открыто давно", "2025-01-10 10:00:00", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newHandlerEnv(t)
+			id := archiveFixture(t, e.store, e.user.ID, tt.createdAt, tt.closedAt)
+
+			policy := defaultConfig().Retention
+			policy.ArchiveDir = t.TempDir()
+			report := e.svc.applyRetention(policy, now)
+			if len(report.Errors) > 0 {
+				t.Fatalf("ошибки архивации: %v", report.Errors)
+			}
+
+			archived := e.ticket(t, id).ArchivedAt != ""
+			if archived != tt.wantArchived || len(report.Archived) != len(archiveFiles(t, policy.ArchiveDir)) {
+				t.Fatalf("архивировано: %v, ожидалось %v (в отчёте %d)", archived, tt.wantArchived, len(report.Archived))
+			}
+			if history, _ := e.store.GetTicketHistory(id); (len(history) == 0) != tt.wantArchived {
+				t.Fatalf("в БД осталось сообщений: %d", len(history))
+			}
+		})
+	}
+}
+
+func TestRetentionReopenedTicket(t *testing.T) {
+	e := newHandlerEnv(t)
+	policy := defaultConfig().Retention
+	policy.ArchiveDir = t.TempDir()
+
+	id := archiveFixture(t, e.store, e.user.ID, "2026-01-10 10:00:00", "2026-01-11 10:00:00")
+	first := e.svc.applyRetention(policy, time.Date(2026, 6, 1, 3, 0, 0, 0, time.Local))
+	if len(first.Archived) != 1 {
+		t.Fatalf("первая архивация: %+v", first)
+	}
+
+	// Обращение возобновили, дописали и снова закрыли
+	setStatus(t, e.store, id, "closed", "open", "2026-06-02 10:00:00")
+	if _, err := e.store.SaveMessage(TicketMessage{TicketID: id, MessageID: 2, UserID: e.user.ID, Text: "Проблема вернулась", Date: "2026-06-02 10:00:00"}); err != nil {
+		t.Fatalf("SaveMessage: %v", err)
+	}
+	setStatus(t, e.store, id, "open", "closed", "2026-06-03 10:00:00")
+
+	if again := e.svc.applyRetention(policy, time.Date(2026, 7, 1, 3, 0, 0, 0, time.Local)); len(again.Archived) != 0 {
+		t.Fatalf("архивировано до срока хранения: %+v", again.Archived)
+	}
+	second := e.svc.applyRetention(policy, time.Date(2026, 10, 1, 3, 0, 0, 0, time.Local))
+	if len(second.Archived) != 1 || second.Archived[0].File == first.Archived[0].File {
+		t.Fatalf("повторная архивация: %+v", second.Archived)
+	}
+
+	if files := archiveFiles(t, policy.ArchiveDir); len(files) != 2 {
+		t.Fatalf("в каталоге архива %v", files)
+	}
+	a := readArchive(t, second.Archived[0].File)
+	if len(a.Messages) != 1 || a.Messages[0].Text != "Проблема вернулась" {
+		t.Fatalf("во втором архиве переписка %+v", a.Messages)
+	}
+	if a := readArchive(t, first.Archived[0].File); len(a.Messages) != 1 || a.Messages[0].Text != "Вопрос" {
+		t.Fatalf("первый архив изменился: %+v", a.Messages)
+	}
+}
+
+func TestRetentionReport(t *testing.T) {
+	e := newHandlerEnv(t)
+	e.svc.cfg.SupportLanguage = "en"
+
+	// Вместо каталога архива — файл, создать каталог не получится
+	policy := defaultConfig().Retention
+	policy.ArchiveDir = filepath.Join(t.TempDir(), "archive")
+	if err := os.WriteFile(policy.ArchiveDir, nil, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	report := e.svc.applyRetention(policy, time.Now())
+	if len(report.Errors) != 1 || report.Errors[0].Stage != "retention_error_dir" {
+		t.Fatalf("ошибки архивации: %+v", report.Errors)
+	}
+
+	e.svc.sendRetentionReport(report)
+	sent := e.expectSent(t, testGroupID, tr("en", "retention_errors", 1))
+	if want := "• " + tr("en", "retention_error_dir", report.Errors[0].Err); !strings.Contains(sent.Text(), want) {
+		t.Fatalf("в отчёте нет строки %q: %q", want, sent.Text())
+	}
+	// Недоставленный отчёт остаётся в очереди на повтор
+	e.bot.Errors["Send"] = telebot.NewError(502, "Bad Gateway")
+	e.svc.sendRetentionReport(report)
+	if n, err := e.store.CountPendingOutbox(testGroupID, 0); err != nil || n != 1 {
+		t.Fatalf("в очереди отправки %d сообщений: %v", n, err)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Поиск обращений для агентов: /search в группе поддержки ищет по названиям
+// обращений и тексту переписки с фильтрами вида ключ:значение, например
+//
+//	/search возврат денег status:closed user:@ivan assignee:@anna from:2024-01-01 to:2024-01-31
+//
+// Результаты показываются постранично со ссылками на темы обращений.
+
+const (
+	searchPageSize = 10
+	// Сколько последних запросов помнить для кнопок листания
+	maxStoredSearches = 100
+)
+
+// TicketSearch — запрос поиска обращений. Пустые поля не ограничивают
+// выборку. From и To ограничивают дату создания интервалом [From, To).
+type TicketSearch struct {
+	Text         string `json:"text,omitempty"`
+	Status       string `json:"status,omitempty"`
+	Priority     string `json:"priority,omitempty"`
+	UserID       int64  `json:"user_id,omitempty"`
+	UserName     string `json:"user_name,omitempty"`
+	AssigneeID   int64  `json:"assignee_id,omitempty"`
+	AssigneeName string `json:"assignee_name,omitempty"`
+	From         string `json:"from,omitempty"`
+	To           string `json:"to,omitempty"`
+	// Active оставляет только незакрытые обращения, если Status не задан
+	Active bool `json:"active,omitempty"`
+	// ByPriority упорядочивает очередь: сначала срочные, среди равных — старые
+	ByPriority bool `json:"by_priority,omitempty"`
+
+	Limit  int `json:"limit,omitempty"`
+	Offset int `json:"offset,omitempty"`
+}
+
+// TicketSearchResult — страница результатов поиска.
+type TicketSearchResult struct {
+	Tickets []Ticket `json:"tickets"`
+	Total   int      `json:"total"`
+}
+
+// searchTickets ищет обращения по запросу q. Limit по умолчанию и сверху
+// ограничен размером страницы.
+func (s *Service) searchTickets(q TicketSearch) (*TicketSearchResult, error) {
+	q.Text = strings.TrimSpace(q.Text)
+	if q.Limit <= 0 || q.Limit > searchPageSize {
+		q.Limit = searchPageSize
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	tickets, total, err := s.store.SearchTickets(q)
+	if err != nil {
+		return nil, err
+	}
+	return &TicketSearchResult{Tickets: tickets, Total: total}, nil
+}
+
+// parseSearchQuery разбирает аргументы /search: слова вида ключ:значение
+// становятся фильтрами, остальные — текстом поиска.
+func parseSearchQuery(payload string) (TicketSearch, error) {
+	var (
+		q     TicketSearch
+		words []string
+	)
+	for _, field := range strings.Fields(payload) {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok || value == "" {
+			words = append(words, field)
+			continue
+		}
+
+		switch strings.ToLower(key) {
+		case "status":
+			switch value {
+			case "open", "in_progress", "closed":
+				q.Status = value
+			default:
+				return q, fmt.Errorf("неизвестный статус %q", value)
+			}
+		case "priority":
+			if !isPriority(value) {
+				return q, fmt.Errorf("неизвестный приоритет %q", value)
+			}
+			q.Priority = value
+		case "user":
+			id, name := parseSearchPerson(value)
+			q.UserID, q.UserName = id, strings.TrimPrefix(name, "@")
+		case "assignee":
+			q.AssigneeID, q.AssigneeName = parseSearchPerson(value)
+		case "from":
+			d, err := time.ParseInLocation("2006-01-02", value, time.Local)
+			if err != nil {
+				return q, fmt.Errorf("неверная дата %q", value)
+			}
+			q.From = d.Format(DateTimeLayout)
+		case "to":
+			d, err := time.ParseInLocation("2006-01-02", value, time.Local)
+			if err != nil {
+				return q, fmt.Errorf("неверная дата %q", value)
+			}
+			// Дата окончания включается в интервал целиком
+			q.To = d.AddDate(0, 0, 1).Format(DateTimeLayout)
+		default:
+			words = append(words, field)
+		}
+	}
+	q.Text = strings.Join(words, " ")
+	return q, nil
+}
+
+// parseSearchPerson принимает числовой ID, @username или имя.
+func parseSearchPerson(value string) (int64, string) {
+	if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return id, ""
+	}
+	return 0, value
+}
+
+func (s *Service) handleSearchCommand(c telebot.Context) error {
+	if c.Chat().ID != s.cfg.SupportGroupID {
+		return nil
+	}
+
+	lang := s.supportLanguage()
+	q, err := parseSearchQuery(c.Message().Payload)
+	if err != nil {
+		log.Printf("Неверный поисковый запрос %q: %v", c.Message().Payload, err)
+		return s.reply(c, tr(lang, "search_usage"))
+	}
+	if q == (TicketSearch{}) {
+		return s.reply(c, tr(lang, "search_usage"))
+	}
+
+	text, markup, err := s.searchPage(s.rememberSearch(q), q, 0)
+	if err != nil {
+		log.Printf("Ошибка поиска обращений: %v", err)
+		return s.reply(c, tr(lang, "error_search"))
+	}
+	return s.reply(c, text, markup)
+}
+
+func (s *Service) rememberSearch(q TicketSearch) int64 {
+	s.searchesMu.Lock()
+	defer s.searchesMu.Unlock()
+
+	s.lastSearchID++
+	s.searches[s.lastSearchID] = q
+	delete(s.searches, s.lastSearchID-maxStoredSearches)
+	return s.lastSearchID
+}
+
+// handleSearchPageButton листает результаты: данные кнопки search_<id>|<страница>.
+func (s *Service) handleSearchPageButton(c telebot.Context, data string) error {
+	lang := s.supportLanguage()
+	searchID, ok := parseCallbackID(data, "search_")
+	if !ok {
+		return s.respond(c)
+	}
+	_, rawPage, _ := strings.Cut(data, "|")
+	page, err := strconv.Atoi(rawPage)
+	if err != nil || page < 0 {
+		return s.respond(c)
+	}
+
+	s.searchesMu.Lock()
+	q, ok := s.searches[searchID]
+	s.searchesMu.Unlock()
+	if !ok {
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "search_expired"), ShowAlert: true})
+	}
+
+	text, markup, err := s.searchPage(searchID, q, page)
+	if err != nil {
+		log.Printf("Ошибка поиска обращений: %v", err)
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "error_search")})
+	}
+	if _, err := s.bot.Edit(c.Message(), text, markup); err != nil {
+		log.Printf("Ошибка обновления результатов поиска: %v", err)
+	}
+	return s.respond(c)
+}
+
+// searchPage выполняет поиск и формирует страницу page (с нуля) с кнопками листания.
+func (s *Service) searchPage(searchID int64, q TicketSearch, page int) (string, *telebot.SendOptions, error) {
+	lang := s.supportLanguage()
+	q.Limit = searchPageSize
+	q.Offset = page * searchPageSize
+
+	result, err := s.searchTickets(q)
+	if err != nil {
+		return "", nil, err
+	}
+
+	opts := &telebot.SendOptions{DisableWebPagePreview: true}
+	if result.Total == 0 {
+		return tr(lang, "search_empty"), opts, nil
+	}
+
+	pages := (result.Total + searchPageSize - 1) / searchPageSize
+	var b strings.Builder
+	b.WriteString(tr(lang, "search_header", result.Total, page+1, pages))
+	for _, t := range result.Tickets {
+		b.WriteString(s.searchResultLine(lang, t))
+	}
+
+	markup := &telebot.ReplyMarkup{}
+	var nav []telebot.Btn
+	if page > 0 {
+		nav = append(nav, markup.Data(tr(lang, "btn_prev_page"), fmt.Sprintf("search_%d|%d", searchID, page-1)))
+	}
+	if page+1 < pages {
+		nav = append(nav, markup.Data(tr(lang, "btn_next_page"), fmt.Sprintf("search_%d|%d", searchID, page+1)))
+	}
+	if len(nav) > 0 {
+		markup.Inline(markup.Row(nav...))
+		opts.ReplyMarkup = markup
+	}
+	return b.String(), opts, nil
+}
+
+func (s *Service) searchResultLine(lang string, t Ticket) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("\n%s%s #%d %s\n", topicStatusMark(t.Status), priorityMark(t.Priority), t.ID, t.Title))
+
+	user := t.UserFullName
+	if t.UserName != "" {
+		user += " (@" + t.UserName + ")"
+	}
+	b.WriteString(tr(lang, "search_result_user", user, t.CreatedAt))
+	if t.AssigneeID != 0 {
+		b.WriteString(tr(lang, "card_assignee", t.AssigneeName))
+	}
+	if t.ThreadID != 0 {
+		b.WriteString("\n🔗 " + s.topicLink(t.ThreadID))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	day := func(s string) string {
+		d, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			t.Fatalf("дата %q: %v", s, err)
+		}
+		return d.Format(DateTimeLayout)
+	}
+
+	tests := []struct {
+		name    string
+		payload string
+		want    TicketSearch
+		wantErr bool
+	}{
+		{"пустой запрос", "", TicketSearch{}, false},
+		{"только текст", "не проходит  оплата", TicketSearch{Text: "не проходит оплата"}, false},
+		{"фильтры и текст", "оплата status:closed priority:urgent картой",
+			TicketSearch{Text: "оплата картой", Status: "closed", Priority: PriorityUrgent}, false},
+		{"ключ без учёта регистра", "STATUS:open", TicketSearch{Status: "open"}, false},
+		{"пользователь по ID", "user:1001", TicketSearch{UserID: 1001}, false},
+		{"пользователь по @username", "user:@Ivan", TicketSearch{UserName: "Ivan"}, false},
+		{"пользователь по username", "user:ivan", TicketSearch{UserName: "ivan"}, false},
+		{"ответственный по ID", "assignee:2002", TicketSearch{AssigneeID: 2002}, false},
+		{"ответственный по @username", "assignee:@anna", TicketSearch{AssigneeName: "@anna"}, false},
+		{"ответственный по имени", "assignee:Анна", TicketSearch{AssigneeName: "Анна"}, false},
+		{"интервал дат", "from:2026-01-10 to:2026-01-20",
+			TicketSearch{From: day("2026-01-10"), To: day("2026-01-21")}, false},
+		{"неизвестный ключ — текст", "заказ:123", TicketSearch{Text: "заказ:123"}, false},
+		{"пустое значение — текст", "status:", TicketSearch{Text: "status:"}, false},
+		{"неизвестный статус", "status:done", TicketSearch{}, true},
+		{"неизвестный приоритет", "priority:critical", TicketSearch{}, true},
+		{"неверная дата", "from:10.01.2026", TicketSearch{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseSearchQuery(tt.payload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ошибка %v, ожидалась: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && q != tt.want {
+				t.Fatalf("parseSearchQuery(%q) = %+v, ожидалось %+v", tt.payload, q, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSearchPerson(t *testing.T) {
+	tests := []struct {
+		value    string
+		wantID   int64
+		wantName string
+	}{
+		{"1001", 1001, ""},
+		{"-1001", -1001, ""},
+		{"@anna", 0, "@anna"},
+		{"anna", 0, "anna"},
+		{"Анна", 0, "Анна"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			id, name := parseSearchPerson(tt.value)
+			if id != tt.wantID || name != tt.wantName {
+				t.Fatalf("parseSearchPerson(%q) = %d, %q", tt.value, id, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Messenger — методы Bot API, которыми пользуются обработчики. Его реализует
+// *telebot.Bot, а в тестах — FakeMessenger.
+type Messenger interface {
+	Send(to telebot.Recipient, what interface{}, opts ...interface{}) (*telebot.Message, error)
+	Reply(to *telebot.Message, what interface{}, opts ...interface{}) (*telebot.Message, error)
+	Respond(c *telebot.Callback, resp ...*telebot.CallbackResponse) error
+	Edit(msg telebot.Editable, what interface{}, opts ...interface{}) (*telebot.Message, error)
+	EditCaption(msg telebot.Editable, caption string, opts ...interface{}) (*telebot.Message, error)
+	Raw(method string, payload interface{}) ([]byte, error)
+	ChatByID(id int64) (*telebot.Chat, error)
+	ChatMemberOf(chat, user telebot.Recipient) (*telebot.ChatMember, error)
+}
+
+var _ Messenger = (*telebot.Bot)(nil)
+
+// Service объединяет зависимости обработчиков и их состояние в памяти.
+type Service struct {
+	bot   Messenger
+	me    *telebot.User
+	store Store
+	cfg   *Config
+
+	messageLimiter *rateLimiter
+	ticketLimiter  *rateLimiter
+	blockedNotices *rateLimiter
+
+	// Ожидаемые комментарии хранятся в памяти: после перезапуска бота
+	// оценка сохраняется, а запрос комментария просто теряется
+	commentsMu       sync.Mutex
+	awaitingComments map[int64]awaitingComment
+
+	// Запросы хранятся в памяти: после перезапуска бота листать старые
+	// результаты нельзя, поиск нужно повторить
+	searchesMu   sync.Mutex
+	searches     map[int64]TicketSearch
+	lastSearchID int64
+
+	// Не даёт восстановить тему одного обращения дважды
+	repairMu sync.Mutex
+
+	// Постановка в очередь отправки в одну тему идёт по очереди,
+	// см. outboxLock
+	outboxLocks [outboxLockCount]sync.Mutex
+
+	// Выполняющиеся обработчики и фоновые задачи, их ждёт shutdown
+	work sync.WaitGroup
+	// Закрывается при остановке сервиса
+	done chan struct{}
+}
+
+// NewService создаёт сервис. me — учётная запись самого бота: по ней
+// отличаются его собственные сообщения.
+func NewService(bot Messenger, me *telebot.User, store Store, cfg *Config) *Service {
+	s := &Service{
+		bot:              bot,
+		me:               me,
+		store:            store,
+		cfg:              cfg,
+		messageLimiter:   newRateLimiter(0, 0),
+		ticketLimiter:    newRateLimiter(0, 0),
+		blockedNotices:   newRateLimiter(1, time.Hour),
+		awaitingComments: map[int64]awaitingComment{},
+		searches:         map[int64]TicketSearch{},
+		done:             make(chan struct{}),
+	}
+	if policy := cfg.RateLimit; policy.Enabled {
+		s.messageLimiter = newRateLimiter(policy.Messages, policy.MessagesWindow.Duration)
+		s.ticketLimiter = newRateLimiter(policy.Tickets, policy.TicketsWindow.Duration)
+	}
+	return s
+}
+
+// Обработчики отвечают через s.bot, а не через методы контекста, которые
+// обращаются к *telebot.Bot напрямую: так все вызовы Bot API проходят
+// через Messenger.
+
+// send отправляет сообщение в чат, откуда пришло обновление.
+func (s *Service) send(c telebot.Context, what interface{}, opts ...interface{}) error {
+	_, err := s.bot.Send(c.Recipient(), what, opts...)
+	return err
+}
+
+// reply отвечает на сообщение обновления.
+func (s *Service) reply(c telebot.Context, what interface{}, opts ...interface{}) error {
+	msg := c.Message()
+	if msg == nil {
+		return telebot.ErrBadContext
+	}
+	_, err := s.bot.Reply(msg, what, opts...)
+	return err
+}
+
+// respond отвечает на нажатие кнопки.
+func (s *Service) respond(c telebot.Context, resp ...*telebot.CallbackResponse) error {
+	if c.Callback() == nil {
+		return errors.New("telebot: context callback is nil")
+	}
+	return s.bot.Respond(c.Callback(), resp...)
+}
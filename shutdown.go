@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Плавная остановка. telebot.Bot.Stop обрывает запросы к Bot API, в том
+// числе запросы выполняющихся обработчиков, поэтому обновления принимает
+// собственный цикл serve: при остановке он перестаёт опрашивать Telegram,
+// передаёт обработчикам уже полученные обновления, а shutdown ждёт их
+// и фоновые задачи. Затем, пока позволяет таймаут, shutdown ещё раз
+// проходит очередь отправки (outbox.go); не доставленное и тогда уйдёт
+// после запуска.
+
+// trackHandler запускает обработчик в отдельной горутине и учитывает его
+// в s.work. Бот работает в синхронном режиме, поэтому учёт начинается ещё
+// в цикле serve и shutdown не пропустит только что полученное обновление.
+func (s *Service) trackHandler(next telebot.HandlerFunc) telebot.HandlerFunc {
+	return func(c telebot.Context) error {
+		s.work.Add(1)
+		go func() {
+			defer s.work.Done()
+			if err := next(c); err != nil {
+				log.Printf("Ошибка: %v", err)
+			}
+		}()
+		return nil
+	}
+}
+
+// startPeriodic выполняет job сразу и затем каждые interval, пока сервис
+// не остановлен. Начатый проход shutdown дожидается.
+func (s *Service) startPeriodic(interval time.Duration, job func(now time.Time)) {
+	s.work.Add(1)
+	go func() {
+		defer s.work.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			job(time.Now())
+			select {
+			case <-ticker.C:
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// serve передаёт обновления от поллера бота обработчикам, пока не закрыт
+// stop. Возвращается, когда поллер остановлен и все полученные им
+// обновления переданы обработчикам. Если поллер остановился сам, не
+// дождавшись stop, serve возвращает его ошибку.
+func serve(b *telebot.Bot, stop <-chan struct{}) error {
+	updates := make(chan telebot.Update, cap(b.Updates))
+	pollStop := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		b.Poller.Poll(b, updates, pollStop)
+		close(polled)
+	}()
+
+loop:
+	for {
+		select {
+		case u := <-updates:
+			b.ProcessUpdate(u)
+		case <-polled:
+			for len(updates) > 0 {
+				b.ProcessUpdate(<-updates)
+			}
+			if p, ok := b.Poller.(interface{ Err() error }); ok && p.Err() != nil {
+				return p.Err()
+			}
+			return fmt.Errorf("поллер остановился без команды")
+		case <-stop:
+			break loop
+		}
+	}
+
+	close(pollStop)
+	for {
+		select {
+		case u := <-updates:
+			b.ProcessUpdate(u)
+		case <-polled:
+			for len(updates) > 0 {
+				b.ProcessUpdate(<-updates)
+			}
+			confirmUpdates(b)
+			return nil
+		}
+	}
+}
+
+// confirmUpdates сообщает Telegram, что обработаны все обновления до
+// последнего полученного, иначе после перезапуска они придут повторно.
+// Возможное следующее обновление не подтверждается и придёт позже.
+func confirmUpdates(b *telebot.Bot) {
+	p, ok := b.Poller.(*telebot.LongPoller)
+	if !ok || p.LastUpdateID == 0 {
+		return
+	}
+	_, err := b.Raw("getUpdates", map[string]string{
+		"offset":  strconv.Itoa(p.LastUpdateID + 1),
+		"limit":   "1",
+		"timeout": "0",
+	})
+	if err != nil {
+		log.Printf("Ошибка подтверждения обновлений: %v", err)
+	}
+}
+
+// shutdown останавливает фоновые задачи и приём обновлений (stop и served —
+// каналы цикла serve) и ждёт завершения начатой работы не дольше timeout.
+func (s *Service) shutdown(stop chan<- struct{}, served <-chan struct{}, timeout time.Duration) error {
+	deadline := time.After(timeout)
+
+	close(s.done)
+	close(stop)
+	select {
+	case <-served:
+	case <-deadline:
+		return fmt.Errorf("приём обновлений не остановился за %s", timeout)
+	}
+
+	idle := make(chan struct{})
+	go func() {
+		s.work.Wait()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+	case <-deadline:
+		return fmt.Errorf("обработчики и фоновые задачи не завершились за %s", timeout)
+	}
+
+	// Отправляет поставленное в очередь обработчиками, пока хранилище открыто
+	delivered := make(chan struct{})
+	go func() {
+		s.deliverOutbox(time.Now())
+		close(delivered)
+	}()
+	select {
+	case <-delivered:
+		return nil
+	case <-deadline:
+		return fmt.Errorf("очередь отправки не обработана за %s", timeout)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import "errors"
+
+// Формат, в котором даты хранятся в БД и показываются пользователям
+const DateTimeLayout = "2006-01-02 15:04:05"
+
+// ErrNotFound возвращается хранилищем, если запрошенная запись отсутствует.
+var ErrNotFound = errors.New("запись не найдена")
+
+// Store описывает хранилище обращений и истории переписки.
+type Store interface {
+	CreateTicket(t Ticket) (int64, error)
+	GetTicket(id int64) (*Ticket, error)
+	GetTicketByThreadID(threadID int) (*Ticket, error)
+	// GetOpenUserTicket возвращает последнее незакрытое обращение пользователя.
+	GetOpenUserTicket(userID int64) (*Ticket, error)
+	// GetUserTickets возвращает последние обращения пользователя, новые первыми.
+	GetUserTickets(userID int64, limit int) ([]Ticket, error)
+	// UpdateTicketStatus меняет статус обращения и записывает переход в историю.
+	UpdateTicketStatus(change StatusChange) error
+	GetStatusChanges(ticketID int64) ([]StatusChange, error)
+	UpdateTicketMessage(id int64, message string) error
+	SetTicketThreadID(id int64, threadID int) error
+	// SetTicketPriority меняет приоритет по решению поддержки: после этого
+	// срочность, выбранная пользователем, его уже не меняет.
+	SetTicketPriority(id int64, priority string) error
+	// SetUserTicketPriority меняет приоритет по выбору пользователя, если
+	// поддержка его ещё не выставляла. false означает, что выставляла.
+	SetUserTicketPriority(id int64, priority string) (bool, error)
+	// ResetTicketThread отвязывает обращение от удалённой темы threadID.
+	// false означает, что обращение уже привязано к другой теме.
+	ResetTicketThread(id int64, threadID int) (bool, error)
+	// ListTicketsWithoutTopic возвращает незакрытые обращения без темы
+	// в группе поддержки, старые первыми.
+	ListTicketsWithoutTopic(limit int) ([]Ticket, error)
+	SetTicketCardMessageID(id int64, messageID int) error
+	// AssignTicket меняет ответственного и записывает изменение в историю.
+	// Если change не nil, статус обращения меняется в той же транзакции.
+	AssignTicket(a TicketAssignment, change *StatusChange) error
+	GetTicketAssignments(ticketID int64) ([]TicketAssignment, error)
+	// SaveTicketRating сохраняет оценку обращения; повторная оценка заменяет прежнюю.
+	SaveTicketRating(r TicketRating) error
+	SetTicketRatingComment(ticketID int64, comment string) error
+	// GetTicketRatings возвращает оценки, поставленные в интервале [from, to).
+	GetTicketRatings(from, to string) ([]TicketRating, error)
+
+	GetUserLanguage(userID int64) (*UserLanguage, error)
+	SaveUserLanguage(l UserLanguage) error
+
+	// BlockUser блокирует пользователя; повторная блокировка заменяет прежнюю.
+	BlockUser(b UserBlock) error
+	UnblockUser(userID int64) error
+	GetUserBlock(userID int64) (*UserBlock, error)
+
+	SaveMessage(m TicketMessage) (int64, error)
+	GetTicketMessage(id int64) (*TicketMessage, error)
+	// FindTicketMessage ищет сохранённое сообщение по его идентификатору в Telegram.
+	FindTicketMessage(userID int64, messageID int, isSupport bool) (*TicketMessage, error)
+	// EditTicketMessage меняет текст сообщения и записывает правку в историю.
+	EditTicketMessage(e TicketMessageEdit) error
+	// GetTicketHistory возвращает переписку по обращению в хронологическом порядке.
+	GetTicketHistory(ticketID int64) ([]TicketMessage, error)
+	// GetTicketEdits возвращает правки сообщений обращения в хронологическом порядке.
+	GetTicketEdits(ticketID int64) ([]TicketMessageEdit, error)
+
+	// SaveMessageLink связывает сообщение в чате пользователя с его копией в теме.
+	SaveMessageLink(l MessageLink) error
+	GetMessageLinkByUserMessage(ticketID int64, userMessageID int) (*MessageLink, error)
+	GetMessageLinkByTopicMessage(ticketID int64, topicMessageID int) (*MessageLink, error)
+
+	// EnqueueOutbox ставит сообщение в очередь на доставку.
+	EnqueueOutbox(m OutboxMessage) (int64, error)
+	// ListDueOutbox возвращает самое раннее ожидающее сообщение каждой темы
+	// каждого чата, если время его попытки наступило к now, в порядке
+	// постановки в очередь.
+	ListDueOutbox(now string, limit int) ([]OutboxMessage, error)
+	// CountPendingOutbox считает ожидающие доставки сообщения в тему
+	// threadID чата chatID.
+	CountPendingOutbox(chatID int64, threadID int) (int, error)
+	// CompleteOutbox удаляет доставленное сообщение из очереди.
+	CompleteOutbox(id int64) error
+	// MarkOutboxHeaderSent отмечает, что заголовок медиа уже отправлен
+	// отдельным сообщением.
+	MarkOutboxHeaderSent(id int64) error
+	// RetryOutbox учитывает неудачную попытку и назначает следующую.
+	RetryOutbox(id int64, nextAttemptAt, lastError string) error
+	// FailOutbox учитывает последнюю попытку и оставляет сообщение
+	// в очереди недоставленным.
+	FailOutbox(id int64, lastError string) error
+
+	// SearchTickets возвращает страницу обращений, подходящих под запрос,
+	// новые первыми, и общее число найденных.
+	SearchTickets(q TicketSearch) ([]Ticket, int, error)
+	// ListArchivableTickets возвращает обращения, закрытые раньше
+	// closedBefore и не архивированные после последнего закрытия,
+	// старые первыми.
+	ListArchivableTickets(closedBefore string, limit int) ([]Ticket, error)
+	// ArchiveTicket удаляет переписку обращения вместе с правками, связями
+	// сообщений и очередью отправки и помечает его архивированным.
+	ArchiveTicket(id int64, archivedAt string) error
+
+	// ListStaleTickets возвращает незакрытые обращения без предупреждения,
+	// в которых последнее сообщение — ответ поддержки раньше supportBefore,
+	// если после него обращение не оставляли открытым.
+	ListStaleTickets(supportBefore string, limit int) ([]Ticket, error)
+	// ListWarnedTickets возвращает незакрытые обращения, предупреждение
+	// об автозакрытии по которым отправлено раньше warnedBefore.
+	ListWarnedTickets(warnedBefore string, limit int) ([]Ticket, error)
+	// SetTicketStaleWarning запоминает время предупреждения; пустая строка его сбрасывает.
+	SetTicketStaleWarning(id int64, warnedAt string) error
+	// KeepTicketOpen снимает предупреждение и откладывает автозакрытие
+	// до следующего ответа поддержки.
+	KeepTicketOpen(id int64, keptAt string) error
+
+	Close() error
+}
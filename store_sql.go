@@ -0,0 +1,813 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SQLStore реализует Store поверх database/sql. Запросы используют
+// плейсхолдеры $N и RETURNING, которые одинаково понимают SQLite и PostgreSQL;
+// различия схем живут в миграциях конкретного драйвера, а полнотекстовый
+// поиск, который у СУБД устроен по-разному, описывает fullTextSearch.
+type SQLStore struct {
+	db     *sql.DB
+	search fullTextSearch
+}
+
+// fullTextSearch — полнотекстовый поиск конкретной СУБД.
+type fullTextSearch struct {
+	// Подзапрос, возвращающий id обращений, в названии или переписке
+	// которых встречается запрос $1
+	ticketIDs string
+	// Преобразует текст, введённый агентом, в запрос для ticketIDs
+	query func(text string) string
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLStore) CreateTicket(t Ticket) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(
+		`INSERT INTO tickets (user_id, user_name, title, message, created_at, status, user_full_name, priority)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`,
+		t.UserID, t.UserName, t.Title, t.Message, t.CreatedAt, t.Status, t.UserFullName, t.Priority,
+	).Scan(&id)
+	return id, err
+}
+
+const ticketColumns = `id, user_id, user_name, title, message, created_at, status, thread_id, closed_at, archived_at,
+	user_full_name, card_message_id, assignee_id, assignee_name, stale_warned_at, priority, priority_set_by_support`
+
+// Порядок очереди: сначала более срочные обращения
+const priorityRank = `CASE priority WHEN 'urgent' THEN 3 WHEN 'high' THEN 2 WHEN 'normal' THEN 1 ELSE 0 END`
+
+func scanTicket(row interface{ Scan(...interface{}) error }) (*Ticket, error) {
+	var t Ticket
+	err := row.Scan(
+		&t.ID, &t.UserID, &t.UserName, &t.Title, &t.Message, &t.CreatedAt, &t.Status, &t.ThreadID, &t.ClosedAt, &t.ArchivedAt,
+		&t.UserFullName, &t.CardMessageID, &t.AssigneeID, &t.AssigneeName, &t.StaleWarnedAt, &t.Priority,
+		&t.PrioritySetBySupport,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *SQLStore) GetTicket(id int64) (*Ticket, error) {
+	return scanTicket(s.db.QueryRow(
+		`SELECT `+ticketColumns+` FROM tickets WHERE id = $1`,
+		id,
+	))
+}
+
+func (s *SQLStore) GetTicketByThreadID(threadID int) (*Ticket, error) {
+	return scanTicket(s.db.QueryRow(
+		`SELECT `+ticketColumns+` FROM tickets WHERE thread_id = $1`,
+		threadID,
+	))
+}
+
+func (s *SQLStore) GetOpenUserTicket(userID int64) (*Ticket, error) {
+	return scanTicket(s.db.QueryRow(
+		`SELECT `+ticketColumns+`
+		FROM tickets
+		WHERE user_id = $1 AND status != 'closed'
+		ORDER BY id DESC LIMIT 1`,
+		userID,
+	))
+}
+
+func (s *SQLStore) GetUserTickets(userID int64, limit int) ([]Ticket, error) {
+	return s.queryTickets(
+		`SELECT `+ticketColumns+` FROM tickets
+		WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`,
+		userID,
+		limit,
+	)
+}
+
+func (s *SQLStore) UpdateTicketStatus(c StatusChange) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateTicketStatus(tx, c); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func updateTicketStatus(tx *sql.Tx, c StatusChange) error {
+	closedAt := ""
+	if c.ToStatus == "closed" {
+		closedAt = c.Date
+	}
+
+	// Смена статуса сбрасывает предупреждение об автозакрытии
+	_, err := tx.Exec(
+		`UPDATE tickets SET status = $1, closed_at = $2, stale_warned_at = '' WHERE id = $3`,
+		c.ToStatus, closedAt, c.TicketID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO ticket_status_changes
+		(ticket_id, from_status, to_status, changed_by_id, changed_by_name, is_support, date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		c.TicketID, c.FromStatus, c.ToStatus, c.ChangedByID, c.ChangedByName, c.IsSupport, c.Date,
+	)
+	return err
+}
+
+func (s *SQLStore) GetStatusChanges(ticketID int64) ([]StatusChange, error) {
+	rows, err := s.db.Query(
+		`SELECT id, ticket_id, from_status, to_status, changed_by_id, changed_by_name, is_support, date
+		FROM ticket_status_changes
+		WHERE ticket_id = $1
+		ORDER BY date ASC, id ASC`,
+		ticketID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []StatusChange
+	for rows.Next() {
+		var c StatusChange
+		err := rows.Scan(&c.ID, &c.TicketID, &c.FromStatus, &c.ToStatus, &c.ChangedByID, &c.ChangedByName, &c.IsSupport, &c.Date)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+func (s *SQLStore) UpdateTicketMessage(id int64, message string) error {
+	_, err := s.db.Exec(
+		`UPDATE tickets SET message = $1 WHERE id = $2`,
+		message, id,
+	)
+	return err
+}
+
+func (s *SQLStore) SetTicketThreadID(id int64, threadID int) error {
+	_, err := s.db.Exec(
+		`UPDATE tickets SET thread_id = $1 WHERE id = $2`,
+		threadID, id,
+	)
+	return err
+}
+
+func (s *SQLStore) ResetTicketThread(id int64, threadID int) (bool, error) {
+	res, err := s.db.Exec(
+		`UPDATE tickets SET thread_id = 0 WHERE id = $1 AND thread_id = $2`,
+		id, threadID,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLStore) ListTicketsWithoutTopic(limit int) ([]Ticket, error) {
+	return s.queryTickets(
+		`SELECT `+ticketColumns+` FROM tickets
+		WHERE thread_id = 0 AND status != 'closed'
+		ORDER BY id ASC LIMIT $1`,
+		limit,
+	)
+}
+
+func (s *SQLStore) SetTicketPriority(id int64, priority string) error {
+	_, err := s.db.Exec(
+		`UPDATE tickets SET priority = $1, priority_set_by_support = TRUE WHERE id = $2`,
+		priority, id,
+	)
+	return err
+}
+
+func (s *SQLStore) SetUserTicketPriority(id int64, priority string) (bool, error) {
+	res, err := s.db.Exec(
+		`UPDATE tickets SET priority = $1 WHERE id = $2 AND NOT priority_set_by_support`,
+		priority, id,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLStore) SetTicketCardMessageID(id int64, messageID int) error {
+	_, err := s.db.Exec(
+		`UPDATE tickets SET card_message_id = $1 WHERE id = $2`,
+		messageID, id,
+	)
+	return err
+}
+
+func (s *SQLStore) AssignTicket(a TicketAssignment, change *StatusChange) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`UPDATE tickets SET assignee_id = $1, assignee_name = $2 WHERE id = $3`,
+		a.AgentID, a.AgentName, a.TicketID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO ticket_assignments
+		(ticket_id, agent_id, agent_name, changed_by_id, changed_by_name, action, date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		a.TicketID, a.AgentID, a.AgentName, a.ChangedByID, a.ChangedByName, a.Action, a.Date,
+	)
+	if err != nil {
+		return err
+	}
+
+	if change != nil {
+		if err := updateTicketStatus(tx, *change); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) GetTicketAssignments(ticketID int64) ([]TicketAssignment, error) {
+	rows, err := s.db.Query(
+		`SELECT id, ticket_id, agent_id, agent_name, changed_by_id, changed_by_name, action, date
+		FROM ticket_assignments
+		WHERE ticket_id = $1
+		ORDER BY date ASC, id ASC`,
+		ticketID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assignments []TicketAssignment
+	for rows.Next() {
+		var a TicketAssignment
+		err := rows.Scan(&a.ID, &a.TicketID, &a.AgentID, &a.AgentName, &a.ChangedByID, &a.ChangedByName, &a.Action, &a.Date)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, rows.Err()
+}
+
+func (s *SQLStore) SaveTicketRating(r TicketRating) error {
+	_, err := s.db.Exec(
+		`INSERT INTO ticket_ratings (ticket_id, user_id, rating, comment, agent_id, agent_name, date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (ticket_id) DO UPDATE SET
+			rating = excluded.rating, comment = excluded.comment,
+			agent_id = excluded.agent_id, agent_name = excluded.agent_name, date = excluded.date`,
+		r.TicketID, r.UserID, r.Rating, r.Comment, r.AgentID, r.AgentName, r.Date,
+	)
+	return err
+}
+
+func (s *SQLStore) SetTicketRatingComment(ticketID int64, comment string) error {
+	res, err := s.db.Exec(`UPDATE ticket_ratings SET comment = $1 WHERE ticket_id = $2`, comment, ticketID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) GetTicketRatings(from, to string) ([]TicketRating, error) {
+	rows, err := s.db.Query(
+		`SELECT ticket_id, user_id, rating, comment, agent_id, agent_name, date
+		FROM ticket_ratings
+		WHERE date >= $1 AND date < $2
+		ORDER BY date ASC, ticket_id ASC`,
+		from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ratings []TicketRating
+	for rows.Next() {
+		var r TicketRating
+		err := rows.Scan(&r.TicketID, &r.UserID, &r.Rating, &r.Comment, &r.AgentID, &r.AgentName, &r.Date)
+		if err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, r)
+	}
+	return ratings, rows.Err()
+}
+
+func (s *SQLStore) GetUserLanguage(userID int64) (*UserLanguage, error) {
+	var l UserLanguage
+	err := s.db.QueryRow(
+		`SELECT user_id, language, is_override FROM user_languages WHERE user_id = $1`,
+		userID,
+	).Scan(&l.UserID, &l.Language, &l.IsOverride)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (s *SQLStore) SaveUserLanguage(l UserLanguage) error {
+	_, err := s.db.Exec(
+		`INSERT INTO user_languages (user_id, language, is_override)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET language = excluded.language, is_override = excluded.is_override`,
+		l.UserID, l.Language, l.IsOverride,
+	)
+	return err
+}
+
+func (s *SQLStore) BlockUser(b UserBlock) error {
+	_, err := s.db.Exec(
+		`INSERT INTO user_blocks (user_id, reason, blocked_by_id, blocked_by_name, blocked_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE SET
+			reason = excluded.reason,
+			blocked_by_id = excluded.blocked_by_id,
+			blocked_by_name = excluded.blocked_by_name,
+			blocked_at = excluded.blocked_at,
+			expires_at = excluded.expires_at`,
+		b.UserID, b.Reason, b.BlockedByID, b.BlockedByName, b.BlockedAt, b.ExpiresAt,
+	)
+	return err
+}
+
+func (s *SQLStore) UnblockUser(userID int64) error {
+	res, err := s.db.Exec(`DELETE FROM user_blocks WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) GetUserBlock(userID int64) (*UserBlock, error) {
+	var b UserBlock
+	err := s.db.QueryRow(
+		`SELECT user_id, reason, blocked_by_id, blocked_by_name, blocked_at, expires_at
+		FROM user_blocks WHERE user_id = $1`,
+		userID,
+	).Scan(&b.UserID, &b.Reason, &b.BlockedByID, &b.BlockedByName, &b.BlockedAt, &b.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (s *SQLStore) EnqueueOutbox(m OutboxMessage) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(
+		`INSERT INTO outbox
+		(ticket_id, chat_id, thread_id, reply_to, text, media_type, file_id, source_message_id, reply_markup,
+			status, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id`,
+		m.TicketID, m.ChatID, m.ThreadID, m.ReplyTo, m.Text, m.MediaType, m.FileID, m.SourceMessageID, m.ReplyMarkup,
+		OutboxPending, m.NextAttemptAt, m.CreatedAt,
+	).Scan(&id)
+	return id, err
+}
+
+func (s *SQLStore) ListDueOutbox(now string, limit int) ([]OutboxMessage, error) {
+	rows, err := s.db.Query(
+		`SELECT id, ticket_id, chat_id, thread_id, reply_to, text, media_type, file_id, source_message_id,
+			reply_markup, header_sent, status, attempts, next_attempt_at, last_error, created_at
+		FROM outbox o WHERE status = $1 AND next_attempt_at <= $2
+		AND id = (SELECT MIN(id) FROM outbox p
+			WHERE p.status = $1 AND p.chat_id = o.chat_id AND p.thread_id = o.thread_id)
+		ORDER BY id ASC LIMIT $3`,
+		OutboxPending, now, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		err := rows.Scan(&m.ID, &m.TicketID, &m.ChatID, &m.ThreadID, &m.ReplyTo, &m.Text, &m.MediaType,
+			&m.FileID, &m.SourceMessageID, &m.ReplyMarkup, &m.HeaderSent, &m.Status, &m.Attempts, &m.NextAttemptAt, &m.LastError, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+func (s *SQLStore) CountPendingOutbox(chatID int64, threadID int) (int, error) {
+	var n int
+	err := s.db.QueryRow(
+		`SELECT COUNT(*) FROM outbox WHERE chat_id = $1 AND thread_id = $2 AND status = $3`,
+		chatID, threadID, OutboxPending,
+	).Scan(&n)
+	return n, err
+}
+
+func (s *SQLStore) CompleteOutbox(id int64) error {
+	_, err := s.db.Exec(`DELETE FROM outbox WHERE id = $1`, id)
+	return err
+}
+
+func (s *SQLStore) MarkOutboxHeaderSent(id int64) error {
+	_, err := s.db.Exec(`UPDATE outbox SET header_sent = TRUE WHERE id = $1`, id)
+	return err
+}
+
+func (s *SQLStore) RetryOutbox(id int64, nextAttemptAt, lastError string) error {
+	_, err := s.db.Exec(
+		`UPDATE outbox SET attempts = attempts + 1, next_attempt_at = $1, last_error = $2 WHERE id = $3`,
+		nextAttemptAt, lastError, id,
+	)
+	return err
+}
+
+func (s *SQLStore) FailOutbox(id int64, lastError string) error {
+	_, err := s.db.Exec(
+		`UPDATE outbox SET attempts = attempts + 1, status = $1, last_error = $2 WHERE id = $3`,
+		OutboxFailed, lastError, id,
+	)
+	return err
+}
+
+func (s *SQLStore) SaveMessage(m TicketMessage) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(
+		`INSERT INTO ticket_messages
+		(ticket_id, message_id, user_id, user_name, text, date, is_support, media_type, file_id, is_internal)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`,
+		m.TicketID, m.MessageID, m.UserID, m.UserName, m.Text, m.Date, m.IsSupport,
+		m.MediaType, m.FileID, m.IsInternal,
+	).Scan(&id)
+	return id, err
+}
+
+const messageColumns = `id, ticket_id, message_id, user_id, user_name, text, date, is_support, media_type, file_id, is_internal, edited_at`
+
+func scanTicketMessage(row interface{ Scan(...interface{}) error }) (*TicketMessage, error) {
+	var m TicketMessage
+	err := row.Scan(
+		&m.ID, &m.TicketID, &m.MessageID, &m.UserID, &m.UserName, &m.Text, &m.Date, &m.IsSupport, &m.MediaType, &m.FileID,
+		&m.IsInternal, &m.EditedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (s *SQLStore) GetTicketMessage(id int64) (*TicketMessage, error) {
+	return scanTicketMessage(s.db.QueryRow(
+		`SELECT `+messageColumns+` FROM ticket_messages WHERE id = $1`,
+		id,
+	))
+}
+
+func (s *SQLStore) FindTicketMessage(userID int64, messageID int, isSupport bool) (*TicketMessage, error) {
+	return scanTicketMessage(s.db.QueryRow(
+		`SELECT `+messageColumns+`
+		FROM ticket_messages
+		WHERE message_id = $1 AND user_id = $2 AND is_support = $3
+		ORDER BY id DESC LIMIT 1`,
+		messageID, userID, isSupport,
+	))
+}
+
+func (s *SQLStore) EditTicketMessage(e TicketMessageEdit) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE ticket_messages SET text = $1, edited_at = $2 WHERE id = $3`,
+		e.NewText, e.Date, e.MessageID,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO ticket_message_edits (message_id, old_text, new_text, date) VALUES ($1, $2, $3, $4)`,
+		e.MessageID, e.OldText, e.NewText, e.Date,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) GetTicketEdits(ticketID int64) ([]TicketMessageEdit, error) {
+	rows, err := s.db.Query(
+		`SELECT e.id, e.message_id, e.old_text, e.new_text, e.date
+		FROM ticket_message_edits e
+		JOIN ticket_messages m ON m.id = e.message_id
+		WHERE m.ticket_id = $1
+		ORDER BY e.date ASC, e.id ASC`,
+		ticketID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edits []TicketMessageEdit
+	for rows.Next() {
+		var e TicketMessageEdit
+		if err := rows.Scan(&e.ID, &e.MessageID, &e.OldText, &e.NewText, &e.Date); err != nil {
+			return nil, err
+		}
+		edits = append(edits, e)
+	}
+	return edits, rows.Err()
+}
+
+func (s *SQLStore) GetTicketHistory(ticketID int64) ([]TicketMessage, error) {
+	rows, err := s.db.Query(
+		`SELECT `+messageColumns+`
+		FROM ticket_messages
+		WHERE ticket_id = $1
+		ORDER BY date ASC, id ASC`,
+		ticketID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []TicketMessage
+	for rows.Next() {
+		m, err := scanTicketMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, *m)
+	}
+	return history, rows.Err()
+}
+
+func (s *SQLStore) ListStaleTickets(supportBefore string, limit int) ([]Ticket, error) {
+	return s.queryTickets(
+		`SELECT `+ticketColumns+` FROM tickets
+		WHERE status != 'closed' AND stale_warned_at = '' AND id IN (
+			SELECT ticket_id FROM ticket_messages
+			WHERE NOT is_internal
+			GROUP BY ticket_id
+			HAVING MAX(CASE WHEN is_support THEN date END) < $1
+				AND MAX(CASE WHEN is_support THEN date END) > COALESCE(MAX(CASE WHEN NOT is_support THEN date END), '')
+				AND MAX(CASE WHEN is_support THEN date END) > (SELECT keep_open_at FROM tickets k WHERE k.id = ticket_id)
+		)
+		ORDER BY id ASC LIMIT $2`,
+		supportBefore,
+		limit,
+	)
+}
+
+func (s *SQLStore) ListWarnedTickets(warnedBefore string, limit int) ([]Ticket, error) {
+	return s.queryTickets(
+		`SELECT `+ticketColumns+` FROM tickets
+		WHERE status != 'closed' AND stale_warned_at != '' AND stale_warned_at < $1
+		ORDER BY stale_warned_at ASC, id ASC LIMIT $2`,
+		warnedBefore,
+		limit,
+	)
+}
+
+func (s *SQLStore) SetTicketStaleWarning(id int64, warnedAt string) error {
+	_, err := s.db.Exec(`UPDATE tickets SET stale_warned_at = $1 WHERE id = $2`, warnedAt, id)
+	return err
+}
+
+func (s *SQLStore) KeepTicketOpen(id int64, keptAt string) error {
+	_, err := s.db.Exec(`UPDATE tickets SET keep_open_at = $1, stale_warned_at = '' WHERE id = $2`, keptAt, id)
+	return err
+}
+
+func (s *SQLStore) SearchTickets(q TicketSearch) ([]Ticket, int, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	// Подзапрос поиска ссылается на $1, поэтому текст всегда первый аргумент
+	if q.Text != "" {
+		args = append(args, s.search.query(q.Text))
+		conds = append(conds, `id IN (`+s.search.ticketIDs+`)`)
+	}
+	where := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if q.Status != "" {
+		where(`status = $%d`, q.Status)
+	} else if q.Active {
+		conds = append(conds, `status != 'closed'`)
+	}
+	if q.Priority != "" {
+		where(`priority = $%d`, q.Priority)
+	}
+	if q.UserID != 0 {
+		where(`user_id = $%d`, q.UserID)
+	}
+	if q.UserName != "" {
+		where(`LOWER(user_name) = LOWER($%d)`, q.UserName)
+	}
+	if q.AssigneeID != 0 {
+		where(`assignee_id = $%d`, q.AssigneeID)
+	}
+	if q.AssigneeName != "" {
+		// У агентов без username вместо @username сохранено имя: ищем
+		// и по нему, в том числе по одному имени без фамилии
+		where(`(LOWER(assignee_name) IN (LOWER($%[1]d), '@' || LOWER($%[1]d))
+			OR LOWER(assignee_name) LIKE LOWER($%[1]d) || ' %%')`, q.AssigneeName)
+	}
+	if q.From != "" {
+		where(`created_at >= $%d`, q.From)
+	}
+	if q.To != "" {
+		where(`created_at < $%d`, q.To)
+	}
+
+	filter := ""
+	if len(conds) > 0 {
+		filter = ` WHERE ` + strings.Join(conds, ` AND `)
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM tickets`+filter, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	order := ` ORDER BY created_at DESC, id DESC`
+	if q.ByPriority {
+		order = ` ORDER BY ` + priorityRank + ` DESC, created_at ASC, id ASC`
+	}
+
+	args = append(args, q.Limit, q.Offset)
+	tickets, err := s.queryTickets(
+		`SELECT `+ticketColumns+` FROM tickets`+filter+order+
+			fmt.Sprintf(` LIMIT $%d OFFSET $%d`, len(args)-1, len(args)),
+		args...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	return tickets, total, nil
+}
+
+func (s *SQLStore) queryTickets(query string, args ...interface{}) ([]Ticket, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tickets []Ticket
+	for rows.Next() {
+		t, err := scanTicket(rows)
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, *t)
+	}
+	return tickets, rows.Err()
+}
+
+func (s *SQLStore) SaveMessageLink(l MessageLink) error {
+	_, err := s.db.Exec(
+		`INSERT INTO message_links (ticket_id, user_message_id, topic_message_id) VALUES ($1, $2, $3)`,
+		l.TicketID, l.UserMessageID, l.TopicMessageID,
+	)
+	return err
+}
+
+func (s *SQLStore) GetMessageLinkByUserMessage(ticketID int64, userMessageID int) (*MessageLink, error) {
+	return scanMessageLink(s.db.QueryRow(
+		`SELECT ticket_id, user_message_id, topic_message_id FROM message_links
+		WHERE ticket_id = $1 AND user_message_id = $2
+		ORDER BY id DESC LIMIT 1`,
+		ticketID, userMessageID,
+	))
+}
+
+func (s *SQLStore) GetMessageLinkByTopicMessage(ticketID int64, topicMessageID int) (*MessageLink, error) {
+	return scanMessageLink(s.db.QueryRow(
+		`SELECT ticket_id, user_message_id, topic_message_id FROM message_links
+		WHERE ticket_id = $1 AND topic_message_id = $2
+		ORDER BY id DESC LIMIT 1`,
+		ticketID, topicMessageID,
+	))
+}
+
+func scanMessageLink(row *sql.Row) (*MessageLink, error) {
+	var l MessageLink
+	err := row.Scan(&l.TicketID, &l.UserMessageID, &l.TopicMessageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (s *SQLStore) ListArchivableTickets(closedBefore string, limit int) ([]Ticket, error) {
+	return s.queryTickets(
+		`SELECT `+ticketColumns+` FROM tickets
+		WHERE status = 'closed' AND closed_at != '' AND closed_at < $1 AND archived_at < closed_at
+		ORDER BY closed_at ASC, id ASC LIMIT $2`,
+		closedBefore,
+		limit,
+	)
+}
+
+func (s *SQLStore) ArchiveTicket(id int64, archivedAt string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`DELETE FROM ticket_message_edits
+		WHERE message_id IN (SELECT id FROM ticket_messages WHERE ticket_id = $1)`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM ticket_messages WHERE ticket_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM message_links WHERE ticket_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM outbox WHERE ticket_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE tickets SET archived_at = $1 WHERE id = $2`, archivedAt, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
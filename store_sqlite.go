@@ -0,0 +1,360 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// Миграции SQLite. Первые две приводят к единой схеме базы, созданные
+// ещё через CREATE TABLE IF NOT EXISTS, поэтому проверяют наличие колонок.
+var sqliteMigrations = []migration{
+	{
+		version: 1,
+		name:    "tickets and ticket_messages",
+		up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`
+			CREATE TABLE IF NOT EXISTS tickets (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				user_name TEXT NOT NULL,
+				title TEXT NOT NULL,
+				message TEXT NOT NULL,
+				created_at TEXT NOT NULL,
+				status TEXT NOT NULL DEFAULT 'open',
+				thread_id INTEGER DEFAULT 0
+			);
+			CREATE TABLE IF NOT EXISTS ticket_messages (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				ticket_id INTEGER NOT NULL,
+				message_id INTEGER NOT NULL,
+				user_id INTEGER NOT NULL,
+				user_name TEXT NOT NULL,
+				text TEXT NOT NULL,
+				date TEXT NOT NULL,
+				is_support BOOLEAN NOT NULL DEFAULT FALSE,
+				FOREIGN KEY(ticket_id) REFERENCES tickets(id)
+			);
+			CREATE INDEX IF NOT EXISTS idx_ticket_messages_ticket_id ON ticket_messages(ticket_id);
+			`)
+			if err != nil {
+				return err
+			}
+			// Самые ранние базы были созданы без thread_id
+			return addColumnIfMissing(tx, "tickets", "thread_id", "INTEGER DEFAULT 0")
+		},
+	},
+	{
+		version: 2,
+		name:    "ticket_messages media",
+		up: func(tx *sql.Tx) error {
+			for _, column := range []string{"media_type", "file_id"} {
+				if err := addColumnIfMissing(tx, "ticket_messages", column, "TEXT NOT NULL DEFAULT ''"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version: 3,
+		name:    "tickets indexes",
+		up: execSQL(`
+		CREATE INDEX IF NOT EXISTS idx_tickets_user_id ON tickets(user_id);
+		CREATE INDEX IF NOT EXISTS idx_tickets_thread_id ON tickets(thread_id);
+		`),
+	},
+	{
+		version: 4,
+		name:    "tickets closed_at and archived_at",
+		up: execSQL(`
+		ALTER TABLE tickets ADD COLUMN closed_at TEXT NOT NULL DEFAULT '';
+		ALTER TABLE tickets ADD COLUMN archived_at TEXT NOT NULL DEFAULT '';
+		UPDATE tickets SET closed_at = COALESCE(
+			(SELECT MAX(date) FROM ticket_messages m WHERE m.ticket_id = tickets.id),
+			created_at
+		) WHERE status = 'closed';
+		CREATE INDEX IF NOT EXISTS idx_tickets_closed_at ON tickets(status, closed_at);
+		`),
+	},
+	{
+		version: 5,
+		name:    "ticket assignee and assignment history",
+		up: execSQL(`
+		ALTER TABLE tickets ADD COLUMN user_full_name TEXT NOT NULL DEFAULT '';
+		ALTER TABLE tickets ADD COLUMN card_message_id INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE tickets ADD COLUMN assignee_id BIGINT NOT NULL DEFAULT 0;
+		ALTER TABLE tickets ADD COLUMN assignee_name TEXT NOT NULL DEFAULT '';
+		CREATE TABLE ticket_assignments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ticket_id BIGINT NOT NULL REFERENCES tickets(id),
+			agent_id BIGINT NOT NULL,
+			agent_name TEXT NOT NULL,
+			changed_by_id BIGINT NOT NULL,
+			changed_by_name TEXT NOT NULL,
+			action TEXT NOT NULL,
+			date TEXT NOT NULL
+		);
+		CREATE INDEX idx_ticket_assignments_ticket_id ON ticket_assignments(ticket_id);
+		`),
+	},
+	{
+		version: 6,
+		name:    "ticket_messages internal notes",
+		up:      execSQL(`ALTER TABLE ticket_messages ADD COLUMN is_internal BOOLEAN NOT NULL DEFAULT FALSE`),
+	},
+	{
+		version: 7,
+		name:    "ticket status history",
+		up: execSQL(`
+		CREATE TABLE ticket_status_changes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ticket_id BIGINT NOT NULL REFERENCES tickets(id),
+			from_status TEXT NOT NULL,
+			to_status TEXT NOT NULL,
+			changed_by_id BIGINT NOT NULL,
+			changed_by_name TEXT NOT NULL,
+			is_support BOOLEAN NOT NULL DEFAULT FALSE,
+			date TEXT NOT NULL
+		);
+		CREATE INDEX idx_ticket_status_changes_ticket_id ON ticket_status_changes(ticket_id);
+		`),
+	},
+	{
+		version: 8,
+		name:    "ticket ratings",
+		up: execSQL(`
+		CREATE TABLE ticket_ratings (
+			ticket_id BIGINT PRIMARY KEY REFERENCES tickets(id),
+			user_id BIGINT NOT NULL,
+			rating INTEGER NOT NULL,
+			comment TEXT NOT NULL DEFAULT '',
+			agent_id BIGINT NOT NULL DEFAULT 0,
+			agent_name TEXT NOT NULL DEFAULT '',
+			date TEXT NOT NULL
+		);
+		CREATE INDEX idx_ticket_ratings_date ON ticket_ratings(date);
+		`),
+	},
+	{
+		version: 9,
+		name:    "user languages",
+		up: execSQL(`
+		CREATE TABLE user_languages (
+			user_id BIGINT PRIMARY KEY,
+			language TEXT NOT NULL,
+			is_override BOOLEAN NOT NULL DEFAULT FALSE
+		);
+		`),
+	},
+	{
+		version: 10,
+		name:    "tickets stale warning",
+		up: execSQL(`
+		ALTER TABLE tickets ADD COLUMN stale_warned_at TEXT NOT NULL DEFAULT '';
+		`),
+	},
+	{
+		version: 11,
+		name:    "message links",
+		up: execSQL(`
+		CREATE TABLE message_links (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ticket_id BIGINT NOT NULL REFERENCES tickets(id),
+			user_message_id INTEGER NOT NULL,
+			topic_message_id INTEGER NOT NULL
+		);
+		CREATE INDEX idx_message_links_user ON message_links(ticket_id, user_message_id);
+		CREATE INDEX idx_message_links_topic ON message_links(ticket_id, topic_message_id);
+		`),
+	},
+	{
+		version: 12,
+		name:    "ticket message edits",
+		up: execSQL(`
+		ALTER TABLE ticket_messages ADD COLUMN edited_at TEXT NOT NULL DEFAULT '';
+		CREATE TABLE ticket_message_edits (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id BIGINT NOT NULL REFERENCES ticket_messages(id),
+			old_text TEXT NOT NULL,
+			new_text TEXT NOT NULL,
+			date TEXT NOT NULL
+		);
+		CREATE INDEX idx_ticket_message_edits_message_id ON ticket_message_edits(message_id);
+		CREATE INDEX idx_ticket_messages_message_id ON ticket_messages(message_id);
+		`),
+	},
+	{
+		version: 13,
+		name:    "full-text search",
+		up: execSQL(`
+		CREATE VIRTUAL TABLE tickets_fts USING fts5(title, content='tickets', content_rowid='id');
+		CREATE VIRTUAL TABLE ticket_messages_fts USING fts5(text, content='ticket_messages', content_rowid='id');
+
+		CREATE TRIGGER tickets_fts_insert AFTER INSERT ON tickets BEGIN
+			INSERT INTO tickets_fts(rowid, title) VALUES (new.id, new.title);
+		END;
+		CREATE TRIGGER tickets_fts_update AFTER UPDATE OF title ON tickets BEGIN
+			INSERT INTO tickets_fts(tickets_fts, rowid, title) VALUES ('delete', old.id, old.title);
+			INSERT INTO tickets_fts(rowid, title) VALUES (new.id, new.title);
+		END;
+
+		CREATE TRIGGER ticket_messages_fts_insert AFTER INSERT ON ticket_messages BEGIN
+			INSERT INTO ticket_messages_fts(rowid, text) VALUES (new.id, new.text);
+		END;
+		CREATE TRIGGER ticket_messages_fts_update AFTER UPDATE OF text ON ticket_messages BEGIN
+			INSERT INTO ticket_messages_fts(ticket_messages_fts, rowid, text) VALUES ('delete', old.id, old.text);
+			INSERT INTO ticket_messages_fts(rowid, text) VALUES (new.id, new.text);
+		END;
+		CREATE TRIGGER ticket_messages_fts_delete AFTER DELETE ON ticket_messages BEGIN
+			INSERT INTO ticket_messages_fts(ticket_messages_fts, rowid, text) VALUES ('delete', old.id, old.text);
+		END;
+
+		INSERT INTO tickets_fts(tickets_fts) VALUES ('rebuild');
+		INSERT INTO ticket_messages_fts(ticket_messages_fts) VALUES ('rebuild');
+		`),
+	},
+	{
+		version: 14,
+		name:    "user blocks",
+		up: execSQL(`
+		CREATE TABLE user_blocks (
+			user_id BIGINT PRIMARY KEY,
+			reason TEXT NOT NULL DEFAULT '',
+			blocked_by_id BIGINT NOT NULL,
+			blocked_by_name TEXT NOT NULL,
+			blocked_at TEXT NOT NULL,
+			expires_at TEXT NOT NULL DEFAULT ''
+		);
+		`),
+	},
+	{
+		version: 15,
+		name:    "outbox",
+		up: execSQL(`
+		CREATE TABLE outbox (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ticket_id BIGINT NOT NULL,
+			chat_id BIGINT NOT NULL,
+			thread_id INTEGER NOT NULL DEFAULT 0,
+			reply_to INTEGER NOT NULL DEFAULT 0,
+			text TEXT NOT NULL DEFAULT '',
+			media_type TEXT NOT NULL DEFAULT '',
+			file_id TEXT NOT NULL DEFAULT '',
+			source_message_id INTEGER NOT NULL DEFAULT 0,
+			status TEXT NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TEXT NOT NULL,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL
+		);
+		CREATE INDEX idx_outbox_due ON outbox(status, next_attempt_at);
+		CREATE INDEX idx_outbox_chat ON outbox(chat_id, status);
+		`),
+	},
+	{
+		version: 16,
+		name:    "ticket priority",
+		up: execSQL(`
+		ALTER TABLE tickets ADD COLUMN priority TEXT NOT NULL DEFAULT 'normal';
+		`),
+	},
+	{
+		version: 17,
+		name:    "outbox ordering per topic",
+		up: execSQL(`
+		ALTER TABLE outbox ADD COLUMN header_sent BOOLEAN NOT NULL DEFAULT FALSE;
+		DROP INDEX idx_outbox_chat;
+		CREATE INDEX idx_outbox_chat ON outbox(chat_id, thread_id, status);
+		`),
+	},
+	{
+		version: 18,
+		name:    "outbox reply markup",
+		up: execSQL(`
+		ALTER TABLE outbox ADD COLUMN reply_markup TEXT NOT NULL DEFAULT '';
+		`),
+	},
+	{
+		version: 19,
+		name:    "tickets keep open",
+		up: execSQL(`
+		ALTER TABLE tickets ADD COLUMN keep_open_at TEXT NOT NULL DEFAULT '';
+		`),
+	},
+	{
+		version: 20,
+		name:    "ticket priority set by support",
+		up: execSQL(`
+		ALTER TABLE tickets ADD COLUMN priority_set_by_support BOOLEAN NOT NULL DEFAULT FALSE;
+		`),
+	},
+}
+
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// Поиск по индексам FTS5, которые триггеры обновляют вместе с таблицами
+var sqliteSearch = fullTextSearch{
+	ticketIDs: `SELECT rowid FROM tickets_fts WHERE tickets_fts MATCH $1
+		UNION
+		SELECT m.ticket_id FROM ticket_messages_fts f
+		JOIN ticket_messages m ON m.id = f.rowid
+		WHERE ticket_messages_fts MATCH $1`,
+	query: ftsQuery,
+}
+
+// ftsQuery превращает слова запроса в префиксные термы FTS5, которые должны
+// встретиться все. Кавычки защищают от синтаксиса FTS5 в тексте агента.
+func ftsQuery(text string) string {
+	words := strings.Fields(text)
+	for i, w := range words {
+		words[i] = `"` + strings.ReplaceAll(w, `"`, `""`) + `"*`
+	}
+	return strings.Join(words, " ")
+}
+
+// NewSQLiteStore открывает базу по указанному пути и обновляет её схему.
+func NewSQLiteStore(path string) (*SQLStore, error) {
+	// Пока база занята другим соединением, запросы ждут до пяти секунд,
+	// а WAL позволяет читать во время записи
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := runMigrations(db, sqliteMigrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLStore{db: db, search: sqliteSearch}, nil
+}
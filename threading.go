@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Бот пересылает копии сообщений, поэтому ответ через «Ответить» в одном
+// чате сам по себе не виден в другом. Для каждой пересылки запоминается
+// пара идентификаторов: сообщение в чате пользователя и сообщение в теме,
+// и ответ на одно из них уходит ответом на парное.
+
+// MessageLink — пара сообщений, пересланных друг в друга.
+type MessageLink struct {
+	TicketID       int64 `json:"ticket_id"`
+	UserMessageID  int   `json:"user_message_id"`
+	TopicMessageID int   `json:"topic_message_id"`
+}
+
+func (s *Service) linkMessages(ticketID int64, userMessageID, topicMessageID int) {
+	err := s.store.SaveMessageLink(MessageLink{
+		TicketID:       ticketID,
+		UserMessageID:  userMessageID,
+		TopicMessageID: topicMessageID,
+	})
+	if err != nil {
+		log.Printf("Ошибка сохранения связи сообщений обращения #%d: %v", ticketID, err)
+	}
+}
+
+// topicReplyTarget возвращает сообщение в теме, на которое нужно ответить
+// при пересылке m из чата пользователя, или nil.
+func (s *Service) topicReplyTarget(ticketID int64, m *telebot.Message) *telebot.Message {
+	if m.ReplyTo == nil {
+		return nil
+	}
+	l, err := s.store.GetMessageLinkByUserMessage(ticketID, m.ReplyTo.ID)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Ошибка поиска связи сообщений: %v", err)
+		}
+		return nil
+	}
+	return &telebot.Message{ID: l.TopicMessageID}
+}
+
+// userReplyTarget возвращает сообщение в чате пользователя, на которое нужно
+// ответить при пересылке m из темы, или nil.
+func (s *Service) userReplyTarget(ticketID int64, m *telebot.Message) *telebot.Message {
+	// Сообщения в теме без явного ответа ссылаются на служебное
+	// сообщение о её создании
+	if m.ReplyTo == nil || m.ReplyTo.IsService() {
+		return nil
+	}
+	l, err := s.store.GetMessageLinkByTopicMessage(ticketID, m.ReplyTo.ID)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("Ошибка поиска связи сообщений: %v", err)
+		}
+		return nil
+	}
+	return &telebot.Message{ID: l.UserMessageID}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Тема обращения в группе поддержки отражает его состояние: в названии
+// стоят отметки статуса и приоритета, иконка берётся из topic_icons, а закрытые
+// обращения закрывают и тему, чтобы список тем было удобно просматривать.
+
+// Ограничение Telegram на длину названия темы
+const maxTopicNameLength = 128
+
+func topicStatusMark(status string) string {
+	switch status {
+	case "open":
+		return "🟢"
+	case "in_progress":
+		return "🟡"
+	case "closed":
+		return "🔴"
+	default:
+		return "⚪"
+	}
+}
+
+func (s *Service) topicName(t *Ticket) string {
+	name := topicStatusMark(t.Status) + priorityMark(t.Priority) + " " + tr(s.supportLanguage(), "topic_name", t.ID, t.Title)
+	if utf8.RuneCountInString(name) <= maxTopicNameLength {
+		return name
+	}
+	runes := []rune(name)
+	return string(runes[:maxTopicNameLength-1]) + "…"
+}
+
+// topicLink возвращает ссылку на тему в группе поддержки. Ссылки вида
+// t.me/c/... открываются только у участников группы.
+func (s *Service) topicLink(threadID int) string {
+	chatID := strings.TrimPrefix(strconv.FormatInt(s.cfg.SupportGroupID, 10), "-100")
+	return fmt.Sprintf("https://t.me/c/%s/%d", chatID, threadID)
+}
+
+// topicIcon возвращает custom_emoji_id иконки для статуса или пустую строку,
+// если иконка не настроена.
+func (s *Service) topicIcon(status string) string {
+	return s.cfg.TopicIcons[status]
+}
+
+// refreshTicketViews обновляет всё, что показывает состояние обращения
+// в группе поддержки: карточку и тему. prevStatus — статус до изменения.
+func (s *Service) refreshTicketViews(t *Ticket, prevStatus string, fallbackCard *telebot.Message) {
+	s.updateTicketCard(t, fallbackCard)
+	s.syncForumTopic(t, prevStatus)
+}
+
+func (s *Service) syncForumTopic(t *Ticket, prevStatus string) {
+	if t.ThreadID == 0 {
+		return
+	}
+
+	// Закрытую тему сначала открываем, а открытую сначала переименовываем,
+	// чтобы название менялось, пока тема ещё видна как открытая
+	if prevStatus == "closed" && t.Status != "closed" {
+		if err := s.reopenForumTopic(t.ThreadID); err != nil {
+			log.Printf("Ошибка открытия темы обращения #%d: %v", t.ID, err)
+		}
+	}
+
+	if err := s.editForumTopic(t.ThreadID, s.topicName(t), s.topicIcon(t.Status)); err != nil {
+		if topicGone(err) {
+			s.topicLost(t.ID, t.ThreadID)
+			return
+		}
+		log.Printf("Ошибка обновления темы обращения #%d: %v", t.ID, err)
+	}
+
+	if t.Status == "closed" {
+		if err := s.closeForumTopic(t.ThreadID); err != nil {
+			log.Printf("Ошибка закрытия темы обращения #%d: %v", t.ID, err)
+		}
+	}
+}
+
+// editForumTopic меняет название темы и, если iconID не пустой, её иконку.
+func (s *Service) editForumTopic(threadID int, name, iconID string) error {
+	params := map[string]interface{}{
+		"chat_id":           s.cfg.SupportGroupID,
+		"message_thread_id": threadID,
+		"name":              name,
+	}
+	if iconID != "" {
+		params["icon_custom_emoji_id"] = iconID
+	}
+	return s.forumTopicCall("editForumTopic", params)
+}
+
+func (s *Service) closeForumTopic(threadID int) error {
+	return s.forumTopicCall("closeForumTopic", map[string]interface{}{
+		"chat_id":           s.cfg.SupportGroupID,
+		"message_thread_id": threadID,
+	})
+}
+
+func (s *Service) reopenForumTopic(threadID int) error {
+	return s.forumTopicCall("reopenForumTopic", map[string]interface{}{
+		"chat_id":           s.cfg.SupportGroupID,
+		"message_thread_id": threadID,
+	})
+}
+
+// forumTopicCall вызывает метод управления темой. Ошибка TOPIC_NOT_MODIFIED
+// означает, что тема уже в нужном состоянии, и не считается ошибкой.
+func (s *Service) forumTopicCall(method string, params map[string]interface{}) error {
+	if _, err := s.bot.Raw(method, params); err != nil {
+		if strings.Contains(err.Error(), "TOPIC_NOT_MODIFIED") {
+			return nil
+		}
+		return fmt.Errorf("ошибка API: %v", err)
+	}
+	return nil
+}
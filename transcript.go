@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Выгрузка переписки по обращению в файл: HTML для чтения, JSON для
+// обработки и простой текст. Агенты выгружают командой /export, пользователи —
+// кнопками в истории обращения. Пользователю во всех форматах попадает одно
+// и то же: без внутренних заметок, имён агентов и служебных идентификаторов.
+// Вложения в выгрузку не встраиваются: указывается их тип, агентам — и file_id.
+
+const (
+	TranscriptHTML = "html"
+	TranscriptJSON = "json"
+	TranscriptText = "txt"
+)
+
+var transcriptFormats = []string{TranscriptHTML, TranscriptJSON, TranscriptText}
+
+// TicketTranscript — всё, что попадает в выгрузку обращения. Выгрузка
+// для пользователя (ForCustomer) в JSON сводится к customerTranscript.
+type TicketTranscript struct {
+	ExportedAt    string          `json:"exported_at"`
+	Ticket        Ticket          `json:"ticket"`
+	StatusChanges []StatusChange  `json:"status_changes"`
+	Messages      []TicketMessage `json:"messages"`
+	ForCustomer   bool            `json:"-"`
+}
+
+// customerTranscript — JSON-выгрузка для пользователя: только то, что он
+// видит в переписке, без служебных идентификаторов, данных агентов
+// и внутренних заметок.
+type customerTranscript struct {
+	ExportedAt    string                 `json:"exported_at"`
+	Ticket        customerTicket         `json:"ticket"`
+	StatusChanges []customerStatusChange `json:"status_changes"`
+	Messages      []customerMessage      `json:"messages"`
+}
+
+type customerTicket struct {
+	ID        int64  `json:"id"`
+	Title     string `json:"title"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
+	ClosedAt  string `json:"closed_at,omitempty"`
+}
+
+type customerStatusChange struct {
+	Date       string `json:"date"`
+	FromStatus string `json:"from_status"`
+	ToStatus   string `json:"to_status"`
+	BySupport  bool   `json:"by_support"`
+}
+
+type customerMessage struct {
+	Date      string `json:"date"`
+	EditedAt  string `json:"edited_at,omitempty"`
+	IsSupport bool   `json:"is_support"`
+	Text      string `json:"text"`
+	MediaType string `json:"media_type,omitempty"`
+}
+
+func newCustomerTranscript(t *TicketTranscript) *customerTranscript {
+	c := &customerTranscript{
+		ExportedAt: t.ExportedAt,
+		Ticket: customerTicket{
+			ID:        t.Ticket.ID,
+			Title:     t.Ticket.Title,
+			Status:    t.Ticket.Status,
+			CreatedAt: t.Ticket.CreatedAt,
+			ClosedAt:  t.Ticket.ClosedAt,
+		},
+		StatusChanges: []customerStatusChange{},
+		Messages:      []customerMessage{},
+	}
+	for _, sc := range t.StatusChanges {
+		c.StatusChanges = append(c.StatusChanges, customerStatusChange{
+			Date:       sc.Date,
+			FromStatus: sc.FromStatus,
+			ToStatus:   sc.ToStatus,
+			BySupport:  sc.IsSupport,
+		})
+	}
+	for _, m := range t.Messages {
+		if m.IsInternal {
+			continue
+		}
+		c.Messages = append(c.Messages, customerMessage{
+			Date:      m.Date,
+			EditedAt:  m.EditedAt,
+			IsSupport: m.IsSupport,
+			Text:      m.Text,
+			MediaType: m.MediaType,
+		})
+	}
+	return c
+}
+
+func (s *Service) buildTranscript(ticket *Ticket, forCustomer bool, now time.Time) (*TicketTranscript, error) {
+	history, err := s.store.GetTicketHistory(ticket.ID)
+	if err != nil {
+		return nil, fmt.Errorf("чтение истории: %v", err)
+	}
+	if forCustomer {
+		history = customerHistory(history)
+	}
+
+	changes, err := s.store.GetStatusChanges(ticket.ID)
+	if err != nil {
+		return nil, fmt.Errorf("чтение истории статусов: %v", err)
+	}
+
+	// Пустые списки выгружаются в JSON как [], а не null
+	if history == nil {
+		history = []TicketMessage{}
+	}
+	if changes == nil {
+		changes = []StatusChange{}
+	}
+
+	return &TicketTranscript{
+		ExportedAt:    now.Format(DateTimeLayout),
+		Ticket:        *ticket,
+		StatusChanges: changes,
+		Messages:      history,
+		ForCustomer:   forCustomer,
+	}, nil
+}
+
+// renderTranscript возвращает содержимое файла выгрузки и его имя.
+func renderTranscript(lang, format string, t *TicketTranscript) ([]byte, string, error) {
+	name := fmt.Sprintf("ticket-%d.%s", t.Ticket.ID, format)
+	switch format {
+	case TranscriptJSON:
+		var b bytes.Buffer
+		enc := json.NewEncoder(&b)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		var v any = t
+		if t.ForCustomer {
+			v = newCustomerTranscript(t)
+		}
+		err := enc.Encode(v)
+		return b.Bytes(), name, err
+	case TranscriptText:
+		return []byte(transcriptText(newTranscriptView(lang, t))), name, nil
+	case TranscriptHTML:
+		var b bytes.Buffer
+		err := transcriptTemplate.Execute(&b, newTranscriptView(lang, t))
+		return b.Bytes(), name, err
+	default:
+		return nil, "", fmt.Errorf("неизвестный формат выгрузки: %s", format)
+	}
+}
+
+// transcriptView — выгрузка с уже переведёнными подписями, общая для HTML и текста.
+type transcriptView struct {
+	Lang     string
+	Title    string
+	Fields   [][2]string
+	Changes  []string
+	Messages []transcriptEntry
+	Labels   map[string]string
+}
+
+type transcriptEntry struct {
+	Sender     string
+	Date       string
+	Text       string
+	Attachment string
+	IsSupport  bool
+	IsInternal bool
+}
+
+// newTranscriptView готовит выгрузку для HTML и текста. Для пользователя
+// в неё попадают те же поля, что и в customerTranscript.
+func newTranscriptView(lang string, t *TicketTranscript) *transcriptView {
+	ticket := t.Ticket
+	user := ticket.UserFullName
+	if ticket.UserName != "" {
+		user += " (@" + ticket.UserName + ")"
+	}
+	user = strings.TrimSpace(user)
+
+	v := &transcriptView{
+		Lang:  lang,
+		Title: tr(lang, "transcript_title", ticket.ID),
+		Fields: [][2]string{
+			{tr(lang, "transcript_subject"), ticket.Title},
+		},
+		Labels: map[string]string{
+			"changes":  tr(lang, "transcript_status_changes"),
+			"messages": tr(lang, "transcript_messages"),
+			"empty":    tr(lang, "transcript_no_messages"),
+		},
+	}
+	if !t.ForCustomer {
+		v.Fields = append(v.Fields, [2]string{tr(lang, "transcript_user"), fmt.Sprintf("%s, ID %d", user, ticket.UserID)})
+	}
+	v.Fields = append(v.Fields,
+		[2]string{tr(lang, "transcript_created"), ticket.CreatedAt},
+		[2]string{tr(lang, "transcript_status"), getStatusText(lang, ticket.Status)},
+	)
+	if ticket.AssigneeID != 0 && !t.ForCustomer {
+		v.Fields = append(v.Fields, [2]string{tr(lang, "transcript_assignee"), ticket.AssigneeName})
+	}
+	if ticket.ClosedAt != "" {
+		v.Fields = append(v.Fields, [2]string{tr(lang, "transcript_closed"), ticket.ClosedAt})
+	}
+	if ticket.ArchivedAt != "" && !t.ForCustomer {
+		v.Fields = append(v.Fields, [2]string{tr(lang, "transcript_archived"), ticket.ArchivedAt})
+	}
+	v.Fields = append(v.Fields, [2]string{tr(lang, "transcript_exported"), t.ExportedAt})
+
+	for _, c := range t.StatusChanges {
+		by := c.ChangedByName
+		if t.ForCustomer {
+			by = tr(lang, "sender_you")
+			if c.IsSupport {
+				by = tr(lang, "transcript_support")
+			}
+		}
+		v.Changes = append(v.Changes, tr(lang, "transcript_status_change",
+			c.Date, getStatusText(lang, c.FromStatus), getStatusText(lang, c.ToStatus), by))
+	}
+
+	for _, m := range t.Messages {
+		e := transcriptEntry{
+			Sender:     user,
+			Date:       m.Date,
+			Text:       m.Text,
+			IsSupport:  m.IsSupport,
+			IsInternal: m.IsInternal,
+		}
+		switch {
+		case t.ForCustomer && m.IsSupport:
+			e.Sender = tr(lang, "transcript_support")
+		case t.ForCustomer:
+			e.Sender = tr(lang, "sender_you")
+		case m.IsInternal:
+			e.Sender = tr(lang, "transcript_note", m.UserName)
+		case m.IsSupport:
+			e.Sender = tr(lang, "sender_support", m.UserName)
+		}
+		if m.EditedAt != "" {
+			e.Date += tr(lang, "edited_mark", m.EditedAt)
+		}
+		if m.MediaType != "" {
+			e.Attachment = tr(lang, "transcript_attachment", getMediaText(lang, m.MediaType), m.FileID)
+			if t.ForCustomer {
+				e.Attachment = tr(lang, "transcript_customer_attachment", getMediaText(lang, m.MediaType))
+			}
+		}
+		v.Messages = append(v.Messages, e)
+	}
+	return v
+}
+
+func transcriptText(v *transcriptView) string {
+	var b strings.Builder
+	b.WriteString(v.Title + "\n\n")
+	for _, f := range v.Fields {
+		b.WriteString(f[0] + ": " + f[1] + "\n")
+	}
+
+	if len(v.Changes) > 0 {
+		b.WriteString("\n--- " + v.Labels["changes"] + " ---\n")
+		for _, c := range v.Changes {
+			b.WriteString(c + "\n")
+		}
+	}
+
+	b.WriteString("\n--- " + v.Labels["messages"] + " ---\n")
+	if len(v.Messages) == 0 {
+		b.WriteString(v.Labels["empty"] + "\n")
+	}
+	for _, m := range v.Messages {
+		b.WriteString(fmt.Sprintf("\n[%s] %s:\n", m.Date, m.Sender))
+		if m.Attachment != "" {
+			b.WriteString(m.Attachment + "\n")
+		}
+		if m.Text != "" {
+			b.WriteString(m.Text + "\n")
+		}
+	}
+	return b.String()
+}
+
+var transcriptTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Roboto, sans-serif; max-width: 800px; margin: 2em auto; padding: 0 1em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { text-align: left; padding: .2em 1em .2em 0; vertical-align: top; }
+.msg { border-radius: 8px; padding: .6em .8em; margin: .6em 0; background: #f1f3f5; }
+.msg.support { background: #e7f1ff; }
+.msg.internal { background: #fff4d6; }
+.meta { font-size: .85em; color: #666; margin-bottom: .3em; }
+.text { white-space: pre-wrap; }
+.attachment { font-size: .9em; color: #555; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<table>
+{{range .Fields}}<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>
+{{end}}</table>
+{{if .Changes}}<h2>{{.Labels.changes}}</h2>
+<ul>
+{{range .Changes}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}<h2>{{.Labels.messages}}</h2>
+{{if not .Messages}}<p>{{.Labels.empty}}</p>
+{{end}}{{range .Messages}}<div class="msg{{if .IsInternal}} internal{{else if .IsSupport}} support{{end}}">
+<div class="meta">{{.Sender}} · {{.Date}}</div>
+{{if .Attachment}}<div class="attachment">{{.Attachment}}</div>
+{{end}}{{if .Text}}<div class="text">{{.Text}}</div>
+{{end}}</div>
+{{end}}</body>
+</html>
+`))
+
+func (s *Service) sendTranscript(to telebot.Recipient, lang, format string, t *TicketTranscript, opts *telebot.SendOptions) error {
+	data, name, err := renderTranscript(lang, format, t)
+	if err != nil {
+		return err
+	}
+
+	doc := &telebot.Document{
+		File:     telebot.FromReader(bytes.NewReader(data)),
+		FileName: name,
+		Caption:  tr(lang, "transcript_caption", t.Ticket.ID),
+	}
+	_, err = s.bot.Send(to, doc, opts)
+	return err
+}
+
+// handleExportCommand — /export [id] [html|json|txt] в группе поддержки.
+// В теме обращения номер можно не указывать.
+func (s *Service) handleExportCommand(c telebot.Context) error {
+	if c.Chat().ID != s.cfg.SupportGroupID {
+		return nil
+	}
+
+	lang := s.supportLanguage()
+	format := TranscriptHTML
+	var ticketID int64
+	for _, arg := range strings.Fields(c.Message().Payload) {
+		if isTranscriptFormat(arg) {
+			format = arg
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(arg, "#"), 10, 64)
+		if err != nil {
+			return s.reply(c, tr(lang, "export_usage"))
+		}
+		ticketID = id
+	}
+
+	var (
+		ticket *Ticket
+		err    error
+	)
+	if ticketID == 0 {
+		if c.Message().ThreadID == 0 {
+			return s.reply(c, tr(lang, "export_usage"))
+		}
+		if ticket, err = s.topicTicket(c); ticket == nil {
+			return err
+		}
+	} else if ticket, err = s.store.GetTicket(ticketID); err != nil {
+		log.Printf("Ошибка получения тикета: %v", err)
+		return s.reply(c, tr(lang, "topic_ticket_absent"))
+	}
+
+	transcript, err := s.buildTranscript(ticket, false, time.Now())
+	if err == nil {
+		err = s.sendTranscript(c.Chat(), lang, format, transcript, &telebot.SendOptions{
+			ThreadID:          c.Message().ThreadID,
+			ReplyTo:           c.Message(),
+			AllowWithoutReply: true,
+		})
+	}
+	if err != nil {
+		log.Printf("Ошибка выгрузки обращения #%d: %v", ticket.ID, err)
+		return s.reply(c, tr(lang, "error_export"))
+	}
+	return nil
+}
+
+func isTranscriptFormat(s string) bool {
+	for _, f := range transcriptFormats {
+		if s == f {
+			return true
+		}
+	}
+	return false
+}
+
+// exportButtons — кнопки выгрузки для истории обращения у пользователя.
+func exportButtons(lang string, menu *telebot.ReplyMarkup, ticketID int64) telebot.Row {
+	var buttons []telebot.Btn
+	for _, f := range transcriptFormats {
+		buttons = append(buttons, menu.Data(
+			tr(lang, "btn_export", strings.ToUpper(f)),
+			fmt.Sprintf("export_%d|%s", ticketID, f),
+		))
+	}
+	return menu.Row(buttons...)
+}
+
+// handleExportButton отправляет пользователю выгрузку: данные кнопки export_<id>|<формат>.
+func (s *Service) handleExportButton(c telebot.Context, data string) error {
+	lang := s.userLanguage(c.Sender())
+	ticketID, ok := parseCallbackID(data, "export_")
+	if !ok {
+		return s.respond(c)
+	}
+	_, format, _ := strings.Cut(data, "|")
+	if !isTranscriptFormat(format) {
+		return s.respond(c)
+	}
+
+	ticket, err := s.store.GetTicket(ticketID)
+	if err != nil {
+		log.Printf("Ошибка получения тикета: %v", err)
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "error_data")})
+	}
+	if ticket.UserID != c.Sender().ID {
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "not_your_ticket")})
+	}
+
+	transcript, err := s.buildTranscript(ticket, true, time.Now())
+	if err == nil {
+		err = s.sendTranscript(c.Sender(), lang, format, transcript, &telebot.SendOptions{})
+	}
+	if err != nil {
+		log.Printf("Ошибка выгрузки обращения #%d: %v", ticket.ID, err)
+		return s.respond(c, &telebot.CallbackResponse{Text: tr(lang, "error_export")})
+	}
+	return s.respond(c)
+}
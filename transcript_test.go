@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCustomerTranscriptFields(t *testing.T) {
+	transcript := func(forCustomer bool) *TicketTranscript {
+		return &TicketTranscript{
+			ExportedAt: "2026-03-02 12:00:00",
+			Ticket: Ticket{
+				ID: 7, UserID: 1001, UserName: "ivan", UserFullName: "Иван Петров",
+				Title: "Не проходит оплата", Status: "closed",
+				CreatedAt: "2026-03-01 10:00:00", ClosedAt: "2026-03-02 11:00:00",
+				AssigneeID: 2002, AssigneeName: "Агент Анна",
+			},
+			StatusChanges: []StatusChange{
+				{FromStatus: "open", ToStatus: "in_progress", ChangedByID: 2002, ChangedByName: "Агент Анна", IsSupport: true, Date: "2026-03-01 10:05:00"},
+				{FromStatus: "in_progress", ToStatus: "closed", ChangedByID: 1001, ChangedByName: "Иван Петров", Date: "2026-03-02 11:00:00"},
+			},
+			Messages: []TicketMessage{
+				{UserID: 1001, UserName: "ivan", Text: "Оплата не проходит", MediaType: "photo", FileID: "AgACfileid", Date: "2026-03-01 10:00:00"},
+				{UserID: 2002, UserName: "Агент Анна", IsSupport: true, Text: "Проверяем", Date: "2026-03-01 10:06:00"},
+			},
+			ForCustomer: forCustomer,
+		}
+	}
+	// Служебные данные, которых нет в JSON-выгрузке для пользователя
+	hidden := []string{"Агент Анна", "AgACfileid", "1001", "2002", "ivan"}
+
+	for _, format := range transcriptFormats {
+		t.Run(format, func(t *testing.T) {
+			data, _, err := renderTranscript("ru", format, transcript(true))
+			if err != nil {
+				t.Fatalf("выгрузка для пользователя: %v", err)
+			}
+			for _, h := range hidden {
+				if strings.Contains(string(data), h) {
+					t.Errorf("выгрузка для пользователя содержит %q", h)
+				}
+			}
+			if !strings.Contains(string(data), "Проверяем") {
+				t.Errorf("в выгрузке нет ответа поддержки")
+			}
+
+			data, _, err = renderTranscript("ru", format, transcript(false))
+			if err != nil {
+				t.Fatalf("выгрузка для агентов: %v", err)
+			}
+			for _, h := range []string{"Агент Анна", "AgACfileid", "ivan"} {
+				if !strings.Contains(string(data), h) {
+					t.Errorf("выгрузка для агентов не содержит %q", h)
+				}
+			}
+		})
+	}
+}
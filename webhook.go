@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Максимальный размер тела запроса с обновлением от Telegram
+const maxUpdateSize = 1 << 20
+
+// WebhookPoller принимает обновления по HTTP вместо getUpdates.
+// При старте регистрирует webhook в Telegram, при остановке удаляет его.
+//
+// Для локальной проверки достаточно оставить public_url пустым
+// (регистрация будет пропущена) и отправить записанное обновление:
+//
+//	curl -X POST -H 'X-Telegram-Bot-Api-Secret-Token: <secret>' \
+//		--data @update.json http://localhost:8443/telegram/webhook
+type WebhookPoller struct {
+	cfg WebhookConfig
+	err error
+}
+
+func NewWebhookPoller(cfg WebhookConfig) *WebhookPoller {
+	return &WebhookPoller{cfg: cfg}
+}
+
+func (p *WebhookPoller) Poll(b *telebot.Bot, dest chan telebot.Update, stop chan struct{}) {
+	server := &http.Server{
+		Addr:              p.cfg.Listen,
+		Handler:           p.Handler(dest),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		var err error
+		if p.cfg.TLSCert != "" {
+			err = server.ListenAndServeTLS(p.cfg.TLSCert, p.cfg.TLSKey)
+		} else {
+			err = server.ListenAndServe()
+		}
+		serveErr <- err
+	}()
+	log.Printf("Webhook слушает %s%s", p.cfg.Listen, p.cfg.Path)
+
+	registered := false
+	if p.cfg.PublicURL == "" {
+		log.Printf("Webhook не зарегистрирован в Telegram: public_url не задан")
+	} else if err := b.SetWebhook(p.telegramWebhook()); err != nil {
+		p.err = fmt.Errorf("ошибка регистрации webhook: %v", err)
+	} else {
+		registered = true
+		log.Printf("Webhook зарегистрирован: %s", p.cfg.PublicURL)
+	}
+
+	if p.err == nil {
+		select {
+		case <-stop:
+		case err := <-serveErr:
+			// Без HTTP-сервера бот не получит ни одного обновления
+			p.err = fmt.Errorf("ошибка HTTP-сервера webhook: %v", err)
+		}
+	}
+
+	if registered {
+		p.removeWebhook(b)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Ошибка остановки HTTP-сервера webhook: %v", err)
+	}
+}
+
+// Err возвращает ошибку, из-за которой Poll завершился, не дождавшись stop.
+func (p *WebhookPoller) Err() error {
+	return p.err
+}
+
+func (p *WebhookPoller) removeWebhook(b *telebot.Bot) {
+	if err := b.RemoveWebhook(); err != nil {
+		log.Printf("Ошибка удаления webhook: %v", err)
+	}
+}
+
+func (p *WebhookPoller) telegramWebhook() *telebot.Webhook {
+	endpoint := &telebot.WebhookEndpoint{PublicURL: p.cfg.PublicURL}
+	if p.cfg.UploadCert {
+		endpoint.Cert = p.cfg.TLSCert
+	}
+
+	return &telebot.Webhook{
+		SecretToken:    p.cfg.SecretToken,
+		MaxConnections: p.cfg.MaxConnections,
+		DropUpdates:    p.cfg.DropPendingUpdates,
+		Endpoint:       endpoint,
+	}
+}
+
+// Handler возвращает HTTP-обработчик, который проверяет заголовок
+// X-Telegram-Bot-Api-Secret-Token и передаёт обновления в dest.
+func (p *WebhookPoller) Handler(dest chan<- telebot.Update) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(p.cfg.Path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(p.cfg.SecretToken)) != 1 {
+			log.Printf("Webhook: запрос с неверным секретом от %s", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var update telebot.Update
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUpdateSize)).Decode(&update); err != nil {
+			log.Printf("Webhook: ошибка разбора обновления: %v", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case dest <- update:
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+			// Telegram повторит доставку, если не получит 200
+			http.Error(w, "timeout", http.StatusServiceUnavailable)
+		}
+	})
+	return mux
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/telebot.v3"
+)
+
+// Обновление в том виде, в каком его присылает Telegram
+const recordedUpdate = `{
+	"update_id": 815001,
+	"message": {
+		"message_id": 77,
+		"from": {"id": 1001, "is_bot": false, "first_name": "Иван", "username": "ivan", "language_code": "ru"},
+		"chat": {"id": 1001, "first_name": "Иван", "username": "ivan", "type": "private"},
+		"date": 1760000000,
+		"text": "Не проходит оплата картой"
+	}
+}`
+
+func newWebhookServer(t *testing.T) (*httptest.Server, chan telebot.Update) {
+	t.Helper()
+	cfg := defaultConfig().Webhook
+	cfg.SecretToken = "s3cret"
+
+	updates := make(chan telebot.Update, 1)
+	server := httptest.NewServer(NewWebhookPoller(cfg).Handler(updates))
+	t.Cleanup(server.Close)
+	return server, updates
+}
+
+func postUpdate(t *testing.T, url, secret, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestWebhookRejectsRequests(t *testing.T) {
+	server, updates := newWebhookServer(t)
+	path := server.URL + defaultConfig().Webhook.Path
+
+	tests := []struct {
+		name   string
+		secret string
+		body   string
+		want   int
+	}{
+		{"без секрета", "", recordedUpdate, http.StatusUnauthorized},
+		{"неверный секрет", "wrong", recordedUpdate, http.StatusUnauthorized},
+		{"неразборчивое тело", "s3cret", "{", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := postUpdate(t, path, tt.secret, tt.body); resp.StatusCode != tt.want {
+				t.Fatalf("код ответа %d, ожидался %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+
+	resp, err := http.Get(path)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("GET: код ответа %d, ожидался %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+
+	select {
+	case u := <-updates:
+		t.Fatalf("отклонённый запрос передан боту: %+v", u)
+	default:
+	}
+}
+
+func TestWebhookDispatchesUpdate(t *testing.T) {
+	server, updates := newWebhookServer(t)
+
+	bot, err := telebot.NewBot(telebot.Settings{Offline: true, Synchronous: true})
+	if err != nil {
+		t.Fatalf("NewBot: %v", err)
+	}
+	var got *telebot.Message
+	bot.Handle(telebot.OnText, func(c telebot.Context) error {
+		got = c.Message()
+		return nil
+	})
+
+	resp := postUpdate(t, server.URL+defaultConfig().Webhook.Path, "s3cret", recordedUpdate)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("код ответа %d, ожидался %d", resp.StatusCode, http.StatusOK)
+	}
+
+	select {
+	case u := <-updates:
+		if u.ID != 815001 {
+			t.Fatalf("получено обновление %d", u.ID)
+		}
+		bot.ProcessUpdate(u)
+	case <-time.After(time.Second):
+		t.Fatalf("обновление не передано боту")
+	}
+
+	if got == nil {
+		t.Fatalf("обработчик текста не вызван")
+	}
+	if got.Sender.ID != 1001 || got.Text != "Не проходит оплата картой" {
+		t.Fatalf("сообщение разобрано неверно: %+v", got)
+	}
+}